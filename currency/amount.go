@@ -1,8 +1,15 @@
 package currency
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrNegativeAmount   = errors.New("negative amount")
 )
 
 type InvalidFractional struct {
@@ -65,6 +72,38 @@ func NewAmountFromFractions(currency Currency, fractions uint) Amount {
 	return MustNewAmount(currency, fractions/currency.integerDivider(), fractions%currency.integerDivider())
 }
 
+// ParseAmount is the opposite of [Amount.String], it converts "100.15 AED" to the amount.
+func ParseAmount(s string) (Amount, error) {
+	value, code, ok := strings.Cut(s, " ")
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount %+q, expected format: 100.15 AED", s)
+	}
+
+	c, err := ByCode(code)
+	if err != nil {
+		return Amount{}, err
+	}
+
+	integer, fractional, _ := strings.Cut(value, ".")
+	if uint(len(fractional)) != c.DecimalDigits {
+		return Amount{}, fmt.Errorf("invalid amount %+q, expected %d decimal digits", s, c.DecimalDigits)
+	}
+
+	i, err := strconv.ParseUint(integer, 10, 64)
+	if err != nil {
+		return Amount{}, fmt.Errorf("invalid amount %+q: %w", s, err)
+	}
+
+	var f uint64
+	if fractional != "" {
+		if f, err = strconv.ParseUint(fractional, 10, 64); err != nil {
+			return Amount{}, fmt.Errorf("invalid amount %+q: %w", s, err)
+		}
+	}
+
+	return NewAmount(c, uint(i), uint(f))
+}
+
 func (s Amount) String() string {
 	return fmt.Sprintf(
 		"%d.%0"+strconv.Itoa(int(s.Currency.DecimalDigits))+"d %s",
@@ -74,6 +113,34 @@ func (s Amount) String() string {
 	)
 }
 
+// ToFractional is the opposite of [NewAmountFromFractions], it converts 9.99 USD to 999 cents.
 func (s Amount) ToFractional() uint {
-	return s.Integer*s.Currency.maxFractional() + s.Fractional
+	return s.Integer*s.Currency.integerDivider() + s.Fractional
+}
+
+// Add returns the sum of both amounts, the currencies must be the same.
+func (s Amount) Add(x Amount) (Amount, error) {
+	if !s.Currency.Is(x.Currency) {
+		return Amount{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, s.Currency.Code, x.Currency.Code)
+	}
+
+	return NewAmountFromFractions(s.Currency, s.ToFractional()+x.ToFractional()), nil
+}
+
+// Sub returns the difference of both amounts, the currencies must be the same,
+// and x cannot be greater than s - we don't support negative amounts.
+func (s Amount) Sub(x Amount) (Amount, error) {
+	if !s.Currency.Is(x.Currency) {
+		return Amount{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, s.Currency.Code, x.Currency.Code)
+	}
+
+	if x.ToFractional() > s.ToFractional() {
+		return Amount{}, fmt.Errorf("%w: %s - %s", ErrNegativeAmount, s, x)
+	}
+
+	return NewAmountFromFractions(s.Currency, s.ToFractional()-x.ToFractional()), nil
+}
+
+func (s Amount) IsZero() bool {
+	return s.ToFractional() == 0
 }
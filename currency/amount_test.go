@@ -151,3 +151,86 @@ func TestNewAmountFromFractions(t *testing.T) {
 		})
 	}
 }
+
+func TestAmount_ToFractional(t *testing.T) {
+	t.Parallel()
+
+	for _, fractions := range []uint{0, 5, 99, 100, 1005, 99999} {
+		fractions := fractions
+
+		t.Run(fmt.Sprintf("%d", fractions), func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, fractions, currency.NewAmountFromFractions(currency.USD, fractions).ToFractional())
+		})
+	}
+
+	// regression: the integer part was multiplied by the max fractional value (99) instead of 100,
+	// e.g. 999.99 AED was sent to the gateways as 99000 fils
+	tests := []struct {
+		amount currency.Amount
+		want   uint
+	}{
+		{amount: currency.MustNewAmount(currency.AED, 999, 99), want: 99999},
+		{amount: currency.MustNewAmount(currency.AED, 1, 0), want: 100},
+		{amount: currency.MustNewAmount(currency.USD, 10, 5), want: 1005},
+		{amount: currency.MustNewAmount(currency.USD, 0, 99), want: 99},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.amount.String(), func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, tt.amount.ToFractional())
+		})
+	}
+}
+
+func TestAmount_Arithmetic(t *testing.T) {
+	t.Parallel()
+
+	a := currency.MustNewAmount(currency.USD, 10, 50)
+	b := currency.MustNewAmount(currency.USD, 0, 75)
+
+	sum, err := a.Add(b)
+	require.NoError(t, err)
+	assert.Equal(t, currency.MustNewAmount(currency.USD, 11, 25), sum)
+
+	diff, err := a.Sub(b)
+	require.NoError(t, err)
+	assert.Equal(t, currency.MustNewAmount(currency.USD, 9, 75), diff)
+
+	zero, err := a.Sub(a)
+	require.NoError(t, err)
+	assert.True(t, zero.IsZero())
+
+	_, err = b.Sub(a)
+	require.ErrorIs(t, err, currency.ErrNegativeAmount)
+
+	_, err = a.Add(currency.MustNewAmount(currency.AED, 1, 0))
+	require.ErrorIs(t, err, currency.ErrCurrencyMismatch)
+}
+
+func TestParseAmount(t *testing.T) {
+	t.Parallel()
+
+	for _, a := range []currency.Amount{
+		currency.MustNewAmount(currency.USD, 150, 15),
+		currency.MustNewAmount(currency.AED, 2000, 0),
+		currency.MustNewAmount(currency.AED, 0, 5),
+	} {
+		got, err := currency.ParseAmount(a.String())
+		require.NoError(t, err)
+		assert.Equal(t, a, got)
+	}
+
+	for _, s := range []string{"100 AED", "100.1 AED", "100.15", "-1.00 AED", "1.00 EUR", "1.0x AED"} {
+		_, err := currency.ParseAmount(s)
+		assert.Error(t, err, s)
+	}
+
+	_, err := currency.ParseAmount("1.00 EUR")
+	require.ErrorIs(t, err, currency.ErrUnknownCurrency)
+}
@@ -1,5 +1,10 @@
 package currency
 
+import (
+	"errors"
+	"fmt"
+)
+
 var (
 	AED = Currency{
 		Code:          "AED",
@@ -36,3 +41,17 @@ func (c Currency) integerDivider() uint {
 func (c Currency) maxFractional() uint {
 	return c.integerDivider() - 1
 }
+
+// ErrUnknownCurrency is returned when the currency code is not supported.
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// ByCode returns the currency with the given ISO 4217 code.
+func ByCode(code string) (Currency, error) {
+	for _, c := range []Currency{AED, USD} {
+		if c.Code == code {
+			return c, nil
+		}
+	}
+
+	return Currency{}, fmt.Errorf("%w: %+q", ErrUnknownCurrency, code)
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+func (p Payment) validateCancel() error {
+	if p.Status != PaymentInitiated {
+		return fmt.Errorf("%w: payment has status %+q", ErrInvalidState, p.Status)
+	}
+
+	return nil
+}
+
+// statusUpdateEvent returns the event for the status reported by the gateway.
+//
+// The customer can pay just before the gateway gets the cancellation (or the gateway cannot cancel payments at all),
+// the webhook wins in that case - the payment is paid, and the whole amount is refunded automatically.
+func (p Payment) statusUpdateEvent(status PaymentStatus) (Event, error) {
+	if p.Status == PaymentCancelled && status == PaymentPaid {
+		refundID := uuid.New()
+		amount := p.Amount
+
+		return Event{Type: EventPaymentPaidAfterCancel, RefundID: &refundID, Amount: &amount}, nil
+	}
+
+	if p.Status != PaymentInitiated {
+		return Event{}, fmt.Errorf("%w: payment has status %+q", ErrInvalidState, p.Status)
+	}
+
+	eventType, err := eventTypeForStatus(status)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Type: eventType}, nil
+}
+
+// CancelByID abandons the initiated payment.
+func (i *InMemoryPaymentRepository) CancelByID(ctx context.Context, paymentID uuid.UUID) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.CancelByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := x.validateCancel(); err != nil {
+		return err
+	}
+
+	return i.apply(ctx, x, Event{Type: EventPaymentCancelled})
+}
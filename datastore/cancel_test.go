@@ -0,0 +1,68 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/datastore"
+)
+
+type cancelRepository interface {
+	refundRepository
+	CancelByID(_ context.Context, paymentID uuid.UUID) error
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	eventSourced, err := datastore.NewEventSourcedPaymentRepository(ctx, datastore.NewInMemoryEventStore(), 0)
+	require.NoError(t, err)
+
+	repositories := map[string]cancelRepository{
+		"In memory":     datastore.NewInMemoryPaymentRepository(),
+		"Event sourced": eventSourced,
+	}
+
+	for name, repo := range repositories {
+		repo := repo
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			paid, cancelled := newPayment(1), newPayment(2)
+			for _, p := range []datastore.Payment{paid, cancelled} {
+				require.NoError(t, repo.Create(ctx, p))
+			}
+
+			// the webhook wins
+			require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, paid.ExternalID, datastore.PaymentPaid))
+			require.ErrorIs(t, repo.CancelByID(ctx, paid.ID), datastore.ErrInvalidState)
+			require.ErrorIs(t, repo.CancelByID(ctx, uuid.New()), datastore.ErrNotFound)
+
+			require.NoError(t, repo.CancelByID(ctx, cancelled.ID))
+			require.ErrorIs(t, repo.CancelByID(ctx, cancelled.ID), datastore.ErrInvalidState)
+			require.ErrorIs(t, repo.UpdateInitiatedByExternalID(ctx, cancelled.ExternalID, datastore.PaymentFailed), datastore.ErrInvalidState)
+
+			// paid after the cancellation, the whole amount is refunded
+			require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, cancelled.ExternalID, datastore.PaymentPaid))
+			require.ErrorIs(t, repo.UpdateInitiatedByExternalID(ctx, cancelled.ExternalID, datastore.PaymentPaid), datastore.ErrInvalidState)
+
+			got, err := repo.GetByID(ctx, cancelled.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefundPending), got.Status)
+			require.Len(t, got.Refunds, 1)
+			assert.Equal(t, cancelled.Amount, got.Refunds[0].Amount)
+
+			require.NoError(t, repo.UpdateRefund(ctx, cancelled.ID, got.Refunds[0].ID, datastore.RefundUpdate{Status: datastore.RefundSucceeded}))
+
+			got, err = repo.GetByID(ctx, cancelled.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefunded), got.Status)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/currency"
+)
+
+// ErrInvalidCaptureAmount is returned when the capture is empty, or exceeds the authorized amount.
+var ErrInvalidCaptureAmount = errors.New("invalid capture amount")
+
+func (p Payment) validateCapture(amount currency.Amount) error {
+	if p.Status != PaymentAuthorized {
+		return fmt.Errorf("%w: payment has status %+q", ErrInvalidState, p.Status)
+	}
+
+	if amount.IsZero() {
+		return fmt.Errorf("%w: zero amount", ErrInvalidCaptureAmount)
+	}
+
+	if _, err := p.Amount.Sub(amount); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCaptureAmount, err)
+	}
+
+	return nil
+}
+
+func (p Payment) validateVoid() error {
+	if p.Status != PaymentAuthorized {
+		return fmt.Errorf("%w: payment has status %+q", ErrInvalidState, p.Status)
+	}
+
+	return nil
+}
+
+// CaptureByID charges the authorized payment, the rest of the authorized amount is released.
+func (i *InMemoryPaymentRepository) CaptureByID(ctx context.Context, paymentID uuid.UUID, amount currency.Amount) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.CaptureByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := x.validateCapture(amount); err != nil {
+		return err
+	}
+
+	return i.apply(ctx, x, Event{Type: EventPaymentCaptured, Amount: &amount})
+}
+
+func (i *InMemoryPaymentRepository) VoidByID(ctx context.Context, paymentID uuid.UUID) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.VoidByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := x.validateVoid(); err != nil {
+		return err
+	}
+
+	return i.apply(ctx, x, Event{Type: EventPaymentVoided})
+}
@@ -0,0 +1,79 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+)
+
+type captureRepository interface {
+	refundRepository
+	CaptureByID(_ context.Context, paymentID uuid.UUID, amount currency.Amount) error
+	VoidByID(_ context.Context, paymentID uuid.UUID) error
+}
+
+func TestCaptureAndVoid(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	eventSourced, err := datastore.NewEventSourcedPaymentRepository(ctx, datastore.NewInMemoryEventStore(), 0)
+	require.NoError(t, err)
+
+	repositories := map[string]captureRepository{
+		"In memory":     datastore.NewInMemoryPaymentRepository(),
+		"Event sourced": eventSourced,
+	}
+
+	amount := func(fractions uint) currency.Amount {
+		return currency.NewAmountFromFractions(currency.AED, fractions)
+	}
+
+	for name, repo := range repositories {
+		repo := repo
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			captured, voided := newPayment(1), newPayment(2) // 100.00 AED
+			for _, p := range []datastore.Payment{captured, voided} {
+				require.NoError(t, repo.Create(ctx, p))
+				require.ErrorIs(t, repo.CaptureByID(ctx, p.ID, amount(100)), datastore.ErrInvalidState)
+				require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentAuthorized))
+			}
+
+			require.ErrorIs(t, repo.CaptureByID(ctx, captured.ID, amount(10001)), datastore.ErrInvalidCaptureAmount)
+			require.ErrorIs(t, repo.CaptureByID(ctx, captured.ID, amount(0)), datastore.ErrInvalidCaptureAmount)
+			require.NoError(t, repo.CaptureByID(ctx, captured.ID, amount(6000)))
+			require.ErrorIs(t, repo.VoidByID(ctx, captured.ID), datastore.ErrInvalidState)
+
+			got, err := repo.GetByID(ctx, captured.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), got.Status)
+			assert.Equal(t, amount(6000), got.CapturedAmount())
+			assert.Equal(t, amount(6000), got.RefundableAmount())
+
+			// only the captured amount can be refunded
+			refund := datastore.Refund{ID: uuid.New(), Amount: amount(6000)}
+			require.NoError(t, repo.CreateRefund(ctx, captured.ID, refund))
+			require.NoError(t, repo.UpdateRefund(ctx, captured.ID, refund.ID, datastore.RefundUpdate{Status: datastore.RefundSucceeded}))
+
+			got, err = repo.GetByID(ctx, captured.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefunded), got.Status)
+
+			require.NoError(t, repo.VoidByID(ctx, voided.ID))
+			require.ErrorIs(t, repo.VoidByID(ctx, voided.ID), datastore.ErrInvalidState)
+			require.ErrorIs(t, repo.VoidByID(ctx, uuid.New()), datastore.ErrNotFound)
+
+			got, err = repo.GetByID(ctx, voided.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentVoided), got.Status)
+		})
+	}
+}
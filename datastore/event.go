@@ -0,0 +1,433 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+)
+
+type EventType string
+
+const (
+	EventPaymentInitiated EventType = "PaymentInitiated"
+	EventPaymentPaid      EventType = "PaymentPaid"
+	EventPaymentFailed    EventType = "PaymentFailed"
+	EventPaymentExpired   EventType = "PaymentExpired"
+	EventPaymentRefunded  EventType = "PaymentRefunded"
+
+	EventPaymentAuthorized EventType = "PaymentAuthorized"
+	EventPaymentCaptured   EventType = "PaymentCaptured"
+	EventPaymentVoided     EventType = "PaymentVoided"
+
+	EventPaymentHeldForReview EventType = "PaymentHeldForReview" // created, but not sent to the gateway
+	EventPaymentApproved      EventType = "PaymentApproved"      // sent to the gateway after the review
+	EventPaymentRejected      EventType = "PaymentRejected"
+
+	EventPaymentCancelled       EventType = "PaymentCancelled"
+	EventPaymentPaidAfterCancel EventType = "PaymentPaidAfterCancel" // paid by the customer, and refunded automatically
+
+	EventRefundRequested      EventType = "RefundRequested"
+	EventRefundSubmitted      EventType = "RefundSubmitted" // accepted by the gateway, but not completed yet
+	EventRefundRetryScheduled EventType = "RefundRetryScheduled"
+	EventRefundSucceeded      EventType = "RefundSucceeded"
+	EventRefundFailed         EventType = "RefundFailed"
+)
+
+// ErrConcurrentModification is returned when somebody else appended to the stream in the meantime.
+var ErrConcurrentModification = errors.New("concurrent modification")
+
+// Event is a domain event, the stream of events for the given payment is the source of truth,
+// [Payment] is just a projection.
+//
+// Only [EventPaymentInitiated] and [EventPaymentHeldForReview] carry the payment details, other events represent the status change.
+// [EventPaymentHeldForReview] carries the reasons of the review, [EventPaymentApproved] carries the external ID and the fee.
+// [EventPaymentCaptured] carries the captured amount.
+// [EventPaymentPaidAfterCancel] carries the ID and the amount of the automatic refund.
+// Refund events carry RefundID, [EventRefundRequested] carries the amount of the refund,
+// and the other refund events carry the external ID of the refund (if any).
+// MerchantID is set on every event, so consumers can route them without fetching the payment.
+// Fee charged by the gateway is carried by [EventPaymentInitiated] and the refund events accepted by the gateway.
+type Event struct {
+	PaymentID  uuid.UUID `json:"payment_id"`
+	MerchantID uuid.UUID `json:"merchant_id"`
+	Version    uint64    `json:"version"` // position in the stream, the first event has version 1
+	Type       EventType `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+
+	ExternalID        string           `json:"external_id,omitempty"`
+	Amount            *currency.Amount `json:"amount,omitempty"`
+	MerchantReference string           `json:"merchant_reference,omitempty"`
+	CustomerID        string           `json:"customer_id,omitempty"`
+	ManualCapture     bool             `json:"manual_capture,omitempty"`
+	Context           map[string]any   `json:"context,omitempty"`
+	Reasons           []string         `json:"reasons,omitempty"`
+	RefundID          *uuid.UUID       `json:"refund_id,omitempty"`
+	Reason            string           `json:"reason,omitempty"`
+	RetryAt           *time.Time       `json:"retry_at,omitempty"`
+	Fee               *currency.Amount `json:"fee,omitempty"`
+}
+
+// eventTypeForStatus maps the status reported by the gateway to the event.
+func eventTypeForStatus(s PaymentStatus) (EventType, error) {
+	switch s {
+	case PaymentPaid:
+		return EventPaymentPaid, nil
+	case PaymentFailed:
+		return EventPaymentFailed, nil
+	case PaymentExpired:
+		return EventPaymentExpired, nil
+	case PaymentRefunded:
+		return EventPaymentRefunded, nil
+	case PaymentAuthorized:
+		return EventPaymentAuthorized, nil
+	}
+
+	return "", fmt.Errorf("unsupported status %+q", s)
+}
+
+// Apply returns the payment after the given event.
+func (e Event) Apply(p Payment) (Payment, error) {
+	switch e.Type {
+	case EventPaymentInitiated, EventPaymentHeldForReview:
+		if e.Amount == nil {
+			return Payment{}, fmt.Errorf("%s without amount", e.Type)
+		}
+
+		p = Payment{
+			ID:                e.PaymentID,
+			MerchantID:        e.MerchantID,
+			ExternalID:        e.ExternalID,
+			Status:            PaymentInitiated,
+			Amount:            *e.Amount,
+			MerchantReference: e.MerchantReference,
+			CustomerID:        e.CustomerID,
+			ManualCapture:     e.ManualCapture,
+			Context:           e.Context,
+			Fee:               e.fee(),
+			CreatedAt:         e.OccurredAt,
+			UpdatedAt:         e.OccurredAt,
+		}
+
+		if e.Type == EventPaymentHeldForReview {
+			p.Status = PaymentReview
+			p.RiskReasons = slices.Clone(e.Reasons)
+		}
+
+		return p, nil
+	case EventPaymentApproved:
+		if e.ExternalID == "" {
+			return Payment{}, errors.New("PaymentApproved without external ID")
+		}
+
+		p.Status = PaymentInitiated
+		p.ExternalID = e.ExternalID
+		p.Fee = e.fee()
+	case EventPaymentRejected:
+		p.Status = PaymentRejected
+	case EventPaymentPaid:
+		p.Status = PaymentPaid
+	case EventPaymentFailed:
+		p.Status = PaymentFailed
+	case EventPaymentExpired:
+		p.Status = PaymentExpired
+	case EventPaymentRefunded:
+		p.Status = PaymentRefunded
+	case EventPaymentAuthorized:
+		p.Status = PaymentAuthorized
+	case EventPaymentCaptured:
+		if e.Amount == nil {
+			return Payment{}, errors.New("PaymentCaptured without amount")
+		}
+
+		captured := *e.Amount
+		p.Status = PaymentPaid
+		p.Captured = &captured
+	case EventPaymentVoided:
+		p.Status = PaymentVoided
+	case EventPaymentCancelled:
+		p.Status = PaymentCancelled
+	case EventPaymentPaidAfterCancel:
+		p.Status = PaymentPaid
+
+		return Event{
+			PaymentID:  e.PaymentID,
+			Type:       EventRefundRequested,
+			OccurredAt: e.OccurredAt,
+			RefundID:   e.RefundID,
+			Amount:     e.Amount,
+		}.applyRefund(p)
+	case EventRefundRequested, EventRefundSubmitted, EventRefundRetryScheduled, EventRefundSucceeded, EventRefundFailed:
+		return e.applyRefund(p)
+	default:
+		return Payment{}, fmt.Errorf("unknown event %+q", e.Type)
+	}
+
+	p.UpdatedAt = e.OccurredAt
+
+	return p, nil
+}
+
+// fee returns the copy of the fee, so the payment does not share it with the event.
+func (e Event) fee() *currency.Amount {
+	if e.Fee == nil {
+		return nil
+	}
+
+	fee := *e.Fee
+
+	return &fee
+}
+
+func (e Event) applyRefund(p Payment) (Payment, error) {
+	if e.RefundID == nil {
+		return Payment{}, fmt.Errorf("%s without refund ID", e.Type)
+	}
+
+	// the slice is shared with the previous versions of the payment, so it must not be modified in place
+	p.Refunds = slices.Clone(p.Refunds)
+	p.UpdatedAt = e.OccurredAt
+
+	if e.Type == EventRefundRequested {
+		if e.Amount == nil {
+			return Payment{}, errors.New("RefundRequested without amount")
+		}
+
+		p.Refunds = append(p.Refunds, Refund{
+			ID:        *e.RefundID,
+			Amount:    *e.Amount,
+			Status:    RefundPending,
+			CreatedAt: e.OccurredAt,
+			UpdatedAt: e.OccurredAt,
+		})
+		p.Status = p.statusAfterRefunds()
+
+		return p, nil
+	}
+
+	n := p.refundIndex(func(r Refund) bool { return r.ID == *e.RefundID })
+	if n < 0 {
+		return Payment{}, fmt.Errorf("%s of unknown refund %+q", e.Type, *e.RefundID)
+	}
+
+	r := &p.Refunds[n]
+	r.UpdatedAt = e.OccurredAt
+	if e.ExternalID != "" {
+		r.ExternalID = e.ExternalID
+	}
+
+	if e.Reason != "" {
+		r.Reason = e.Reason
+	}
+
+	if e.Fee != nil {
+		r.Fee = e.fee()
+	}
+
+	switch e.Type {
+	case EventRefundRetryScheduled:
+		if e.RetryAt == nil {
+			return Payment{}, errors.New("RefundRetryScheduled without retry time")
+		}
+
+		r.Attempts++
+		r.NextAttemptAt = *e.RetryAt
+	case EventRefundSucceeded:
+		r.Status = RefundSucceeded
+	case EventRefundFailed:
+		r.Status = RefundFailed
+	}
+
+	p.Status = p.statusAfterRefunds()
+
+	return p, nil
+}
+
+// Snapshot is the state of the payment after applying all the events up to Version.
+type Snapshot struct {
+	Payment Payment `json:"payment"`
+	Version uint64  `json:"version"`
+}
+
+type EventStore interface {
+	// Append stores the events at the end of the stream,
+	// it returns [ErrConcurrentModification] when the current version of the stream differs from the expected one.
+	Append(ctx context.Context, streamID uuid.UUID, expectedVersion uint64, events ...Event) error
+	// Load returns the events of the given stream with the version greater than afterVersion.
+	Load(ctx context.Context, streamID uuid.UUID, afterVersion uint64) ([]Event, error)
+	// Streams returns the IDs of all the streams.
+	Streams(ctx context.Context) ([]uuid.UUID, error)
+	SaveSnapshot(ctx context.Context, s Snapshot) error
+	LoadSnapshot(ctx context.Context, streamID uuid.UUID) (_ Snapshot, ok bool, _ error)
+	// ReadAll returns up to limit events of all the streams in the order they were appended,
+	// Seq of the message is the global position of the event (starting from 1), greater than the given one.
+	ReadAll(ctx context.Context, afterSeq uint64, limit int) ([]OutboxMessage, error)
+	// SaveCheckpoint stores the position processed by the consumer, so it doesn't start from the beginning after the restart.
+	SaveCheckpoint(ctx context.Context, consumer string, seq uint64) error
+	// LoadCheckpoint returns zero when the consumer has not processed anything yet.
+	LoadCheckpoint(ctx context.Context, consumer string) (uint64, error)
+}
+
+// Checkpoint is the position processed by the consumer, see [EventStore.SaveCheckpoint].
+type Checkpoint struct {
+	Consumer string `json:"consumer"`
+	Seq      uint64 `json:"seq"`
+}
+
+type InMemoryEventStore struct {
+	streams map[uuid.UUID][]Event
+	// all events in the order they were appended, the index of the event is its global position minus one
+	all         []Event
+	snapshots   map[uuid.UUID]Snapshot
+	checkpoints map[string]uint64
+	locker      *sync.RWMutex
+}
+
+func NewInMemoryEventStore() *InMemoryEventStore {
+	return &InMemoryEventStore{
+		streams:     make(map[uuid.UUID][]Event),
+		snapshots:   make(map[uuid.UUID]Snapshot),
+		checkpoints: make(map[string]uint64),
+		locker:      &sync.RWMutex{},
+	}
+}
+
+func (s *InMemoryEventStore) Append(_ context.Context, streamID uuid.UUID, expectedVersion uint64, events ...Event) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.append(streamID, expectedVersion, events)
+}
+
+// append must be called under the write lock.
+func (s *InMemoryEventStore) append(streamID uuid.UUID, expectedVersion uint64, events []Event) error {
+	if err := s.validate(streamID, expectedVersion, events); err != nil {
+		return fmt.Errorf("InMemoryEventStore.Append(%+q): %w", streamID, err)
+	}
+
+	s.add(streamID, events)
+
+	return nil
+}
+
+// add must be called under the write lock, events must be validated.
+func (s *InMemoryEventStore) add(streamID uuid.UUID, events []Event) {
+	s.streams[streamID] = append(s.streams[streamID], events...)
+	s.all = append(s.all, events...)
+}
+
+// validate must be called under the lock.
+func (s *InMemoryEventStore) validate(streamID uuid.UUID, expectedVersion uint64, events []Event) error {
+	if current := uint64(len(s.streams[streamID])); current != expectedVersion {
+		return fmt.Errorf("%w, version %d expected, %d given", ErrConcurrentModification, current, expectedVersion)
+	}
+
+	for n, e := range events {
+		if e.PaymentID != streamID || e.Version != expectedVersion+uint64(n)+1 {
+			return fmt.Errorf("event %d does not match the stream", n)
+		}
+	}
+
+	return nil
+}
+
+func (s *InMemoryEventStore) Load(_ context.Context, streamID uuid.UUID, afterVersion uint64) ([]Event, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	stream := s.streams[streamID]
+	if afterVersion >= uint64(len(stream)) {
+		return nil, nil
+	}
+
+	// versions start from 1, so the event with version afterVersion+1 has index afterVersion
+	return append([]Event(nil), stream[afterVersion:]...), nil
+}
+
+func (s *InMemoryEventStore) Streams(context.Context) ([]uuid.UUID, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	ids := make([]uuid.UUID, 0, len(s.streams))
+	for id := range s.streams {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(a, b int) bool {
+		return ids[a].String() < ids[b].String()
+	})
+
+	return ids, nil
+}
+
+func (s *InMemoryEventStore) SaveSnapshot(_ context.Context, snapshot Snapshot) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.saveSnapshot(snapshot)
+
+	return nil
+}
+
+// saveSnapshot must be called under the write lock.
+func (s *InMemoryEventStore) saveSnapshot(snapshot Snapshot) {
+	if current, ok := s.snapshots[snapshot.Payment.ID]; ok && current.Version >= snapshot.Version {
+		return
+	}
+
+	s.snapshots[snapshot.Payment.ID] = snapshot
+}
+
+func (s *InMemoryEventStore) LoadSnapshot(_ context.Context, streamID uuid.UUID) (Snapshot, bool, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	snapshot, ok := s.snapshots[streamID]
+
+	return snapshot, ok, nil
+}
+
+func (s *InMemoryEventStore) ReadAll(_ context.Context, afterSeq uint64, limit int) ([]OutboxMessage, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	if afterSeq >= uint64(len(s.all)) || limit <= 0 {
+		return nil, nil
+	}
+
+	end := min(uint64(len(s.all)), afterSeq+uint64(limit))
+	messages := make([]OutboxMessage, 0, end-afterSeq)
+
+	for i := afterSeq; i < end; i++ {
+		messages = append(messages, OutboxMessage{Seq: i + 1, Event: s.all[i]})
+	}
+
+	return messages, nil
+}
+
+func (s *InMemoryEventStore) SaveCheckpoint(_ context.Context, consumer string, seq uint64) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.saveCheckpoint(consumer, seq)
+
+	return nil
+}
+
+// saveCheckpoint must be called under the write lock.
+func (s *InMemoryEventStore) saveCheckpoint(consumer string, seq uint64) {
+	s.checkpoints[consumer] = seq
+}
+
+func (s *InMemoryEventStore) LoadCheckpoint(_ context.Context, consumer string) (uint64, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	return s.checkpoints[consumer], nil
+}
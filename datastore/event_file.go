@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+const (
+	eventsFileName         = "events.log"
+	eventSnapshotsFileName = "snapshots.log"
+	checkpointsFileName    = "checkpoints.log"
+)
+
+// FileEventStore keeps all the events in memory and appends them to the file, it's loaded on start-up.
+// Every write is synced to the disk, the same checksummed format as in [FilePaymentRepository] is used.
+type FileEventStore struct {
+	*InMemoryEventStore
+
+	events      *os.File
+	snapshots   *os.File
+	checkpoints *os.File
+}
+
+func NewFileEventStore(dir string) (_ *FileEventStore, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("NewFileEventStore(%+q): %w", dir, err)
+		}
+	}()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &FileEventStore{InMemoryEventStore: NewInMemoryEventStore()}
+
+	err = readRecords(filepath.Join(dir, eventsFileName), tornTailTruncate, func(e Event) {
+		s.add(e.PaymentID, []Event{e})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read the events: %w", err)
+	}
+
+	err = readRecords(filepath.Join(dir, eventSnapshotsFileName), tornTailTruncate, func(snapshot Snapshot) {
+		s.saveSnapshot(snapshot)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read the snapshots: %w", err)
+	}
+
+	// the last checkpoint of the consumer wins
+	err = readRecords(filepath.Join(dir, checkpointsFileName), tornTailTruncate, func(c Checkpoint) {
+		s.saveCheckpoint(c.Consumer, c.Seq)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read the checkpoints: %w", err)
+	}
+
+	const flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+	if s.events, err = os.OpenFile(filepath.Join(dir, eventsFileName), flags, 0o644); err != nil {
+		return nil, err
+	}
+
+	if s.snapshots, err = os.OpenFile(filepath.Join(dir, eventSnapshotsFileName), flags, 0o644); err != nil {
+		_ = s.events.Close()
+
+		return nil, err
+	}
+
+	if s.checkpoints, err = os.OpenFile(filepath.Join(dir, checkpointsFileName), flags, 0o644); err != nil {
+		_ = s.events.Close()
+		_ = s.snapshots.Close()
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileEventStore) Append(_ context.Context, streamID uuid.UUID, expectedVersion uint64, events ...Event) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if err := s.validate(streamID, expectedVersion, events); err != nil {
+		return fmt.Errorf("FileEventStore.Append(%+q): %w", streamID, err)
+	}
+
+	if err := writeRecords(s.events, events); err != nil {
+		return fmt.Errorf("FileEventStore.Append(%+q): %w", streamID, err)
+	}
+
+	s.add(streamID, events)
+
+	return nil
+}
+
+func (s *FileEventStore) SaveSnapshot(_ context.Context, snapshot Snapshot) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if err := writeRecords(s.snapshots, []Snapshot{snapshot}); err != nil {
+		return fmt.Errorf("FileEventStore.SaveSnapshot(%+q): %w", snapshot.Payment.ID, err)
+	}
+
+	s.saveSnapshot(snapshot)
+
+	return nil
+}
+
+func (s *FileEventStore) SaveCheckpoint(_ context.Context, consumer string, seq uint64) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if err := writeRecords(s.checkpoints, []Checkpoint{{Consumer: consumer, Seq: seq}}); err != nil {
+		return fmt.Errorf("FileEventStore.SaveCheckpoint(%+q): %w", consumer, err)
+	}
+
+	s.saveCheckpoint(consumer, seq)
+
+	return nil
+}
+
+func (s *FileEventStore) Close() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return errors.Join(s.events.Close(), s.snapshots.Close(), s.checkpoints.Close())
+}
+
+// writeRecords writes all the records using a single write call and syncs the file.
+func writeRecords[T any](f *os.File, records []T) error {
+	var buff []byte
+
+	for _, r := range records {
+		line, err := encodeRecord(r)
+		if err != nil {
+			return err
+		}
+
+		buff = append(buff, line...)
+	}
+
+	if _, err := f.Write(buff); err != nil {
+		return fmt.Errorf("could not write: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("could not sync: %w", err)
+	}
+
+	return nil
+}
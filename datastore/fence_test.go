@@ -0,0 +1,62 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+)
+
+func TestFencedWrites(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	eventSourced, err := datastore.NewEventSourcedPaymentRepository(ctx, datastore.NewInMemoryEventStore(), 0)
+	require.NoError(t, err)
+
+	repositories := map[string]refundRepository{
+		"In memory":     datastore.NewInMemoryPaymentRepository(),
+		"Event sourced": eventSourced,
+	}
+
+	for name, repo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := newPayment(1) // 100.00 AED
+			require.NoError(t, repo.Create(ctx, p))
+			require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+
+			locker := lock.NewInMemory(lock.Options{TTL: time.Millisecond * 10})
+
+			stale, err := locker.Lock(ctx, "payment:"+p.ID.String())
+			require.NoError(t, err)
+
+			// the holder is too slow, the lease expires and somebody else takes over the lock
+			time.Sleep(time.Millisecond * 20)
+
+			current, err := locker.Lock(ctx, "payment:"+p.ID.String())
+			require.NoError(t, err)
+
+			refund := func(fractions uint) datastore.Refund {
+				return datastore.Refund{ID: uuid.New(), Amount: currency.NewAmountFromFractions(currency.AED, fractions)}
+			}
+
+			require.NoError(t, repo.CreateRefund(lock.NewContext(ctx, current), p.ID, refund(6000)))
+
+			err = repo.CreateRefund(lock.NewContext(ctx, stale), p.ID, refund(4000))
+			require.ErrorIs(t, err, lock.ErrLeaseLost)
+
+			stored, err := repo.GetByID(ctx, p.ID)
+			require.NoError(t, err)
+			assert.Len(t, stored.Refunds, 1)
+		})
+	}
+}
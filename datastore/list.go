@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor is returned when the cursor was not produced by [ListResult.NextCursor].
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListQuery filters payments, all the criteria are optional.
+// Payments are ordered by CreatedAt (the latest first), and then by ID, so the order is stable.
+type ListQuery struct {
+	// MerchantID is optional for internal consumers (e.g. background jobs), merchants must always set it
+	MerchantID        *uuid.UUID
+	Status            PaymentStatus
+	Currency          string
+	CreatedFrom       time.Time // inclusive
+	CreatedTo         time.Time // exclusive
+	MinAmount         *uint     // fractions, inclusive
+	MaxAmount         *uint     // fractions, inclusive
+	MerchantReference string
+	Limit             int
+	Cursor            string
+}
+
+type ListResult struct {
+	Payments []Payment
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+func (q ListQuery) matches(p Payment) bool {
+	switch {
+	case q.MerchantID != nil && p.MerchantID != *q.MerchantID:
+		return false
+	case q.Status != "" && p.Status != q.Status:
+		return false
+	case q.Currency != "" && p.Amount.Currency.Code != q.Currency:
+		return false
+	case !q.CreatedFrom.IsZero() && p.CreatedAt.Before(q.CreatedFrom):
+		return false
+	case !q.CreatedTo.IsZero() && !p.CreatedAt.Before(q.CreatedTo):
+		return false
+	case q.MinAmount != nil && p.Amount.ToFractional() < *q.MinAmount:
+		return false
+	case q.MaxAmount != nil && p.Amount.ToFractional() > *q.MaxAmount:
+		return false
+	case q.MerchantReference != "" && p.MerchantReference != q.MerchantReference:
+		return false
+	}
+
+	return true
+}
+
+// cursor points to the last payment of the previous page.
+// CreatedAt is encoded as Unix seconds and nanoseconds, since UnixNano
+// is undefined outside of the years 1678 to 2262 (including the zero time).
+type cursor struct {
+	createdAt time.Time
+	id        uuid.UUID
+}
+
+func (c cursor) String() string {
+	raw := fmt.Sprintf("%d.%09d:%s", c.createdAt.Unix(), c.createdAt.Nanosecond(), c.id)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	seconds, nanos, ok := strings.Cut(createdAt, ".")
+	if !ok || len(nanos) != 9 {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	sec, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	nsec, err := strconv.ParseUint(nanos, 10, 32)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	c := cursor{createdAt: time.Unix(sec, int64(nsec)).UTC()}
+	if c.id, err = uuid.Parse(id); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// before reports whether p goes before the cursor in the listing order.
+func (c cursor) before(p Payment) bool {
+	if !p.CreatedAt.Equal(c.createdAt) {
+		return p.CreatedAt.After(c.createdAt)
+	}
+
+	return p.ID.String() <= c.id.String()
+}
+
+// paginate sorts, applies the cursor and the limit.
+func paginate(payments []Payment, q ListQuery) (ListResult, error) {
+	sort.Slice(payments, func(a, b int) bool {
+		if !payments[a].CreatedAt.Equal(payments[b].CreatedAt) {
+			return payments[a].CreatedAt.After(payments[b].CreatedAt)
+		}
+
+		return payments[a].ID.String() < payments[b].ID.String()
+	})
+
+	if q.Cursor != "" {
+		c, err := parseCursor(q.Cursor)
+		if err != nil {
+			return ListResult{}, err
+		}
+
+		start := sort.Search(len(payments), func(i int) bool {
+			return !c.before(payments[i])
+		})
+		payments = payments[start:]
+	}
+
+	if q.Limit <= 0 || len(payments) <= q.Limit {
+		return ListResult{Payments: payments}, nil
+	}
+
+	page := payments[:q.Limit]
+	last := page[len(page)-1]
+
+	return ListResult{
+		Payments:   page,
+		NextCursor: cursor{createdAt: last.CreatedAt, id: last.ID}.String(),
+	}, nil
+}
+
+func (i *InMemoryPaymentRepository) List(_ context.Context, q ListQuery) (ListResult, error) {
+	i.locker.RLock()
+
+	matching := make([]Payment, 0)
+	for _, p := range i.payments {
+		if q.matches(p) {
+			matching = append(matching, p)
+		}
+	}
+
+	i.locker.RUnlock()
+
+	r, err := paginate(matching, q)
+	if err != nil {
+		return ListResult{}, fmt.Errorf("InMemoryPaymentRepository.List: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *EventSourcedPaymentRepository) List(ctx context.Context, q ListQuery) (ListResult, error) {
+	return r.projection.List(ctx, q)
+}
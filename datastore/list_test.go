@@ -0,0 +1,210 @@
+package datastore_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+)
+
+func TestInMemoryPaymentRepository_List(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := datastore.NewInMemoryPaymentRepository()
+
+	for i := 0; i < 25; i++ {
+		p := newPayment(i)
+		p.Amount = currency.NewAmountFromFractions(currency.AED, uint(100*(i+1)))
+		if i%5 == 0 {
+			p.Amount = currency.NewAmountFromFractions(currency.USD, 1000)
+		}
+
+		require.NoError(t, repo.Create(ctx, p))
+	}
+
+	t.Run("Pagination", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			seen   = make(map[string]struct{})
+			pages  int
+			cursor string
+			prev   *datastore.Payment
+		)
+
+		for {
+			r, err := repo.List(ctx, datastore.ListQuery{Currency: "AED", Limit: 7, Cursor: cursor})
+			require.NoError(t, err)
+			pages++
+
+			for _, p := range r.Payments {
+				assert.Equal(t, "AED", p.Amount.Currency.Code)
+				if prev != nil {
+					assert.False(t, p.CreatedAt.After(prev.CreatedAt), "unstable order")
+				}
+
+				seen[p.ID.String()] = struct{}{}
+				p := p
+				prev = &p
+			}
+
+			if r.NextCursor == "" {
+				break
+			}
+			cursor = r.NextCursor
+		}
+
+		assert.Equal(t, 3, pages)
+		assert.Len(t, seen, 20)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		t.Parallel()
+
+		minAmount, maxAmount := uint(200), uint(400)
+
+		r, err := repo.List(ctx, datastore.ListQuery{
+			Status:    datastore.PaymentInitiated,
+			Currency:  "AED",
+			MinAmount: &minAmount,
+			MaxAmount: &maxAmount,
+		})
+		require.NoError(t, err)
+		require.Len(t, r.Payments, 3)
+		assert.Empty(t, r.NextCursor)
+
+		r, err = repo.List(ctx, datastore.ListQuery{MerchantReference: "order-3"})
+		require.NoError(t, err)
+		require.Len(t, r.Payments, 1)
+
+		r, err = repo.List(ctx, datastore.ListQuery{Status: datastore.PaymentPaid})
+		require.NoError(t, err)
+		assert.Empty(t, r.Payments)
+	})
+
+	t.Run("Same creation time", func(t *testing.T) {
+		t.Parallel()
+
+		repo := datastore.NewInMemoryPaymentRepository()
+		createdAt := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+
+		for i := 0; i < 5; i++ {
+			p := newPayment(i)
+			p.CreatedAt = createdAt
+			require.NoError(t, repo.Create(ctx, p))
+		}
+
+		seen := make(map[string]struct{})
+		cursor := ""
+
+		for {
+			r, err := repo.List(ctx, datastore.ListQuery{Limit: 2, Cursor: cursor})
+			require.NoError(t, err)
+
+			for _, p := range r.Payments {
+				seen[p.ID.String()] = struct{}{}
+			}
+
+			if r.NextCursor == "" {
+				break
+			}
+			cursor = r.NextCursor
+		}
+
+		assert.Len(t, seen, 5)
+	})
+
+	t.Run("Extreme creation times", func(t *testing.T) {
+		t.Parallel()
+
+		repo := datastore.NewInMemoryPaymentRepository()
+		createdAt := []time.Time{
+			time.Date(1, 1, 1, 0, 0, 0, 1, time.UTC),
+			time.Date(1500, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 7, 1, 10, 0, 0, 999999999, time.UTC),
+			time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+
+		for i, at := range createdAt {
+			p := newPayment(i)
+			p.CreatedAt = at
+			require.NoError(t, repo.Create(ctx, p))
+		}
+
+		var (
+			listed []time.Time
+			cursor string
+		)
+
+		for {
+			r, err := repo.List(ctx, datastore.ListQuery{Limit: 1, Cursor: cursor})
+			require.NoError(t, err)
+
+			for _, p := range r.Payments {
+				listed = append(listed, p.CreatedAt)
+			}
+
+			if r.NextCursor == "" {
+				break
+			}
+			cursor = r.NextCursor
+		}
+
+		require.Len(t, listed, len(createdAt))
+		for i, at := range listed {
+			assert.True(t, createdAt[len(createdAt)-1-i].Equal(at), "got %s at %d", at, i)
+		}
+	})
+
+	t.Run("Merchants", func(t *testing.T) {
+		t.Parallel()
+
+		repo := datastore.NewInMemoryPaymentRepository()
+		owner, another := uuid.New(), uuid.New()
+
+		for i, merchantID := range []uuid.UUID{owner, another, owner} {
+			p := newPayment(i)
+			p.MerchantID = merchantID
+			p.MerchantReference = "order"
+			if i == 2 {
+				p.MerchantReference = "another-order"
+			}
+
+			require.NoError(t, repo.Create(ctx, p))
+		}
+
+		r, err := repo.List(ctx, datastore.ListQuery{MerchantID: &owner})
+		require.NoError(t, err)
+		require.Len(t, r.Payments, 2)
+
+		for _, p := range r.Payments {
+			assert.Equal(t, owner, p.MerchantID)
+		}
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := repo.List(ctx, datastore.ListQuery{Cursor: "invalid!"})
+		require.ErrorIs(t, err, datastore.ErrInvalidCursor)
+
+		for _, raw := range []string{
+			"invalid",
+			"1719828000000000000:6b77a7bc-0bee-49ab-bbb0-70d5245a20f7",
+			"1719828000.1:6b77a7bc-0bee-49ab-bbb0-70d5245a20f7",
+			"1719828000.+00000001:6b77a7bc-0bee-49ab-bbb0-70d5245a20f7",
+			"1719828000.000000000:invalid",
+		} {
+			cursor := base64.RawURLEncoding.EncodeToString([]byte(raw))
+			_, err := repo.List(ctx, datastore.ListQuery{Cursor: cursor})
+			require.ErrorIs(t, err, datastore.ErrInvalidCursor, raw)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// OutboxMessage is a domain event waiting for the delivery outside the service.
+// Seq is unique and increases monotonically, consumers can use it for deduplication.
+type OutboxMessage struct {
+	Seq   uint64 `json:"seq"`
+	Event Event  `json:"event"`
+}
+
+// outbox keeps the pending messages in order, it's not thread-safe,
+// the repository guards it by the same lock as the payments, so every change and its event are stored atomically.
+type outbox struct {
+	pending  []OutboxMessage
+	seq      uint64
+	versions map[uuid.UUID]uint64
+}
+
+func newOutbox() *outbox {
+	return &outbox{versions: make(map[uuid.UUID]uint64)}
+}
+
+// next assigns the sequence number and the version within the payment stream.
+func (o *outbox) next(e Event) OutboxMessage {
+	e.Version = o.versions[e.PaymentID] + 1
+
+	return OutboxMessage{Seq: o.seq + 1, Event: e}
+}
+
+// outboxCursor is stored in the snapshot, so sequence numbers and versions keep increasing after the acknowledged messages are compacted away.
+type outboxCursor struct {
+	Seq      uint64               `json:"seq"`
+	Versions map[uuid.UUID]uint64 `json:"versions"`
+}
+
+func (o *outbox) cursor() outboxCursor {
+	return outboxCursor{Seq: o.seq, Versions: o.versions}
+}
+
+func (o *outbox) restore(c outboxCursor) {
+	o.seq = max(o.seq, c.Seq)
+
+	for id, v := range c.Versions {
+		o.versions[id] = max(o.versions[id], v)
+	}
+}
+
+func (o *outbox) push(m OutboxMessage) {
+	o.pending = append(o.pending, m)
+	o.seq = max(o.seq, m.Seq)
+	o.versions[m.Event.PaymentID] = max(o.versions[m.Event.PaymentID], m.Event.Version)
+}
+
+func (o *outbox) ack(seqs []uint64) {
+	acked := make(map[uint64]struct{}, len(seqs))
+	for _, s := range seqs {
+		acked[s] = struct{}{}
+	}
+
+	pending := o.pending[:0]
+	for _, m := range o.pending {
+		if _, ok := acked[m.Seq]; !ok {
+			pending = append(pending, m)
+		}
+	}
+
+	o.pending = pending
+}
+
+// PendingEvents returns up to limit undelivered messages, ordered by Seq.
+func (i *InMemoryPaymentRepository) PendingEvents(_ context.Context, limit int) ([]OutboxMessage, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	limit = min(limit, len(i.outbox.pending))
+
+	return append([]OutboxMessage(nil), i.outbox.pending[:limit]...), nil
+}
+
+// AckEvents removes the delivered messages from the outbox.
+func (i *InMemoryPaymentRepository) AckEvents(_ context.Context, seqs ...uint64) error {
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	i.outbox.ack(seqs)
+
+	return nil
+}
+
+// outboxConsumer is the name of the checkpoint of [EventSourcedPaymentRepository] in the event store.
+const outboxConsumer = "outbox"
+
+// streamCursor exposes the events of all the streams as the outbox, there is no separate outbox, the event store is the one.
+// Messages can be acknowledged out of order, so the acknowledged messages after the checkpoint are remembered,
+// they are delivered again after the restart, it's fine for the at-least-once delivery.
+type streamCursor struct {
+	checkpoint uint64
+	acked      map[uint64]struct{}
+	locker     *sync.Mutex
+}
+
+// PendingEvents returns up to limit undelivered events, ordered by their position in the event store.
+func (r *EventSourcedPaymentRepository) PendingEvents(ctx context.Context, limit int) (_ []OutboxMessage, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.PendingEvents: %w", err)
+		}
+	}()
+
+	r.cursor.locker.Lock()
+	defer r.cursor.locker.Unlock()
+
+	var pending []OutboxMessage
+
+	for after := r.cursor.checkpoint; len(pending) < limit; {
+		messages, err := r.store.ReadAll(ctx, after, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(messages) == 0 {
+			break
+		}
+
+		for _, m := range messages {
+			if _, ok := r.cursor.acked[m.Seq]; !ok && len(pending) < limit {
+				pending = append(pending, m)
+			}
+		}
+
+		after = messages[len(messages)-1].Seq
+	}
+
+	return pending, nil
+}
+
+// AckEvents moves the checkpoint past the delivered events.
+func (r *EventSourcedPaymentRepository) AckEvents(ctx context.Context, seqs ...uint64) error {
+	r.cursor.locker.Lock()
+	defer r.cursor.locker.Unlock()
+
+	for _, seq := range seqs {
+		if seq > r.cursor.checkpoint {
+			r.cursor.acked[seq] = struct{}{}
+		}
+	}
+
+	checkpoint := r.cursor.checkpoint
+	for {
+		if _, ok := r.cursor.acked[checkpoint+1]; !ok {
+			break
+		}
+
+		delete(r.cursor.acked, checkpoint+1)
+		checkpoint++
+	}
+
+	if checkpoint == r.cursor.checkpoint {
+		return nil
+	}
+
+	// when the checkpoint could not be saved, the events are delivered again after the restart
+	r.cursor.checkpoint = checkpoint
+
+	if err := r.store.SaveCheckpoint(ctx, outboxConsumer, checkpoint); err != nil {
+		return fmt.Errorf("EventSourcedPaymentRepository.AckEvents: %w", err)
+	}
+
+	return nil
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"payments/currency"
+	"payments/lock"
 )
 
 type PaymentStatus string
@@ -19,71 +21,141 @@ const (
 	PaymentExpired   = "expired"
 	PaymentPaid      = "paid"
 	PaymentRefunded  = "refunded"
+	// PaymentPartiallyRefunded means that only a part of the amount is refunded, see [Payment.Refunds]
+	PaymentPartiallyRefunded = "partially_refunded"
+	// PaymentRefundPending means that at least one refund is in progress
+	PaymentRefundPending = "refund_pending"
+	// PaymentAuthorized means that the amount is reserved, but it must be captured, see [Payment.Captured]
+	PaymentAuthorized = "authorized"
+	// PaymentVoided means that the authorization is released
+	PaymentVoided = "voided"
+	// PaymentCancelled means that the client abandoned the initiated payment
+	PaymentCancelled = "cancelled"
+	// PaymentReview means that the payment waits for the manual approval before it's sent to the gateway
+	PaymentReview = "review"
+	// PaymentRejected means that the payment held for the review was not approved
+	PaymentRejected = "rejected"
+)
+
+// Errors returned (wrapped) by all the repositories.
+var (
+	ErrNotFound     = errors.New("payment does not exist")
+	ErrDuplicate    = errors.New("payment already exists")
+	ErrInvalidState = errors.New("invalid payment state")
 )
 
 type Payment struct {
-	ID         uuid.UUID
+	ID uuid.UUID
+	// MerchantID is the owner of the payment, merchants cannot see payments of each other
+	MerchantID uuid.UUID
 	ExternalID string
 	Status     PaymentStatus
 	Amount     currency.Amount
+	// MerchantReference is an optional, unique identifier provided by the merchant (e.g. order number).
+	MerchantReference string
+	// CustomerID is an optional identifier of the customer provided by the merchant, it's used by velocity limits.
+	CustomerID string
+	// ManualCapture and Context are provided by the merchant, they are kept for payments sent to the gateway after the review
+	ManualCapture bool
+	Context       map[string]any
+	// RiskReasons explain why the payment is held for the review
+	RiskReasons []string
+	// CreatedAt and UpdatedAt are maintained by the repository.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Refunds   []Refund
+	// Captured is set when the authorized payment is captured, it can be lower than Amount
+	Captured *currency.Amount
+	// Fee is charged by the gateway, it's nil for payments initiated before we introduced fees
+	Fee *currency.Amount
+}
+
+// referenceKey identifies the payment by the merchant reference, every merchant has its own references.
+type referenceKey struct {
+	merchantID uuid.UUID
+	reference  string
+}
+
+func (p Payment) referenceKey() referenceKey {
+	return referenceKey{merchantID: p.MerchantID, reference: p.MerchantReference}
+}
+
+// CapturedAmount returns the amount charged from the customer, it's the whole amount unless the payment was captured partially.
+func (p Payment) CapturedAmount() currency.Amount {
+	if p.Captured != nil {
+		return *p.Captured
+	}
+
+	return p.Amount
 }
 
 // InMemoryPaymentRepository stores all the payments in the memory.
 // In real life we should persist all the payments in the DB.
+//
+// Secondary indexes (external ID, merchant reference) are kept in sync with the payments
+// under the same lock, so all the lookups are constant-time.
 type InMemoryPaymentRepository struct {
-	payments map[uuid.UUID]Payment
-	locker   *sync.RWMutex
+	payments     map[uuid.UUID]Payment
+	byExternalID map[string]uuid.UUID
+	byReference  map[referenceKey]uuid.UUID
+	// byRefundExternalID points to the payment, see [InMemoryPaymentRepository.UpdateRefundByExternalID]
+	byRefundExternalID map[string]uuid.UUID
+	// unsubmittedRefunds points from the refund to the payment, see [InMemoryPaymentRepository.DueRefunds]
+	unsubmittedRefunds map[uuid.UUID]uuid.UUID
+	locker             *sync.RWMutex
+	// outbox stores the domain events atomically with the changes, see [InMemoryPaymentRepository.PendingEvents]
+	outbox *outbox
+	// journal is called under the write lock before any change is applied,
+	// the change is rejected when it returns an error, see [FilePaymentRepository].
+	journal func(Payment, OutboxMessage) error
+	// fence rejects the writes done under the lost lease, see [lock.NewContext]
+	fence *lock.Fence
 }
 
 func NewInMemoryPaymentRepository() *InMemoryPaymentRepository {
 	return &InMemoryPaymentRepository{
-		payments: make(map[uuid.UUID]Payment),
-		locker:   &sync.RWMutex{}, // RWMutex is not really required, just for the exercise it's being used to show the possible edge cases
+		payments:           make(map[uuid.UUID]Payment),
+		byExternalID:       make(map[string]uuid.UUID),
+		byReference:        make(map[referenceKey]uuid.UUID),
+		byRefundExternalID: make(map[string]uuid.UUID),
+		unsubmittedRefunds: make(map[uuid.UUID]uuid.UUID),
+		outbox:             newOutbox(),
+		fence:              lock.NewFence(),
+		locker:             &sync.RWMutex{}, // RWMutex is not really required, just for the exercise it's being used to show the possible edge cases
 	}
 }
 
-func (i *InMemoryPaymentRepository) Create(_ context.Context, p Payment) (err error) {
+func (i *InMemoryPaymentRepository) Create(ctx context.Context, p Payment) (err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("InMemoryPaymentRepository.UpdateInitiatedByExternalID(%+q): %w", p.ID, err)
+			err = fmt.Errorf("InMemoryPaymentRepository.Create(%+q): %w", p.ID, err)
 		}
 	}()
 
-	err = func() error {
-		i.locker.RLock()
-		defer i.locker.RUnlock()
-
-		if _, ok := i.payments[p.ID]; ok {
-			return errors.New("payment already exists")
-		}
+	// the check and the insert must be performed under the same write lock,
+	// otherwise two concurrent requests could create the same payment
+	i.locker.Lock()
+	defer i.locker.Unlock()
 
-		for _, x := range i.payments {
-			if x.ID == p.ID || x.ExternalID == p.ExternalID {
-				return errors.New("payment already exists")
-			}
-		}
+	if err := i.validateNew(p); err != nil {
+		return err
+	}
 
-		return nil
-	}()
+	err = i.commit(ctx, p, p.creationEvent())
 	if err != nil {
 		return err
 	}
 
-	func() {
-		i.locker.Lock()
-		defer i.locker.Unlock()
-
-		i.payments[p.ID] = p
-
-		// TODO in real life the logger would be injected, and most likely would not be used in the repository.
-		// since it's for mocking purposes only, I'm logging the value here
-		log.Default().Println(fmt.Sprintf("Created payment %+q for amount %s, external_id=%+q", p.ID, p.Amount, p.ExternalID))
-	}()
+	// TODO in real life the logger would be injected, and most likely would not be used in the repository.
+	// since it's for mocking purposes only, I'm logging the value here
+	log.Default().Println(fmt.Sprintf("Created payment %+q for amount %s, external_id=%+q", p.ID, p.Amount, p.ExternalID))
 
 	return nil
 }
 
-func (i *InMemoryPaymentRepository) UpdateInitiatedByExternalID(_ context.Context, extID string, status PaymentStatus) (err error) {
+// UpdateInitiatedByExternalID applies the status reported by the gateway,
+// cancelled payments reported as paid are refunded automatically, see [EventPaymentPaidAfterCancel].
+func (i *InMemoryPaymentRepository) UpdateInitiatedByExternalID(ctx context.Context, extID string, status PaymentStatus) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("InMemoryPaymentRepository.UpdateInitiatedByExternalID(%+q): %w", extID, err)
@@ -93,61 +165,129 @@ func (i *InMemoryPaymentRepository) UpdateInitiatedByExternalID(_ context.Contex
 	i.locker.Lock()
 	defer i.locker.Unlock()
 
-	for _, x := range i.payments {
-		if x.ExternalID != extID {
-			continue
-		}
+	id, ok := i.byExternalID[extID]
+	if !ok {
+		return ErrNotFound
+	}
 
-		if x.Status != PaymentInitiated {
-			return fmt.Errorf("payment has status %+q", x.Status)
-		}
+	e, err := i.payments[id].statusUpdateEvent(status)
+	if err != nil {
+		return err
+	}
 
-		x.Status = status
+	return i.apply(ctx, i.payments[id], e)
+}
 
-		i.payments[x.ID] = x
+func (i *InMemoryPaymentRepository) GetByID(_ context.Context, id uuid.UUID) (Payment, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
 
-		return nil
+	p, ok := i.payments[id]
+	if !ok {
+		return Payment{}, fmt.Errorf("InMemoryPaymentRepository.GetByID(%+q): %w", id, ErrNotFound)
 	}
 
-	return fmt.Errorf("payment does not exist")
+	return p, nil
 }
 
-func (i *InMemoryPaymentRepository) GetByID(_ context.Context, id uuid.UUID) (Payment, error) {
-	var err error
+// GetByMerchantReference returns the payment of the given merchant, references are unique per merchant.
+func (i *InMemoryPaymentRepository) GetByMerchantReference(_ context.Context, merchantID uuid.UUID, reference string) (Payment, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
 
-	p, ok := i.payments[id]
+	id, ok := i.byReference[referenceKey{merchantID: merchantID, reference: reference}]
 	if !ok {
-		err = fmt.Errorf("payment %+q does not exist", p.ID.String())
+		return Payment{}, fmt.Errorf("InMemoryPaymentRepository.GetByMerchantReference(%+q, %+q): %w", merchantID, reference, ErrNotFound)
 	}
 
-	return p, err
+	return i.payments[id], nil
 }
 
-func (i *InMemoryPaymentRepository) RefundByID(_ context.Context, paymentID uuid.UUID) (err error) {
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("InMemoryPaymentRepository.RefundByID(%+q): %w", paymentID, err)
-		}
-	}()
+func (i *InMemoryPaymentRepository) GetByExternalID(_ context.Context, extID string) (Payment, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
 
-	i.locker.Lock()
-	defer i.locker.Unlock()
+	id, ok := i.byExternalID[extID]
+	if !ok {
+		return Payment{}, fmt.Errorf("InMemoryPaymentRepository.GetByExternalID(%+q): %w", extID, ErrNotFound)
+	}
 
-	for _, x := range i.payments {
-		if x.ID != paymentID {
-			continue
-		}
+	return i.payments[id], nil
+}
+
+// validateNew checks whether the given payment can be created, the caller must hold the lock.
+func (i *InMemoryPaymentRepository) validateNew(p Payment) error {
+	if _, ok := i.payments[p.ID]; ok {
+		return ErrDuplicate
+	}
+
+	if _, ok := i.byExternalID[p.ExternalID]; ok && p.ExternalID != "" {
+		return fmt.Errorf("%w: the same external ID", ErrDuplicate)
+	}
+
+	if _, ok := i.byReference[p.referenceKey()]; ok && p.MerchantReference != "" {
+		return fmt.Errorf("%w: the same merchant reference", ErrDuplicate)
+	}
+
+	return nil
+}
 
-		if x.Status != PaymentPaid {
-			return fmt.Errorf("payment has status %+q", x.Status)
+// commit journals and stores the given payment together with the event, the caller must hold the write lock.
+func (i *InMemoryPaymentRepository) commit(ctx context.Context, p Payment, e Event) error {
+	// the write done under the lease that has been taken over must not overwrite the changes of the new holder
+	if err := i.fence.Admit(ctx); err != nil {
+		return err
+	}
+
+	e.PaymentID = p.ID
+	e.MerchantID = p.MerchantID
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now().UTC()
+	}
+
+	if _, exists := i.payments[p.ID]; !exists && !p.CreatedAt.IsZero() {
+		// the creation time provided by the caller is respected
+		e.OccurredAt = p.CreatedAt
+	}
+
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = e.OccurredAt
+	}
+	p.UpdatedAt = e.OccurredAt
+
+	m := i.outbox.next(e)
+
+	if i.journal != nil {
+		if err := i.journal(p, m); err != nil {
+			return fmt.Errorf("could not journal the change: %w", err)
 		}
+	}
 
-		x.Status = PaymentRefunded
+	i.restore(p)
+	i.outbox.push(m)
 
-		i.payments[x.ID] = x
+	return nil
+}
 
-		return nil
+// restore stores the given payment and updates the indexes, the caller must hold the write lock.
+func (i *InMemoryPaymentRepository) restore(p Payment) {
+	i.payments[p.ID] = p
+	if p.ExternalID != "" {
+		// payments held for the review are not sent to the gateway yet
+		i.byExternalID[p.ExternalID] = p.ID
 	}
+	if p.MerchantReference != "" {
+		i.byReference[p.referenceKey()] = p.ID
+	}
+	for _, r := range p.Refunds {
+		if r.ExternalID != "" {
+			i.byRefundExternalID[r.ExternalID] = p.ID
+		}
 
-	return fmt.Errorf("payment does not exist")
+		if r.submitted() {
+			delete(i.unsubmittedRefunds, r.ID)
+		} else {
+			i.unsubmittedRefunds[r.ID] = p.ID
+		}
+	}
 }
@@ -0,0 +1,514 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+	"payments/lock"
+)
+
+// EventSourcedPaymentRepository stores every payment as a stream of domain events.
+//
+// The event store is the source of truth, the current state of payments is kept in the in-memory projection
+// that answers all the queries and is rebuilt from the store (snapshots + remaining events) on start-up.
+// The event store is the outbox as well, see [EventSourcedPaymentRepository.PendingEvents].
+type EventSourcedPaymentRepository struct {
+	store EventStore
+	// projection is the read model, it's also used for the uniqueness checks and the lookups by external ID
+	projection *InMemoryPaymentRepository
+	// snapshotEvery defines how often (number of events) we store the snapshot, zero disables snapshots
+	snapshotEvery uint64
+	// writes are serialized, the event store protects us against concurrent writers from other instances
+	writeLock *sync.Mutex
+	// fence rejects the writes done under the lost lease, it protects the writes of this instance only
+	fence  *lock.Fence
+	cursor *streamCursor
+	now    func() time.Time
+}
+
+func NewEventSourcedPaymentRepository(
+	ctx context.Context,
+	store EventStore,
+	snapshotEvery uint64,
+) (_ *EventSourcedPaymentRepository, err error) {
+	r := &EventSourcedPaymentRepository{
+		store:         store,
+		projection:    NewInMemoryPaymentRepository(),
+		snapshotEvery: snapshotEvery,
+		writeLock:     &sync.Mutex{},
+		fence:         lock.NewFence(),
+		cursor:        &streamCursor{acked: make(map[uint64]struct{}), locker: &sync.Mutex{}},
+		now:           time.Now,
+	}
+
+	if r.cursor.checkpoint, err = store.LoadCheckpoint(ctx, outboxConsumer); err != nil {
+		return nil, fmt.Errorf("NewEventSourcedPaymentRepository: %w", err)
+	}
+
+	ids, err := store.Streams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("NewEventSourcedPaymentRepository: %w", err)
+	}
+
+	for _, id := range ids {
+		p, _, err := r.load(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("NewEventSourcedPaymentRepository: %w", err)
+		}
+
+		r.project(p)
+	}
+
+	return r, nil
+}
+
+func (r *EventSourcedPaymentRepository) Create(ctx context.Context, p Payment) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.Create(%+q): %w", p.ID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	if err := r.validateNew(p); err != nil {
+		return err
+	}
+
+	e := p.creationEvent()
+	e.PaymentID = p.ID
+	e.OccurredAt = p.CreatedAt // the creation time provided by the caller is respected
+
+	p, err = r.append(ctx, Payment{}, 0, e)
+	if err != nil {
+		return err
+	}
+
+	log.Default().Println(fmt.Sprintf("Created payment %+q for amount %s, external_id=%+q", p.ID, p.Amount, p.ExternalID))
+
+	return nil
+}
+
+func (r *EventSourcedPaymentRepository) UpdateInitiatedByExternalID(ctx context.Context, extID string, status PaymentStatus) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.UpdateInitiatedByExternalID(%+q): %w", extID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	id, err := r.idByExternalID(extID)
+	if err != nil {
+		return err
+	}
+
+	p, version, err := r.load(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	e, err := p.statusUpdateEvent(status)
+	if err != nil {
+		return err
+	}
+
+	e.PaymentID = id
+	_, err = r.append(ctx, p, version, e)
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) CreateRefund(ctx context.Context, paymentID uuid.UUID, refund Refund) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.CreateRefund(%+q, %+q): %w", paymentID, refund.ID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.validateRefund(refund); err != nil {
+		return err
+	}
+
+	amount := refund.Amount
+
+	_, err = r.append(ctx, p, version, Event{
+		PaymentID: paymentID,
+		Type:      EventRefundRequested,
+		RefundID:  &refund.ID,
+		Amount:    &amount,
+	})
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) UpdateRefund(ctx context.Context, paymentID uuid.UUID, refundID uuid.UUID, u RefundUpdate) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.UpdateRefund(%+q, %+q): %w", paymentID, refundID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	return r.updateRefund(ctx, paymentID, refundID, u)
+}
+
+func (r *EventSourcedPaymentRepository) UpdateRefundByExternalID(ctx context.Context, extID string, status RefundStatus) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.UpdateRefundByExternalID(%+q): %w", extID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	r.projection.locker.RLock()
+	paymentID, ok := r.projection.byRefundExternalID[extID]
+	p := r.projection.payments[paymentID]
+	r.projection.locker.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: refund", ErrNotFound)
+	}
+
+	refund, ok := p.refundByExternalID(extID)
+	if !ok {
+		return fmt.Errorf("%w: refund", ErrNotFound)
+	}
+
+	return r.updateRefund(ctx, paymentID, refund.ID, RefundUpdate{Status: status})
+}
+
+// updateRefund must be called under the write lock.
+func (r *EventSourcedPaymentRepository) updateRefund(ctx context.Context, paymentID uuid.UUID, refundID uuid.UUID, u RefundUpdate) error {
+	eventType, err := eventTypeForRefundStatus(u.Status)
+	if err != nil {
+		return err
+	}
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	changed, err := p.validateRefundUpdate(refundID, u)
+	if err != nil || !changed {
+		return err
+	}
+
+	_, err = r.append(ctx, p, version, Event{
+		PaymentID:  paymentID,
+		Type:       eventType,
+		RefundID:   &refundID,
+		ExternalID: u.ExternalID,
+		Reason:     u.Reason,
+		Fee:        u.Fee,
+	})
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) ScheduleRefundRetry(
+	ctx context.Context,
+	paymentID uuid.UUID,
+	refundID uuid.UUID,
+	reason string,
+	retryAt time.Time,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.ScheduleRefundRetry(%+q, %+q): %w", paymentID, refundID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.validateRefundRetry(refundID); err != nil {
+		return err
+	}
+
+	_, err = r.append(ctx, p, version, Event{
+		PaymentID: paymentID,
+		Type:      EventRefundRetryScheduled,
+		RefundID:  &refundID,
+		Reason:    reason,
+		RetryAt:   &retryAt,
+	})
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) DueRefunds(ctx context.Context, now time.Time, limit int) ([]PendingRefund, error) {
+	return r.projection.DueRefunds(ctx, now, limit)
+}
+
+func (r *EventSourcedPaymentRepository) CaptureByID(ctx context.Context, paymentID uuid.UUID, amount currency.Amount) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.CaptureByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.validateCapture(amount); err != nil {
+		return err
+	}
+
+	_, err = r.append(ctx, p, version, Event{PaymentID: paymentID, Type: EventPaymentCaptured, Amount: &amount})
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) VoidByID(ctx context.Context, paymentID uuid.UUID) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.VoidByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.validateVoid(); err != nil {
+		return err
+	}
+
+	_, err = r.append(ctx, p, version, Event{PaymentID: paymentID, Type: EventPaymentVoided})
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) CancelByID(ctx context.Context, paymentID uuid.UUID) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.CancelByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.validateCancel(); err != nil {
+		return err
+	}
+
+	_, err = r.append(ctx, p, version, Event{PaymentID: paymentID, Type: EventPaymentCancelled})
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) ApproveReviewByID(ctx context.Context, paymentID uuid.UUID, externalID string, fee *currency.Amount) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.ApproveReviewByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.validateReviewDecision(); err != nil {
+		return err
+	}
+
+	if _, err := r.idByExternalID(externalID); err == nil {
+		return fmt.Errorf("%w: the same external ID", ErrDuplicate)
+	}
+
+	e := approvalEvent(externalID, fee)
+	e.PaymentID = paymentID
+	_, err = r.append(ctx, p, version, e)
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) RejectReviewByID(ctx context.Context, paymentID uuid.UUID) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("EventSourcedPaymentRepository.RejectReviewByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	p, version, err := r.loadExisting(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.validateReviewDecision(); err != nil {
+		return err
+	}
+
+	_, err = r.append(ctx, p, version, Event{PaymentID: paymentID, Type: EventPaymentRejected})
+
+	return err
+}
+
+func (r *EventSourcedPaymentRepository) GetByID(ctx context.Context, id uuid.UUID) (Payment, error) {
+	return r.projection.GetByID(ctx, id)
+}
+
+func (r *EventSourcedPaymentRepository) GetByMerchantReference(ctx context.Context, merchantID uuid.UUID, reference string) (Payment, error) {
+	return r.projection.GetByMerchantReference(ctx, merchantID, reference)
+}
+
+func (r *EventSourcedPaymentRepository) GetByExternalID(ctx context.Context, extID string) (Payment, error) {
+	return r.projection.GetByExternalID(ctx, extID)
+}
+
+// History returns all the events of the given payment, e.g. for the audit.
+func (r *EventSourcedPaymentRepository) History(ctx context.Context, id uuid.UUID) ([]Event, error) {
+	events, err := r.store.Load(ctx, id, 0)
+	if err != nil {
+		return nil, fmt.Errorf("EventSourcedPaymentRepository.History(%+q): %w", id, err)
+	}
+
+	return events, nil
+}
+
+// load returns the current state of the payment using the latest snapshot and the events stored after it.
+func (r *EventSourcedPaymentRepository) load(ctx context.Context, id uuid.UUID) (Payment, uint64, error) {
+	snapshot, _, err := r.store.LoadSnapshot(ctx, id)
+	if err != nil {
+		return Payment{}, 0, fmt.Errorf("could not load snapshot: %w", err)
+	}
+
+	events, err := r.store.Load(ctx, id, snapshot.Version)
+	if err != nil {
+		return Payment{}, 0, fmt.Errorf("could not load events: %w", err)
+	}
+
+	p, version := snapshot.Payment, snapshot.Version
+
+	for _, e := range events {
+		if p, err = e.Apply(p); err != nil {
+			return Payment{}, 0, fmt.Errorf("could not apply event %d: %w", e.Version, err)
+		}
+
+		version = e.Version
+	}
+
+	return p, version, nil
+}
+
+// loadExisting returns [ErrNotFound] when the stream is empty.
+func (r *EventSourcedPaymentRepository) loadExisting(ctx context.Context, id uuid.UUID) (Payment, uint64, error) {
+	p, version, err := r.load(ctx, id)
+	if err != nil {
+		return Payment{}, 0, err
+	}
+
+	if version == 0 {
+		return Payment{}, 0, ErrNotFound
+	}
+
+	return p, version, nil
+}
+
+// append stores the event, updates the projection and takes the snapshot if needed.
+func (r *EventSourcedPaymentRepository) append(ctx context.Context, p Payment, version uint64, e Event) (Payment, error) {
+	if err := r.fence.Admit(ctx); err != nil {
+		return Payment{}, err
+	}
+
+	e.Version = version + 1
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = r.now().UTC()
+	}
+
+	p, err := e.Apply(p)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	e.MerchantID = p.MerchantID
+
+	if err := r.store.Append(ctx, e.PaymentID, version, e); err != nil {
+		return Payment{}, err
+	}
+
+	r.project(p)
+
+	if r.snapshotEvery > 0 && e.Version%r.snapshotEvery == 0 {
+		// the events are already stored, the snapshot is an optimization only
+		if err := r.store.SaveSnapshot(ctx, Snapshot{Payment: p, Version: e.Version}); err != nil {
+			log.Default().Println(fmt.Sprintf("could not save snapshot of %+q: %s", p.ID, err))
+		}
+	}
+
+	return p, nil
+}
+
+func (r *EventSourcedPaymentRepository) validateNew(p Payment) error {
+	r.projection.locker.RLock()
+	defer r.projection.locker.RUnlock()
+
+	return r.projection.validateNew(p)
+}
+
+func (r *EventSourcedPaymentRepository) idByExternalID(extID string) (uuid.UUID, error) {
+	r.projection.locker.RLock()
+	defer r.projection.locker.RUnlock()
+
+	id, ok := r.projection.byExternalID[extID]
+	if !ok {
+		return uuid.UUID{}, ErrNotFound
+	}
+
+	return id, nil
+}
+
+func (r *EventSourcedPaymentRepository) project(p Payment) {
+	r.projection.locker.Lock()
+	defer r.projection.locker.Unlock()
+
+	r.projection.restore(p)
+}
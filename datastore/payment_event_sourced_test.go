@@ -0,0 +1,188 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+)
+
+// the event-sourced repository must be usable by the outbox relay, the same as the in-memory one
+var _ interface {
+	PendingEvents(ctx context.Context, limit int) ([]datastore.OutboxMessage, error)
+	AckEvents(ctx context.Context, seqs ...uint64) error
+} = (*datastore.EventSourcedPaymentRepository)(nil)
+
+func TestEventSourcedPaymentRepository(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("History", func(t *testing.T) {
+		t.Parallel()
+
+		repo, err := datastore.NewEventSourcedPaymentRepository(ctx, datastore.NewInMemoryEventStore(), 0)
+		require.NoError(t, err)
+
+		paymentFee, refundFee := currency.MustNewAmount(currency.AED, 2, 0), currency.MustNewAmount(currency.AED, 1, 0)
+
+		p := newPayment(1)
+		p.MerchantID = uuid.New()
+		p.Fee = &paymentFee
+		require.NoError(t, repo.Create(ctx, p))
+		refund := datastore.Refund{ID: uuid.New(), Amount: p.Amount}
+
+		require.ErrorIs(t, repo.CreateRefund(ctx, p.ID, refund), datastore.ErrInvalidState)
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+		require.NoError(t, repo.CreateRefund(ctx, p.ID, refund))
+		require.NoError(t, repo.UpdateRefund(ctx, p.ID, refund.ID, datastore.RefundUpdate{Status: datastore.RefundSucceeded, ExternalID: "refund-1", Fee: &refundFee}))
+		require.ErrorIs(t, repo.CreateRefund(ctx, uuid.New(), refund), datastore.ErrNotFound)
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefunded), got.Status)
+		assert.Equal(t, p.MerchantID, got.MerchantID)
+		assert.Equal(t, &paymentFee, got.Fee)
+		assert.Equal(t, &refundFee, got.Refunds[0].Fee)
+
+		events, err := repo.History(ctx, p.ID)
+		require.NoError(t, err)
+
+		types := make([]datastore.EventType, 0, len(events))
+		for _, e := range events {
+			types = append(types, e.Type)
+			assert.Equal(t, p.MerchantID, e.MerchantID)
+		}
+
+		assert.Equal(
+			t,
+			[]datastore.EventType{
+				datastore.EventPaymentInitiated,
+				datastore.EventPaymentPaid,
+				datastore.EventRefundRequested,
+				datastore.EventRefundSucceeded,
+			},
+			types,
+		)
+	})
+
+	t.Run("Replay from file with snapshots", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		store, err := datastore.NewFileEventStore(dir)
+		require.NoError(t, err)
+
+		repo, err := datastore.NewEventSourcedPaymentRepository(ctx, store, 2)
+		require.NoError(t, err)
+
+		paid, initiated := newPayment(1), newPayment(2)
+		require.NoError(t, repo.Create(ctx, paid))
+		require.NoError(t, repo.Create(ctx, initiated))
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, paid.ExternalID, datastore.PaymentPaid))
+		require.NoError(t, store.Close())
+
+		store, err = datastore.NewFileEventStore(dir)
+		require.NoError(t, err)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		snapshot, ok, err := store.LoadSnapshot(ctx, paid.ID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, uint64(2), snapshot.Version)
+
+		repo, err = datastore.NewEventSourcedPaymentRepository(ctx, store, 2)
+		require.NoError(t, err)
+
+		got, err := repo.GetByID(ctx, paid.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), got.Status)
+
+		got, err = repo.GetByMerchantReference(ctx, initiated.MerchantID, initiated.MerchantReference)
+		require.NoError(t, err)
+		assertSamePayment(t, initiated, got)
+
+		require.Error(t, repo.Create(ctx, initiated))
+		require.NoError(t, repo.CreateRefund(ctx, paid.ID, datastore.Refund{ID: uuid.New(), Amount: paid.Amount}))
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		store, err := datastore.NewFileEventStore(dir)
+		require.NoError(t, err)
+
+		repo, err := datastore.NewEventSourcedPaymentRepository(ctx, store, 0)
+		require.NoError(t, err)
+
+		a, b := newPayment(1), newPayment(2)
+		require.NoError(t, repo.Create(ctx, a))
+		require.NoError(t, repo.Create(ctx, b))
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, a.ExternalID, datastore.PaymentPaid))
+
+		pending, err := repo.PendingEvents(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 3)
+		assert.Equal(t, []uint64{1, 2, 3}, []uint64{pending[0].Seq, pending[1].Seq, pending[2].Seq})
+		assert.Equal(t, datastore.EventPaymentPaid, pending[2].Event.Type)
+		assert.Equal(t, uint64(2), pending[2].Event.Version)
+
+		// acknowledged out of order, e.g. the publisher of the first payment failed
+		require.NoError(t, repo.AckEvents(ctx, 2))
+
+		pending, err = repo.PendingEvents(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, uint64(1), pending[0].Seq)
+
+		pending, err = repo.PendingEvents(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 2)
+		assert.Equal(t, uint64(3), pending[1].Seq)
+
+		require.NoError(t, repo.AckEvents(ctx, 1))
+		require.NoError(t, store.Close())
+
+		// the checkpoint survives the restart
+		store, err = datastore.NewFileEventStore(dir)
+		require.NoError(t, err)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		repo, err = datastore.NewEventSourcedPaymentRepository(ctx, store, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, b.ExternalID, datastore.PaymentFailed))
+
+		pending, err = repo.PendingEvents(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 2)
+		assert.Equal(t, uint64(3), pending[0].Seq)
+		assert.Equal(t, uint64(4), pending[1].Seq)
+		assert.Equal(t, b.ID, pending[1].Event.PaymentID)
+	})
+
+	t.Run("Optimistic concurrency", func(t *testing.T) {
+		t.Parallel()
+
+		store := datastore.NewInMemoryEventStore()
+		id := uuid.New()
+
+		require.NoError(t, store.Append(ctx, id, 0, datastore.Event{PaymentID: id, Version: 1}))
+		require.ErrorIs(
+			t,
+			store.Append(ctx, id, 0, datastore.Event{PaymentID: id, Version: 1}),
+			datastore.ErrConcurrentModification,
+		)
+	})
+}
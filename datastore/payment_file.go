@@ -0,0 +1,495 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	walFileName      = "payments.wal"
+	snapshotFileName = "payments.snapshot"
+)
+
+var (
+	// ErrCorruptedWAL is returned when the record in the middle of the file does not match its checksum.
+	ErrCorruptedWAL = errors.New("corrupted write-ahead log")
+	// ErrReadOnly is returned when the repository opened with [FileOptions.ReadOnly] is changed.
+	ErrReadOnly = errors.New("read-only repository")
+)
+
+type SyncPolicy int
+
+const (
+	// SyncAlways calls fsync after every record, it's the slowest and the safest option.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval calls fsync periodically, we can lose the changes from the last interval.
+	SyncInterval
+	// SyncNever leaves flushing to the OS.
+	SyncNever
+)
+
+type FileOptions struct {
+	Dir          string
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	// CompactAfter defines the number of records in the log that triggers snapshotting,
+	// zero disables the automatic compaction.
+	CompactAfter int
+	// ReadOnly opens the files of the running instance (e.g. for reconciliation), nothing is written to them.
+	// The record being appended by the instance is skipped, the replay is repeated when the instance compacts the log meanwhile.
+	ReadOnly bool
+}
+
+type walRecord struct {
+	Seq     uint64         `json:"seq"`
+	Payment Payment        `json:"payment"`
+	Message *OutboxMessage `json:"message,omitempty"`
+	// Outbox is stored in the header of the snapshot only
+	Outbox *outboxCursor `json:"outbox,omitempty"`
+}
+
+// FilePaymentRepository is an [InMemoryPaymentRepository] that survives restarts.
+// Every change is appended to the write-ahead log before it's applied,
+// on start-up we load the latest snapshot and replay the log on top of it.
+//
+// It's designed for local development and small deployments, use a proper DB otherwise.
+type FilePaymentRepository struct {
+	*InMemoryPaymentRepository
+
+	options FileOptions
+	wal     *os.File
+	seq     uint64
+	records int
+	walLock *sync.Mutex
+	done    chan struct{}
+	closed  sync.Once
+}
+
+func NewFilePaymentRepository(o FileOptions) (_ *FilePaymentRepository, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("NewFilePaymentRepository(%+q): %w", o.Dir, err)
+		}
+	}()
+
+	if o.SyncInterval <= 0 {
+		o.SyncInterval = time.Second
+	}
+
+	if o.ReadOnly {
+		return openReadOnly(o)
+	}
+
+	if err := os.MkdirAll(o.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	f := newFilePaymentRepository(o)
+
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+
+	f.wal, err = os.OpenFile(f.path(walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	f.journal = f.append
+
+	if o.Sync == SyncInterval {
+		go f.syncPeriodically()
+	}
+
+	return f, nil
+}
+
+func newFilePaymentRepository(o FileOptions) *FilePaymentRepository {
+	return &FilePaymentRepository{
+		InMemoryPaymentRepository: NewInMemoryPaymentRepository(),
+		options:                   o,
+		walLock:                   &sync.Mutex{},
+		done:                      make(chan struct{}),
+	}
+}
+
+// openReadOnly replays the files without opening the log for writing.
+func openReadOnly(o FileOptions) (*FilePaymentRepository, error) {
+	// a missing directory is most likely a typo, an empty repository would be misleading
+	if _, err := os.Stat(o.Dir); err != nil {
+		return nil, err
+	}
+
+	for range 3 {
+		f := newFilePaymentRepository(o)
+		before := statFile(f.path(snapshotFileName))
+
+		if err := f.replay(); err != nil {
+			return nil, err
+		}
+
+		// the snapshot is replaced before the log is truncated, so the unchanged snapshot means that we haven't missed any record
+		if sameFile(before, statFile(f.path(snapshotFileName))) {
+			f.journal = func(Payment, OutboxMessage) error {
+				return ErrReadOnly
+			}
+
+			return f, nil
+		}
+	}
+
+	return nil, errors.New("the log is compacted too often to be replayed")
+}
+
+// Compact writes all the payments to the snapshot and truncates the log.
+func (f *FilePaymentRepository) Compact() error {
+	if f.options.ReadOnly {
+		return ErrReadOnly
+	}
+
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	return f.compact()
+}
+
+func (f *FilePaymentRepository) Close() (err error) {
+	f.closed.Do(func() {
+		close(f.done)
+
+		f.walLock.Lock()
+		defer f.walLock.Unlock()
+
+		if f.wal == nil {
+			return
+		}
+
+		err = errors.Join(f.wal.Sync(), f.wal.Close())
+	})
+
+	return err
+}
+
+func (f *FilePaymentRepository) path(name string) string {
+	return filepath.Join(f.options.Dir, name)
+}
+
+// append is used as the journal of the embedded repository, so it's called under its write lock.
+//
+// Acknowledgements of the outbox messages are not logged, so pending messages might be delivered again after the restart,
+// it's fine for the at-least-once delivery.
+func (f *FilePaymentRepository) append(p Payment, m OutboxMessage) error {
+	f.walLock.Lock()
+	defer f.walLock.Unlock()
+
+	if f.options.CompactAfter > 0 && f.records >= f.options.CompactAfter {
+		// the snapshot contains the state before the change, the change goes to the fresh log
+		if err := f.compactLocked(); err != nil {
+			// the log is still valid, so we don't have to reject the change
+			log.Default().Println(fmt.Sprintf("FilePaymentRepository: could not compact: %s", err))
+		}
+	}
+
+	line, err := encodeRecord(walRecord{Seq: f.seq + 1, Payment: p, Message: &m})
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.wal.Write(line); err != nil {
+		return fmt.Errorf("could not write to the log: %w", err)
+	}
+
+	if f.options.Sync == SyncAlways {
+		if err := f.wal.Sync(); err != nil {
+			return fmt.Errorf("could not sync the log: %w", err)
+		}
+	}
+
+	f.seq++
+	f.records++
+
+	return nil
+}
+
+// compact must be called under the write lock of the embedded repository.
+func (f *FilePaymentRepository) compact() error {
+	f.walLock.Lock()
+	defer f.walLock.Unlock()
+
+	return f.compactLocked()
+}
+
+func (f *FilePaymentRepository) compactLocked() error {
+	tmp := f.path(snapshotFileName + ".tmp")
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+
+	// the first record stores the sequence number, so we know which records from the log are already applied,
+	// and the outbox cursor, acknowledged messages are not in the snapshot, but their sequence numbers must not be reused
+	cursor := f.outbox.cursor()
+
+	header, err := encodeRecord(walRecord{Seq: f.seq, Outbox: &cursor})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(header)
+
+	records := make([]walRecord, 0, len(f.payments)+len(f.outbox.pending))
+	for _, p := range f.payments {
+		records = append(records, walRecord{Seq: f.seq, Payment: p})
+	}
+	for _, m := range f.outbox.pending {
+		records = append(records, walRecord{Seq: f.seq, Message: &m})
+	}
+
+	for _, r := range records {
+		if err != nil {
+			break
+		}
+
+		var line []byte
+		if line, err = encodeRecord(r); err == nil {
+			_, err = w.Write(line)
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if err = errors.Join(err, file.Close()); err != nil {
+		return fmt.Errorf("could not write the snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp, f.path(snapshotFileName)); err != nil {
+		return err
+	}
+
+	// if we crash here, the log is replayed on top of the snapshot and all the records are skipped thanks to seq
+	if err := f.wal.Truncate(0); err != nil {
+		return fmt.Errorf("could not truncate the log: %w", err)
+	}
+
+	f.records = 0
+
+	return nil
+}
+
+func (f *FilePaymentRepository) syncPeriodically() {
+	ticker := time.NewTicker(f.options.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			f.walLock.Lock()
+			if err := f.wal.Sync(); err != nil {
+				log.Default().Println(fmt.Sprintf("FilePaymentRepository: could not sync the log: %s", err))
+			}
+			f.walLock.Unlock()
+		}
+	}
+}
+
+func (f *FilePaymentRepository) replay() error {
+	snapshotSeq := uint64(0)
+	first := true
+
+	err := readRecords(f.path(snapshotFileName), tornTailCorrupted, func(r walRecord) {
+		if first {
+			snapshotSeq = r.Seq
+			first = false
+
+			if r.Outbox != nil {
+				f.outbox.restore(*r.Outbox)
+			}
+
+			return
+		}
+
+		f.restoreRecord(r)
+	})
+	if err != nil {
+		return fmt.Errorf("could not read the snapshot: %w", err)
+	}
+
+	f.seq = snapshotSeq
+
+	tail := tornTailTruncate
+	if f.options.ReadOnly {
+		tail = tornTailSkip
+	}
+
+	err = readRecords(f.path(walFileName), tail, func(r walRecord) {
+		f.records++
+
+		if r.Seq <= snapshotSeq {
+			return
+		}
+
+		f.restoreRecord(r)
+		f.seq = r.Seq
+	})
+	if err != nil {
+		return fmt.Errorf("could not replay the log: %w", err)
+	}
+
+	return nil
+}
+
+// restoreRecord applies the record from the snapshot or the log,
+// the snapshot stores payments and pending messages as separate records.
+func (f *FilePaymentRepository) restoreRecord(r walRecord) {
+	if r.Payment.ID != (uuid.UUID{}) {
+		f.restore(r.Payment)
+	}
+
+	if r.Message != nil {
+		f.outbox.push(*r.Message)
+	}
+}
+
+// tornTail defines what happens to the torn (last, incomplete) record of the file.
+type tornTail int
+
+const (
+	// tornTailCorrupted reports the torn record as [ErrCorruptedWAL], files written atomically are never torn.
+	tornTailCorrupted tornTail = iota
+	// tornTailTruncate removes the torn record, it's a result of a crash during the write.
+	tornTailTruncate
+	// tornTailSkip ignores the torn record, it's being written by another process.
+	tornTailSkip
+)
+
+// readRecords unmarshals every valid record in the given file to a new T and passes it to fn.
+// A corrupted record in the middle of the file is reported as [ErrCorruptedWAL].
+func readRecords[T any](path string, tail tornTail, fn func(T)) error {
+	flag := os.O_RDONLY
+	if tail == tornTailTruncate {
+		flag = os.O_RDWR
+	}
+
+	file, err := os.OpenFile(path, flag, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	r := bufio.NewReader(file)
+	offset := int64(0)
+
+	for line := 1; ; line++ {
+		raw, readErr := r.ReadBytes('\n')
+		if errors.Is(readErr, io.EOF) && len(raw) == 0 {
+			return nil
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return readErr
+		}
+
+		var rec T
+
+		payload, decodeErr := decodeRecord(raw)
+		if decodeErr == nil {
+			decodeErr = json.Unmarshal(payload, &rec)
+		}
+
+		if decodeErr == nil && readErr == nil {
+			fn(rec)
+			offset += int64(len(raw))
+
+			continue
+		}
+
+		if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+			switch tail {
+			case tornTailTruncate:
+				log.Default().Println(fmt.Sprintf("truncating torn record at line %d of %+q", line, path))
+
+				return file.Truncate(offset)
+			case tornTailSkip:
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%w: %s, line %d", ErrCorruptedWAL, path, line)
+	}
+}
+
+// statFile returns nil when the file does not exist (or cannot be read).
+func statFile(path string) os.FileInfo {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	return info
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// encodeRecord produces "<crc32> <json>\n".
+func encodeRecord(r any) ([]byte, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal the record: %w", err)
+	}
+
+	line := strconv.AppendUint(nil, uint64(crc32.ChecksumIEEE(payload)), 16)
+	line = append(line, ' ')
+	line = append(line, payload...)
+
+	return append(line, '\n'), nil
+}
+
+// decodeRecord verifies the checksum and returns the json payload.
+func decodeRecord(line []byte) ([]byte, error) {
+	checksum, payload, ok := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !ok {
+		return nil, errors.New("invalid format")
+	}
+
+	expected, err := strconv.ParseUint(string(checksum), 16, 32)
+	if err != nil || uint32(expected) != crc32.ChecksumIEEE(payload) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,219 @@
+package datastore_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/datastore"
+)
+
+func TestFilePaymentRepository(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("Replay", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+
+		a, b := newPayment(1), newPayment(2)
+		require.NoError(t, repo.Create(ctx, a))
+		require.NoError(t, repo.Create(ctx, b))
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, a.ExternalID, datastore.PaymentPaid))
+		require.NoError(t, repo.Close())
+
+		repo, err = datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+		defer func() {
+			_ = repo.Close()
+		}()
+
+		got, err := repo.GetByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), got.Status)
+
+		got, err = repo.GetByMerchantReference(ctx, b.MerchantID, b.MerchantReference)
+		require.NoError(t, err)
+		assertSamePayment(t, b, got)
+
+		// indexes are rebuilt as well
+		require.Error(t, repo.Create(ctx, a))
+	})
+
+	t.Run("Compaction", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir, CompactAfter: 3})
+		require.NoError(t, err)
+
+		payments := []datastore.Payment{newPayment(1), newPayment(2), newPayment(3), newPayment(4)}
+		for _, p := range payments {
+			require.NoError(t, repo.Create(ctx, p))
+		}
+		require.NoError(t, repo.Close())
+
+		wal, err := os.ReadFile(filepath.Join(dir, "payments.wal"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, bytes.Count(wal, []byte("\n")))
+
+		repo, err = datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+		defer func() {
+			_ = repo.Close()
+		}()
+
+		for _, p := range payments {
+			got, err := repo.GetByID(ctx, p.ID)
+			require.NoError(t, err)
+			assertSamePayment(t, p, got)
+		}
+	})
+
+	t.Run("Outbox after compaction", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+
+		p := newPayment(1)
+		require.NoError(t, repo.Create(ctx, p))
+
+		pending, err := repo.PendingEvents(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.NoError(t, repo.AckEvents(ctx, pending[0].Seq))
+
+		require.NoError(t, repo.Compact())
+		require.NoError(t, repo.Close())
+
+		repo, err = datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+		defer func() {
+			_ = repo.Close()
+		}()
+
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+
+		got, err := repo.PendingEvents(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Greater(t, got[0].Seq, pending[0].Seq, "sequence numbers must not be reused")
+		assert.Equal(t, datastore.EventPaymentPaid, got[0].Event.Type)
+		assert.Equal(t, pending[0].Event.Version+1, got[0].Event.Version)
+	})
+
+	t.Run("Read-only", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+		defer func() {
+			_ = repo.Close()
+		}()
+
+		a := newPayment(1)
+		require.NoError(t, repo.Create(ctx, a))
+		require.NoError(t, repo.Compact())
+
+		b := newPayment(2)
+		require.NoError(t, repo.Create(ctx, b))
+
+		// the record being written by the running instance
+		path := filepath.Join(dir, "payments.wal")
+		appendToFile(t, path, `1234 {"seq":3,"paym`)
+
+		readOnly, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir, ReadOnly: true})
+		require.NoError(t, err)
+		defer func() {
+			_ = readOnly.Close()
+		}()
+
+		for _, p := range []datastore.Payment{a, b} {
+			got, err := readOnly.GetByID(ctx, p.ID)
+			require.NoError(t, err)
+			assertSamePayment(t, p, got)
+		}
+
+		require.ErrorIs(t, readOnly.Create(ctx, newPayment(3)), datastore.ErrReadOnly)
+		require.ErrorIs(t, readOnly.Compact(), datastore.ErrReadOnly)
+
+		wal, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasSuffix(wal, []byte(`"paym`)), "the log must not be changed")
+
+		_, err = datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: filepath.Join(dir, "missing"), ReadOnly: true})
+		require.Error(t, err)
+	})
+
+	t.Run("Torn record", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+
+		p := newPayment(1)
+		require.NoError(t, repo.Create(ctx, p))
+		require.NoError(t, repo.Close())
+
+		appendToFile(t, filepath.Join(dir, "payments.wal"), `1234 {"seq":2,"paym`)
+
+		repo, err = datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+		defer func() {
+			_ = repo.Close()
+		}()
+
+		_, err = repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		require.NoError(t, repo.Create(ctx, newPayment(2)))
+	})
+
+	t.Run("Corrupted record", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.NoError(t, err)
+		require.NoError(t, repo.Create(ctx, newPayment(1)))
+		require.NoError(t, repo.Close())
+
+		path := filepath.Join(dir, "payments.wal")
+		valid, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		// the corrupted record is followed by the valid one, so it's not a torn write
+		appendToFile(t, path, "1234 {}\n"+string(valid))
+
+		_, err = datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: dir})
+		require.ErrorIs(t, err, datastore.ErrCorruptedWAL)
+	})
+}
+
+func appendToFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
@@ -0,0 +1,184 @@
+package datastore_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+)
+
+func init() {
+	// the repository logs every created payment, it makes the benchmarks unreadable
+	log.SetOutput(io.Discard)
+}
+
+func newPayment(i int) datastore.Payment {
+	return datastore.Payment{
+		ID:                uuid.New(),
+		ExternalID:        fmt.Sprintf("external-%d", i),
+		Status:            datastore.PaymentInitiated,
+		Amount:            currency.MustNewAmount(currency.AED, 100, 0),
+		MerchantReference: fmt.Sprintf("order-%d", i),
+	}
+}
+
+// assertSamePayment ignores timestamps maintained by the repository.
+func assertSamePayment(t *testing.T, expected datastore.Payment, actual datastore.Payment) {
+	t.Helper()
+
+	assert.False(t, actual.CreatedAt.IsZero())
+	assert.False(t, actual.UpdatedAt.Before(actual.CreatedAt))
+
+	actual.CreatedAt, actual.UpdatedAt = expected.CreatedAt, expected.UpdatedAt
+	assert.Equal(t, expected, actual)
+}
+
+func TestInMemoryPaymentRepository_Create(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Duplicates", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		repo := datastore.NewInMemoryPaymentRepository()
+
+		p := newPayment(1)
+		require.NoError(t, repo.Create(ctx, p))
+
+		sameID := newPayment(2)
+		sameID.ID = p.ID
+
+		sameExternalID := newPayment(3)
+		sameExternalID.ExternalID = p.ExternalID
+
+		sameReference := newPayment(4)
+		sameReference.MerchantReference = p.MerchantReference
+
+		for _, x := range []datastore.Payment{sameID, sameExternalID, sameReference} {
+			assert.Error(t, repo.Create(ctx, x))
+		}
+
+		noReference := newPayment(5)
+		noReference.MerchantReference = ""
+		anotherNoReference := newPayment(6)
+		anotherNoReference.MerchantReference = ""
+
+		require.NoError(t, repo.Create(ctx, noReference))
+		require.NoError(t, repo.Create(ctx, anotherNoReference))
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		repo := datastore.NewInMemoryPaymentRepository()
+		p := newPayment(1)
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			created int
+		)
+
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if repo.Create(ctx, p) == nil {
+					mu.Lock()
+					created++
+					mu.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+		require.Equal(t, 1, created)
+	})
+}
+
+func TestInMemoryPaymentRepository_Lookups(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := datastore.NewInMemoryPaymentRepository()
+
+	p := newPayment(1)
+	require.NoError(t, repo.Create(ctx, p))
+
+	byReference, err := repo.GetByMerchantReference(ctx, p.MerchantID, p.MerchantReference)
+	require.NoError(t, err)
+	assertSamePayment(t, p, byReference)
+
+	require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+	require.Error(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+	require.Error(t, repo.UpdateInitiatedByExternalID(ctx, "unknown", datastore.PaymentPaid))
+
+	byID, err := repo.GetByID(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), byID.Status)
+
+	_, err = repo.GetByID(ctx, uuid.New())
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+
+	byExternalID, err := repo.GetByExternalID(ctx, p.ExternalID)
+	require.NoError(t, err)
+	assert.Equal(t, p.ID, byExternalID.ID)
+
+	_, err = repo.GetByExternalID(ctx, "unknown")
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+}
+
+func benchmarkRepository(b *testing.B, size int) (*datastore.InMemoryPaymentRepository, []datastore.Payment) {
+	b.Helper()
+
+	repo := datastore.NewInMemoryPaymentRepository()
+	payments := make([]datastore.Payment, 0, size)
+
+	for i := 0; i < size; i++ {
+		p := newPayment(i)
+		require.NoError(b, repo.Create(context.Background(), p))
+		payments = append(payments, p)
+	}
+
+	return repo, payments
+}
+
+func BenchmarkInMemoryPaymentRepository(b *testing.B) {
+	for _, size := range []int{1_000, 1_000_000} {
+		repo, payments := benchmarkRepository(b, size)
+
+		b.Run(fmt.Sprintf("UpdateInitiatedByExternalID/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// the payment is not initiated after the first iteration, so we measure the lookup only
+				_ = repo.UpdateInitiatedByExternalID(context.Background(), payments[i%size].ExternalID, datastore.PaymentFailed)
+			}
+		})
+
+		b.Run(fmt.Sprintf("CreateRefund/%d", size), func(b *testing.B) {
+			refund := datastore.Refund{Amount: currency.NewAmountFromFractions(currency.AED, 1)}
+
+			for i := 0; i < b.N; i++ {
+				// payments are not paid, so we measure the lookup and the validation only
+				refund.ID = uuid.New()
+				_ = repo.CreateRefund(context.Background(), payments[i%size].ID, refund)
+			}
+		})
+
+		b.Run(fmt.Sprintf("Create/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = repo.Create(context.Background(), newPayment(size+i))
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+)
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+)
+
+// ErrInvalidRefundAmount is returned when the refund is empty, or exceeds the amount that can be still refunded.
+var ErrInvalidRefundAmount = errors.New("invalid refund amount")
+
+// Refund returns the given amount (or its part) to the customer, a payment can have many refunds.
+type Refund struct {
+	ID uuid.UUID
+	// ExternalID is assigned by the gateway, it's empty until the gateway accepts the refund
+	ExternalID string
+	Amount     currency.Amount
+	Status     RefundStatus
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// Attempts is the number of failed attempts to submit the refund to the gateway
+	Attempts      int
+	NextAttemptAt time.Time
+	// Reason of the last failure
+	Reason string
+	// Fee is charged by the gateway once it accepts the refund
+	Fee *currency.Amount
+}
+
+// RefundUpdate changes the status of the pending refund, ExternalID, Reason and Fee are stored when they're not empty.
+type RefundUpdate struct {
+	Status     RefundStatus
+	ExternalID string
+	Reason     string
+	Fee        *currency.Amount
+}
+
+// PendingRefund is the refund waiting to be submitted to the gateway, see [InMemoryPaymentRepository.DueRefunds].
+type PendingRefund struct {
+	PaymentID         uuid.UUID
+	PaymentExternalID string
+	MerchantID        uuid.UUID
+	Refund            Refund
+}
+
+// submitted reports whether the gateway has accepted the refund, so we are waiting for the webhook.
+func (r Refund) submitted() bool {
+	return r.Status != RefundPending || r.ExternalID != ""
+}
+
+// RefundedAmount returns the amount returned to the customer, pending refunds are not included.
+func (p Payment) RefundedAmount() currency.Amount {
+	if p.Status == PaymentRefunded {
+		// payments refunded before we introduced partial refunds do not have refund records
+		return p.CapturedAmount()
+	}
+
+	return p.sumRefunds(func(r Refund) bool {
+		return r.Status == RefundSucceeded
+	})
+}
+
+// RefundableAmount returns the captured amount that can be still refunded, pending refunds are reserved.
+func (p Payment) RefundableAmount() currency.Amount {
+	if p.Status == PaymentRefunded {
+		return currency.NewAmountFromFractions(p.Amount.Currency, 0)
+	}
+
+	reserved := p.sumRefunds(func(r Refund) bool {
+		return r.Status != RefundFailed
+	})
+
+	left, err := p.CapturedAmount().Sub(reserved)
+	if err != nil {
+		// refunds are validated on creation, so it's not possible, but we don't want to refund more than we have
+		return currency.NewAmountFromFractions(p.Amount.Currency, 0)
+	}
+
+	return left
+}
+
+func (p Payment) sumRefunds(filter func(Refund) bool) currency.Amount {
+	sum := currency.NewAmountFromFractions(p.Amount.Currency, 0)
+
+	for _, r := range p.Refunds {
+		if !filter(r) {
+			continue
+		}
+
+		// all the refunds are in the payment currency, see [Payment.validateRefund]
+		if x, err := sum.Add(r.Amount); err == nil {
+			sum = x
+		}
+	}
+
+	return sum
+}
+
+// Refund returns the refund with the given ID.
+func (p Payment) Refund(id uuid.UUID) (Refund, bool) {
+	n := p.refundIndex(func(r Refund) bool { return r.ID == id })
+	if n < 0 {
+		return Refund{}, false
+	}
+
+	return p.Refunds[n], true
+}
+
+func (p Payment) refundIndex(match func(Refund) bool) int {
+	return slices.IndexFunc(p.Refunds, match)
+}
+
+// refundByExternalID returns the refund with the given external ID, the index of external IDs can point to the payment
+// whose refund has got another external ID since, see [InMemoryPaymentRepository.UpdateRefundByExternalID].
+func (p Payment) refundByExternalID(extID string) (Refund, bool) {
+	n := p.refundIndex(func(r Refund) bool { return r.ExternalID == extID })
+	if n < 0 || n >= len(p.Refunds) {
+		return Refund{}, false
+	}
+
+	return p.Refunds[n], true
+}
+
+// statusAfterRefunds returns [PaymentRefunded] once the whole amount is returned to the customer,
+// and [PaymentRefundPending] as long as any refund is in progress.
+func (p Payment) statusAfterRefunds() PaymentStatus {
+	pending := slices.ContainsFunc(p.Refunds, func(r Refund) bool {
+		return r.Status == RefundPending
+	})
+
+	refunded := p.sumRefunds(func(r Refund) bool {
+		return r.Status == RefundSucceeded
+	})
+
+	switch {
+	case pending:
+		return PaymentRefundPending
+	case refunded.ToFractional() == p.CapturedAmount().ToFractional():
+		return PaymentRefunded
+	case !refunded.IsZero():
+		return PaymentPartiallyRefunded
+	default:
+		return PaymentPaid
+	}
+}
+
+func (p Payment) validateRefund(r Refund) error {
+	if p.Status != PaymentPaid && p.Status != PaymentPartiallyRefunded && p.Status != PaymentRefundPending {
+		return fmt.Errorf("%w: payment has status %+q", ErrInvalidState, p.Status)
+	}
+
+	if _, ok := p.Refund(r.ID); ok {
+		return fmt.Errorf("%w: refund %+q", ErrDuplicate, r.ID)
+	}
+
+	if r.Amount.IsZero() {
+		return fmt.Errorf("%w: zero amount", ErrInvalidRefundAmount)
+	}
+
+	if _, err := p.RefundableAmount().Sub(r.Amount); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRefundAmount, err)
+	}
+
+	return nil
+}
+
+// validateRefundUpdate returns false when there is nothing to change, so webhooks can be delivered many times.
+// The pending status is used to store the external ID of the refund accepted, but not completed by the gateway.
+func (p Payment) validateRefundUpdate(refundID uuid.UUID, u RefundUpdate) (bool, error) {
+	r, ok := p.Refund(refundID)
+	if !ok {
+		return false, fmt.Errorf("%w: refund %+q", ErrNotFound, refundID)
+	}
+
+	if r.Status == u.Status && (u.Status != RefundPending || u.ExternalID == "" || u.ExternalID == r.ExternalID) {
+		return false, nil
+	}
+
+	if r.Status != RefundPending {
+		return false, fmt.Errorf("%w: refund has status %+q", ErrInvalidState, r.Status)
+	}
+
+	return true, nil
+}
+
+func (p Payment) validateRefundRetry(refundID uuid.UUID) error {
+	r, ok := p.Refund(refundID)
+	if !ok {
+		return fmt.Errorf("%w: refund %+q", ErrNotFound, refundID)
+	}
+
+	if r.submitted() {
+		return fmt.Errorf("%w: refund has been already submitted", ErrInvalidState)
+	}
+
+	return nil
+}
+
+// eventTypeForRefundStatus maps the status of the refund to the event.
+func eventTypeForRefundStatus(s RefundStatus) (EventType, error) {
+	switch s {
+	case RefundPending:
+		return EventRefundSubmitted, nil
+	case RefundSucceeded:
+		return EventRefundSucceeded, nil
+	case RefundFailed:
+		return EventRefundFailed, nil
+	}
+
+	return "", fmt.Errorf("unsupported refund status %+q", s)
+}
+
+// CreateRefund stores the pending refund, the amount is reserved until the refund fails.
+func (i *InMemoryPaymentRepository) CreateRefund(ctx context.Context, paymentID uuid.UUID, r Refund) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.CreateRefund(%+q, %+q): %w", paymentID, r.ID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := x.validateRefund(r); err != nil {
+		return err
+	}
+
+	amount := r.Amount
+
+	return i.apply(ctx, x, Event{Type: EventRefundRequested, RefundID: &r.ID, Amount: &amount})
+}
+
+func (i *InMemoryPaymentRepository) UpdateRefund(ctx context.Context, paymentID uuid.UUID, refundID uuid.UUID, u RefundUpdate) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.UpdateRefund(%+q, %+q): %w", paymentID, refundID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	return i.updateRefund(ctx, x, refundID, u)
+}
+
+// UpdateRefundByExternalID is used by the refund webhooks.
+func (i *InMemoryPaymentRepository) UpdateRefundByExternalID(ctx context.Context, extID string, status RefundStatus) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.UpdateRefundByExternalID(%+q): %w", extID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	id, ok := i.byRefundExternalID[extID]
+	if !ok {
+		return fmt.Errorf("%w: refund", ErrNotFound)
+	}
+
+	x := i.payments[id]
+
+	r, ok := x.refundByExternalID(extID)
+	if !ok {
+		return fmt.Errorf("%w: refund", ErrNotFound)
+	}
+
+	return i.updateRefund(ctx, x, r.ID, RefundUpdate{Status: status})
+}
+
+// updateRefund must be called under the write lock.
+func (i *InMemoryPaymentRepository) updateRefund(ctx context.Context, x Payment, refundID uuid.UUID, u RefundUpdate) error {
+	eventType, err := eventTypeForRefundStatus(u.Status)
+	if err != nil {
+		return err
+	}
+
+	changed, err := x.validateRefundUpdate(refundID, u)
+	if err != nil || !changed {
+		return err
+	}
+
+	return i.apply(ctx, x, Event{Type: eventType, RefundID: &refundID, ExternalID: u.ExternalID, Reason: u.Reason, Fee: u.Fee})
+}
+
+// ScheduleRefundRetry records the failed attempt to submit the refund, it's submitted again after retryAt.
+func (i *InMemoryPaymentRepository) ScheduleRefundRetry(
+	ctx context.Context,
+	paymentID uuid.UUID,
+	refundID uuid.UUID,
+	reason string,
+	retryAt time.Time,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.ScheduleRefundRetry(%+q, %+q): %w", paymentID, refundID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := x.validateRefundRetry(refundID); err != nil {
+		return err
+	}
+
+	return i.apply(ctx, x, Event{Type: EventRefundRetryScheduled, RefundID: &refundID, Reason: reason, RetryAt: &retryAt})
+}
+
+// DueRefunds returns the refunds that must be submitted to the gateway, the oldest attempts go first.
+func (i *InMemoryPaymentRepository) DueRefunds(_ context.Context, now time.Time, limit int) ([]PendingRefund, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	due := make([]PendingRefund, 0)
+
+	for refundID, paymentID := range i.unsubmittedRefunds {
+		p := i.payments[paymentID]
+		r, _ := p.Refund(refundID)
+
+		if r.NextAttemptAt.After(now) {
+			continue
+		}
+
+		due = append(due, PendingRefund{PaymentID: p.ID, PaymentExternalID: p.ExternalID, MerchantID: p.MerchantID, Refund: r})
+	}
+
+	slices.SortFunc(due, func(a, b PendingRefund) int {
+		if c := a.Refund.NextAttemptAt.Compare(b.Refund.NextAttemptAt); c != 0 {
+			return c
+		}
+
+		return a.Refund.CreatedAt.Compare(b.Refund.CreatedAt)
+	})
+
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+// apply commits the event that modifies the payment, the caller must hold the write lock.
+func (i *InMemoryPaymentRepository) apply(ctx context.Context, x Payment, e Event) error {
+	e.PaymentID = x.ID
+	e.OccurredAt = time.Now().UTC()
+
+	x, err := e.Apply(x)
+	if err != nil {
+		return err
+	}
+
+	return i.commit(ctx, x, e)
+}
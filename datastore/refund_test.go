@@ -0,0 +1,152 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+)
+
+type refundRepository interface {
+	Create(context.Context, datastore.Payment) error
+	UpdateInitiatedByExternalID(_ context.Context, extID string, status datastore.PaymentStatus) error
+	GetByID(context.Context, uuid.UUID) (datastore.Payment, error)
+	CreateRefund(_ context.Context, paymentID uuid.UUID, r datastore.Refund) error
+	UpdateRefund(_ context.Context, paymentID uuid.UUID, refundID uuid.UUID, u datastore.RefundUpdate) error
+	UpdateRefundByExternalID(_ context.Context, extID string, status datastore.RefundStatus) error
+	ScheduleRefundRetry(_ context.Context, paymentID uuid.UUID, refundID uuid.UUID, reason string, retryAt time.Time) error
+	DueRefunds(_ context.Context, now time.Time, limit int) ([]datastore.PendingRefund, error)
+}
+
+func TestRefunds(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	eventSourced, err := datastore.NewEventSourcedPaymentRepository(ctx, datastore.NewInMemoryEventStore(), 0)
+	require.NoError(t, err)
+
+	repositories := map[string]refundRepository{
+		"In memory":     datastore.NewInMemoryPaymentRepository(),
+		"Event sourced": eventSourced,
+	}
+
+	for name, repo := range repositories {
+		repo := repo
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := newPayment(1) // 100.00 AED
+			p.MerchantID = uuid.New()
+			require.NoError(t, repo.Create(ctx, p))
+			require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+
+			amount := func(fractions uint) currency.Amount {
+				return currency.NewAmountFromFractions(currency.AED, fractions)
+			}
+
+			first := datastore.Refund{ID: uuid.New(), Amount: amount(3000)}
+			second := datastore.Refund{ID: uuid.New(), Amount: amount(7000)}
+
+			require.NoError(t, repo.CreateRefund(ctx, p.ID, first))
+			require.ErrorIs(t, repo.CreateRefund(ctx, p.ID, first), datastore.ErrDuplicate)
+
+			// the pending refund reserves the amount
+			require.ErrorIs(
+				t,
+				repo.CreateRefund(ctx, p.ID, datastore.Refund{ID: uuid.New(), Amount: amount(7001)}),
+				datastore.ErrInvalidRefundAmount,
+			)
+			require.ErrorIs(
+				t,
+				repo.CreateRefund(ctx, p.ID, datastore.Refund{ID: uuid.New(), Amount: amount(0)}),
+				datastore.ErrInvalidRefundAmount,
+			)
+			require.ErrorIs(
+				t,
+				repo.CreateRefund(ctx, p.ID, datastore.Refund{ID: uuid.New(), Amount: currency.NewAmountFromFractions(currency.USD, 1)}),
+				datastore.ErrInvalidRefundAmount,
+			)
+
+			before, err := repo.GetByID(ctx, p.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefundPending), before.Status)
+
+			now := time.Now()
+
+			due, err := repo.DueRefunds(ctx, now, 10)
+			require.NoError(t, err)
+			require.Len(t, due, 1)
+			assert.Equal(t, first.ID, due[0].Refund.ID)
+			assert.Equal(t, p.ExternalID, due[0].PaymentExternalID)
+			assert.Equal(t, p.MerchantID, due[0].MerchantID)
+
+			require.NoError(t, repo.ScheduleRefundRetry(ctx, p.ID, first.ID, "timeout", now.Add(time.Minute)))
+
+			due, err = repo.DueRefunds(ctx, now, 10)
+			require.NoError(t, err)
+			assert.Empty(t, due)
+
+			due, err = repo.DueRefunds(ctx, now.Add(time.Minute), 10)
+			require.NoError(t, err)
+			require.Len(t, due, 1)
+			assert.Equal(t, 1, due[0].Refund.Attempts)
+			assert.Equal(t, "timeout", due[0].Refund.Reason)
+
+			require.NoError(t, repo.UpdateRefund(ctx, p.ID, first.ID, datastore.RefundUpdate{Status: datastore.RefundSucceeded, ExternalID: "refund-1"}))
+
+			got, err := repo.GetByID(ctx, p.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPartiallyRefunded), got.Status)
+			assert.Equal(t, amount(3000), got.RefundedAmount())
+			assert.Equal(t, amount(7000), got.RefundableAmount())
+			assert.Equal(t, datastore.RefundPending, before.Refunds[0].Status, "the previous version must not be modified")
+
+			due, err = repo.DueRefunds(ctx, now.Add(time.Minute), 10)
+			require.NoError(t, err)
+			assert.Empty(t, due)
+
+			// webhooks can be delivered many times, but the final status cannot be changed
+			require.NoError(t, repo.UpdateRefundByExternalID(ctx, "refund-1", datastore.RefundSucceeded))
+			require.ErrorIs(t, repo.UpdateRefundByExternalID(ctx, "refund-1", datastore.RefundFailed), datastore.ErrInvalidState)
+			require.ErrorIs(t, repo.UpdateRefundByExternalID(ctx, "unknown", datastore.RefundFailed), datastore.ErrNotFound)
+
+			// the failed refund releases the amount
+			require.NoError(t, repo.CreateRefund(ctx, p.ID, second))
+			require.NoError(t, repo.UpdateRefund(ctx, p.ID, second.ID, datastore.RefundUpdate{Status: datastore.RefundFailed}))
+
+			got, err = repo.GetByID(ctx, p.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPartiallyRefunded), got.Status)
+			assert.Equal(t, amount(7000), got.RefundableAmount())
+
+			third := datastore.Refund{ID: uuid.New(), Amount: amount(7000)}
+			require.NoError(t, repo.CreateRefund(ctx, p.ID, third))
+			require.NoError(t, repo.UpdateRefund(ctx, p.ID, third.ID, datastore.RefundUpdate{Status: datastore.RefundPending, ExternalID: "refund-3"}))
+			require.ErrorIs(t, repo.ScheduleRefundRetry(ctx, p.ID, third.ID, "timeout", now), datastore.ErrInvalidState)
+
+			// the gateway reports another external ID, the previous one still points to the payment, but matches no refund
+			require.NoError(t, repo.UpdateRefund(ctx, p.ID, third.ID, datastore.RefundUpdate{Status: datastore.RefundPending, ExternalID: "refund-3b"}))
+			require.ErrorIs(t, repo.UpdateRefundByExternalID(ctx, "refund-3", datastore.RefundSucceeded), datastore.ErrNotFound)
+			require.NoError(t, repo.UpdateRefundByExternalID(ctx, "refund-3b", datastore.RefundSucceeded))
+
+			got, err = repo.GetByID(ctx, p.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefunded), got.Status)
+			assert.Equal(t, p.Amount, got.RefundedAmount())
+			assert.Len(t, got.Refunds, 3)
+
+			require.ErrorIs(
+				t,
+				repo.CreateRefund(ctx, p.ID, datastore.Refund{ID: uuid.New(), Amount: amount(1)}),
+				datastore.ErrInvalidState,
+			)
+		})
+	}
+}
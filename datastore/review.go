@@ -0,0 +1,96 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/currency"
+)
+
+// creationEvent returns the first event of the payment, payments held for the review are not sent to the gateway yet.
+func (p Payment) creationEvent() Event {
+	amount := p.Amount
+
+	e := Event{
+		Type:              EventPaymentInitiated,
+		MerchantID:        p.MerchantID,
+		ExternalID:        p.ExternalID,
+		Amount:            &amount,
+		MerchantReference: p.MerchantReference,
+		CustomerID:        p.CustomerID,
+		ManualCapture:     p.ManualCapture,
+		Context:           p.Context,
+		Fee:               p.Fee,
+	}
+
+	if p.Status == PaymentReview {
+		e.Type = EventPaymentHeldForReview
+		e.Reasons = p.RiskReasons
+	}
+
+	return e
+}
+
+func (p Payment) validateReviewDecision() error {
+	if p.Status != PaymentReview {
+		return fmt.Errorf("%w: payment has status %+q", ErrInvalidState, p.Status)
+	}
+
+	return nil
+}
+
+// approvalEvent returns the event of the payment accepted by the gateway after the review.
+func approvalEvent(externalID string, fee *currency.Amount) Event {
+	return Event{Type: EventPaymentApproved, ExternalID: externalID, Fee: fee}
+}
+
+// ApproveReviewByID records the payment sent to the gateway after the review, it becomes initiated.
+func (i *InMemoryPaymentRepository) ApproveReviewByID(ctx context.Context, paymentID uuid.UUID, externalID string, fee *currency.Amount) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.ApproveReviewByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := x.validateReviewDecision(); err != nil {
+		return err
+	}
+
+	if _, ok := i.byExternalID[externalID]; ok {
+		return fmt.Errorf("%w: the same external ID", ErrDuplicate)
+	}
+
+	return i.apply(ctx, x, approvalEvent(externalID, fee))
+}
+
+// RejectReviewByID rejects the payment held for the review, it's never sent to the gateway.
+func (i *InMemoryPaymentRepository) RejectReviewByID(ctx context.Context, paymentID uuid.UUID) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemoryPaymentRepository.RejectReviewByID(%+q): %w", paymentID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	x, ok := i.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := x.validateReviewDecision(); err != nil {
+		return err
+	}
+
+	return i.apply(ctx, x, Event{Type: EventPaymentRejected})
+}
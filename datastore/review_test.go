@@ -0,0 +1,115 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+)
+
+type reviewRepository interface {
+	refundRepository
+	ApproveReviewByID(_ context.Context, paymentID uuid.UUID, externalID string, fee *currency.Amount) error
+	RejectReviewByID(_ context.Context, paymentID uuid.UUID) error
+	GetByExternalID(_ context.Context, extID string) (datastore.Payment, error)
+}
+
+func TestReview(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	eventSourced, err := datastore.NewEventSourcedPaymentRepository(ctx, datastore.NewInMemoryEventStore(), 0)
+	require.NoError(t, err)
+
+	repositories := map[string]reviewRepository{
+		"In memory":     datastore.NewInMemoryPaymentRepository(),
+		"Event sourced": eventSourced,
+	}
+
+	held := func(i int) datastore.Payment {
+		p := newPayment(i)
+		p.ExternalID = ""
+		p.Status = datastore.PaymentReview
+		p.ManualCapture = true
+		p.Context = map[string]any{"email": "customer@example.com"}
+		p.RiskReasons = []string{"amount exceeds AED 1000.00"}
+
+		return p
+	}
+
+	for name, repo := range repositories {
+		repo := repo
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			approved, rejected := held(1), held(2)
+			for _, p := range []datastore.Payment{approved, rejected} {
+				// payments held for the review don't have the external ID yet
+				require.NoError(t, repo.Create(ctx, p))
+			}
+
+			got, err := repo.GetByID(ctx, approved.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentReview), got.Status)
+			assert.Equal(t, approved.RiskReasons, got.RiskReasons)
+			assert.True(t, got.ManualCapture)
+			assert.Equal(t, approved.Context, got.Context)
+
+			// the webhook cannot change the payment, it's not known by the gateway
+			_, err = repo.GetByExternalID(ctx, "")
+			require.ErrorIs(t, err, datastore.ErrNotFound)
+
+			fee := currency.NewAmountFromFractions(currency.AED, 150)
+			require.NoError(t, repo.ApproveReviewByID(ctx, approved.ID, "external-approved", &fee))
+			require.ErrorIs(t, repo.ApproveReviewByID(ctx, approved.ID, "external-approved-again", &fee), datastore.ErrInvalidState)
+			require.ErrorIs(t, repo.ApproveReviewByID(ctx, uuid.New(), "external-unknown", &fee), datastore.ErrNotFound)
+			require.ErrorIs(t, repo.ApproveReviewByID(ctx, rejected.ID, "external-approved", &fee), datastore.ErrDuplicate)
+
+			require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, "external-approved", datastore.PaymentAuthorized))
+
+			got, err = repo.GetByID(ctx, approved.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentAuthorized), got.Status)
+			assert.Equal(t, &fee, got.Fee)
+
+			require.NoError(t, repo.RejectReviewByID(ctx, rejected.ID))
+			require.ErrorIs(t, repo.RejectReviewByID(ctx, rejected.ID), datastore.ErrInvalidState)
+			require.ErrorIs(t, repo.RejectReviewByID(ctx, approved.ID), datastore.ErrInvalidState)
+
+			got, err = repo.GetByID(ctx, rejected.ID)
+			require.NoError(t, err)
+			assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRejected), got.Status)
+			assert.Empty(t, got.ExternalID)
+		})
+	}
+
+	t.Run("Rebuilt", func(t *testing.T) {
+		t.Parallel()
+
+		store := datastore.NewInMemoryEventStore()
+		p := held(3)
+
+		repo, err := datastore.NewEventSourcedPaymentRepository(ctx, store, 0)
+		require.NoError(t, err)
+		require.NoError(t, repo.Create(ctx, p))
+
+		history, err := repo.History(ctx, p.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, datastore.EventPaymentHeldForReview, history[0].Type)
+
+		rebuilt, err := datastore.NewEventSourcedPaymentRepository(ctx, store, 0)
+		require.NoError(t, err)
+
+		got, err := rebuilt.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentReview), got.Status)
+		assert.Equal(t, p.RiskReasons, got.RiskReasons)
+	})
+}
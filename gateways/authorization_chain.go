@@ -0,0 +1,70 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+)
+
+// AuthorizationChain captures and voids payments authorized by [InitPaymentChain.Authorize],
+// cancels the initiated ones, and reports the status of payments.
+type AuthorizationChain struct {
+	gateways []paymentAuthorizer
+}
+
+func NewAuthorizationChain(gateways ...paymentAuthorizer) *AuthorizationChain {
+	return &AuthorizationChain{gateways: gateways}
+}
+
+func (a AuthorizationChain) Capture(ctx context.Context, req CaptureRequest) (CaptureResponse, error) {
+	required := CapabilityCapture
+	if req.Partial {
+		required |= CapabilityPartialCapture
+	}
+
+	g, err := a.selectGateway(req.ExternalID, required)
+	if err != nil {
+		return CaptureResponse{}, fmt.Errorf("capture of %+q: %w", req.ExternalID, err)
+	}
+
+	return g.Capture(ctx, req)
+}
+
+func (a AuthorizationChain) Void(ctx context.Context, req VoidRequest) (VoidResponse, error) {
+	g, err := a.selectGateway(req.ExternalID, CapabilityVoid)
+	if err != nil {
+		return VoidResponse{}, fmt.Errorf("void of %+q: %w", req.ExternalID, err)
+	}
+
+	return g.Void(ctx, req)
+}
+
+// Cancel returns [ErrNotSupported] when the gateway cannot cancel payments,
+// the customer can still pay the payment in that case.
+func (a AuthorizationChain) Cancel(ctx context.Context, req CancelRequest) (CancelResponse, error) {
+	g, err := a.selectGateway(req.ExternalID, CapabilityCancel)
+	if err != nil {
+		return CancelResponse{}, fmt.Errorf("cancel of %+q: %w", req.ExternalID, err)
+	}
+
+	return g.Cancel(ctx, req)
+}
+
+func (a AuthorizationChain) QueryStatus(ctx context.Context, req StatusRequest) (StatusResponse, error) {
+	g, err := a.selectGateway(req.ExternalID, CapabilityStatusQuery)
+	if err != nil {
+		return StatusResponse{}, fmt.Errorf("status of %+q: %w", req.ExternalID, err)
+	}
+
+	return g.QueryStatus(ctx, req)
+}
+
+// selectGateway returns the gateway that authorized the payment, as long as it has the required capabilities.
+func (a AuthorizationChain) selectGateway(externalID string, required Capability) (paymentAuthorizer, error) {
+	for _, g := range a.gateways {
+		if g.Owns(externalID) && g.Capabilities().Has(required) {
+			return g, nil
+		}
+	}
+
+	return nil, ErrNotSupported
+}
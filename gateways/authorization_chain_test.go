@@ -0,0 +1,115 @@
+package gateways_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/gateways"
+)
+
+type authorizerMock struct {
+	name         string
+	capabilities gateways.Capability
+}
+
+func (a authorizerMock) InitiatePayment(context.Context, gateways.InitiateRequest) (gateways.InitiateResponse, error) {
+	return gateways.InitiateResponse{ExternalID: a.name + "-sale"}, nil
+}
+
+func (a authorizerMock) Supports(r gateways.InitiateRequest) bool {
+	return r.Amount.Currency.Is(currency.AED)
+}
+
+func (a authorizerMock) Capabilities() gateways.Capability {
+	return a.capabilities
+}
+
+func (a authorizerMock) Authorize(context.Context, gateways.InitiateRequest) (gateways.InitiateResponse, error) {
+	return gateways.InitiateResponse{ExternalID: a.name + "-auth"}, nil
+}
+
+func (a authorizerMock) Capture(context.Context, gateways.CaptureRequest) (gateways.CaptureResponse, error) {
+	return gateways.CaptureResponse{OK: true}, nil
+}
+
+func (a authorizerMock) Void(context.Context, gateways.VoidRequest) (gateways.VoidResponse, error) {
+	return gateways.VoidResponse{OK: true}, nil
+}
+
+func (a authorizerMock) Cancel(context.Context, gateways.CancelRequest) (gateways.CancelResponse, error) {
+	return gateways.CancelResponse{OK: true}, nil
+}
+
+func (a authorizerMock) QueryStatus(context.Context, gateways.StatusRequest) (gateways.StatusResponse, error) {
+	return gateways.StatusResponse{Status: datastore.PaymentPaid}, nil
+}
+
+func (a authorizerMock) Name() string {
+	return a.name
+}
+
+func (a authorizerMock) Owns(externalID string) bool {
+	return strings.HasPrefix(externalID, a.name+"-")
+}
+
+func TestCapabilities(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	saleOnly := authorizerMock{name: "sale-only"}
+	fullCaptureOnly := authorizerMock{name: "full", capabilities: gateways.CapabilityAuthorize | gateways.CapabilityCapture}
+
+	aed := gateways.InitiateRequest{Amount: currency.MustNewAmount(currency.AED, 10, 0)}
+
+	t.Run("Authorize", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := gateways.NewInitPaymentChain(saleOnly, fullCaptureOnly).Authorize(ctx, aed)
+		require.NoError(t, err)
+		assert.Equal(t, "full-auth", resp.ExternalID)
+
+		resp, err = gateways.NewInitPaymentChain(saleOnly, fullCaptureOnly).InitiatePayment(ctx, aed)
+		require.NoError(t, err)
+		assert.Equal(t, "sale-only-sale", resp.ExternalID)
+
+		_, err = gateways.NewInitPaymentChain(saleOnly).Authorize(ctx, aed)
+		require.ErrorIs(t, err, gateways.ErrNotSupported)
+
+		_, err = gateways.NewInitPaymentChain(fullCaptureOnly).Authorize(ctx, gateways.InitiateRequest{
+			Amount: currency.MustNewAmount(currency.USD, 10, 0),
+		})
+		require.ErrorIs(t, err, gateways.ErrUnsupportedCurrency)
+	})
+
+	t.Run("Capture, void and cancel", func(t *testing.T) {
+		t.Parallel()
+
+		chain := gateways.NewAuthorizationChain(saleOnly, fullCaptureOnly)
+
+		_, err := chain.Capture(ctx, gateways.CaptureRequest{ExternalID: "full-auth"})
+		require.NoError(t, err)
+
+		_, err = chain.Capture(ctx, gateways.CaptureRequest{ExternalID: "full-auth", Partial: true})
+		require.ErrorIs(t, err, gateways.ErrNotSupported)
+
+		_, err = chain.Void(ctx, gateways.VoidRequest{ExternalID: "full-auth"})
+		require.ErrorIs(t, err, gateways.ErrNotSupported)
+
+		_, err = chain.Capture(ctx, gateways.CaptureRequest{ExternalID: "sale-only-sale"})
+		require.ErrorIs(t, err, gateways.ErrNotSupported)
+
+		_, err = chain.Cancel(ctx, gateways.CancelRequest{ExternalID: "sale-only-sale"})
+		require.ErrorIs(t, err, gateways.ErrNotSupported)
+
+		cancellable := authorizerMock{name: "cancellable", capabilities: gateways.CapabilityCancel}
+		resp, err := gateways.NewAuthorizationChain(saleOnly, cancellable).Cancel(ctx, gateways.CancelRequest{ExternalID: "cancellable-sale"})
+		require.NoError(t, err)
+		assert.True(t, resp.OK)
+	})
+}
@@ -6,12 +6,15 @@ import (
 	"time"
 
 	"github.com/asecurityteam/rolling"
+	"github.com/google/uuid"
 )
 
 type CircuitBreaker struct {
 	gateway   paymentInitiator
 	counter   *rolling.TimePolicy
 	threshold int
+	// successes are counted in the same window as failures, see [CircuitBreaker.SuccessRate]
+	successes *rolling.TimePolicy
 }
 
 func NewCircuitBreaker(gateway paymentInitiator) *CircuitBreaker {
@@ -19,17 +22,36 @@ func NewCircuitBreaker(gateway paymentInitiator) *CircuitBreaker {
 		gateway:   gateway,
 		counter:   rolling.NewTimePolicy(rolling.NewWindow(5), time.Second), // for the sake of exercise that value is hardcoded, in real life it would be configurable
 		threshold: 10,
+		successes: rolling.NewTimePolicy(rolling.NewWindow(5), time.Second),
 	}
 }
 
-// Name returns the name of the decorated gateway.
+// Name returns the name of the decorated gateway, the type is used for gateways without their own name.
 func (c *CircuitBreaker) Name() string {
+	if n, ok := c.gateway.(named); ok {
+		return n.Name()
+	}
+
 	return fmt.Sprintf("%T", c.gateway)
 }
 
 func (c *CircuitBreaker) Active() bool {
+	return c.threshold > count(c.counter)
+}
+
+// SuccessRate returns the ratio of successful requests in the recent window, it's 1 when there were no requests.
+func (c *CircuitBreaker) SuccessRate() float64 {
+	failures, successes := count(c.counter), count(c.successes)
+	if failures+successes == 0 {
+		return 1
+	}
+
+	return float64(successes) / float64(failures+successes)
+}
+
+func count(p *rolling.TimePolicy) int {
 	total := 0
-	c.counter.Reduce(func(w rolling.Window) float64 {
+	p.Reduce(func(w rolling.Window) float64 {
 		for _, x := range w {
 			total += len(x)
 		}
@@ -37,19 +59,54 @@ func (c *CircuitBreaker) Active() bool {
 		return 0
 	})
 
-	return c.threshold > total
+	return total
+}
+
+// record counts the result of the request.
+func (c *CircuitBreaker) record(err error) {
+	if err != nil {
+		c.counter.Append(1)
+		return
+	}
+
+	c.successes.Append(1)
 }
 
 func (c *CircuitBreaker) InitiatePayment(ctx context.Context, r InitiateRequest) (_ InitiateResponse, err error) {
 	defer func() {
-		if err != nil {
-			c.counter.Append(1)
-		}
+		c.record(err)
 	}()
 
 	return c.gateway.InitiatePayment(ctx, r)
 }
 
+// Capabilities returns the capabilities of the decorated gateway, none when it does not implement the two-step flow.
+func (c *CircuitBreaker) Capabilities() Capability {
+	if a, ok := c.gateway.(paymentAuthorizer); ok {
+		return a.Capabilities()
+	}
+
+	return 0
+}
+
+func (c *CircuitBreaker) Authorize(ctx context.Context, r InitiateRequest) (_ InitiateResponse, err error) {
+	a, ok := c.gateway.(paymentAuthorizer)
+	if !ok {
+		return InitiateResponse{}, fmt.Errorf("%s: %w", c.Name(), ErrNotSupported)
+	}
+
+	defer func() {
+		c.record(err)
+	}()
+
+	return a.Authorize(ctx, r)
+}
+
+// Fees returns the fee schedule of the decorated gateway for the merchant, see [MerchantFees].
+func (c *CircuitBreaker) Fees(merchantID uuid.UUID) FeeSchedule {
+	return feesOf(c.gateway, merchantID)
+}
+
 func (c *CircuitBreaker) Supports(r InitiateRequest) bool {
 	return c.gateway.Supports(r)
 }
@@ -2,19 +2,120 @@ package gateways
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
 
+	"github.com/google/uuid"
 	"payments/currency"
 	"payments/datastore"
 )
 
+var (
+	// ErrUnsupportedCurrency is returned when none of the gateways supports the given request.
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	// ErrUnavailable is returned when the gateways supporting the given request are inactive, see [CircuitBreaker].
+	ErrUnavailable = errors.New("gateway unavailable")
+	// ErrNotSupported is returned when none of the gateways supports the given operation.
+	ErrNotSupported = errors.New("operation not supported")
+)
+
 type InitiateRequest struct {
-	Amount  currency.Amount
-	Context map[string]any // TODO I assume in the future we may need some gateway-specific details
+	// MerchantID selects the fees agreed for the merchant, see [MerchantFees]
+	MerchantID uuid.UUID
+	Amount     currency.Amount
+	Context    map[string]any // TODO I assume in the future we may need some gateway-specific details
+	// Gateways limits the gateways the payment can be routed to (see [CircuitBreaker.Name]), all of them are allowed when empty
+	Gateways []string
+}
+
+// allows reports whether the payment can be routed to the gateway with the given name.
+func (r InitiateRequest) allows(name string) bool {
+	return len(r.Gateways) == 0 || slices.Contains(r.Gateways, name)
 }
 
 type InitiateResponse struct {
 	ExternalID string
+	// NextAction is nil when the customer doesn't have to do anything else
+	NextAction *NextAction
+	// Fee is charged by the gateway, it's set by [InitPaymentChain], see [FeeSchedule]
+	Fee currency.Amount
+}
+
+type NextActionType string
+
+const (
+	NextActionRedirect     NextActionType = "redirect"
+	NextActionThreeDSecure NextActionType = "three_d_secure"
+)
+
+// NextAction is required by the gateway to complete the payment, e.g. the customer must be redirected to the gateway page.
+type NextAction struct {
+	Type        NextActionType
+	RedirectURL string
+	// ThreeDSecureData contains the gateway-specific payload of the 3DS challenge
+	ThreeDSecureData map[string]string
+}
+
+// Capability is an optional operation of the gateway, capabilities can be combined, e.g. CapabilityAuthorize|CapabilityVoid.
+type Capability uint8
+
+const (
+	// CapabilityAuthorize means that the gateway can reserve the amount, so it's charged once captured.
+	CapabilityAuthorize Capability = 1 << iota
+	CapabilityCapture
+	// CapabilityPartialCapture means that the gateway can capture a part of the authorized amount.
+	CapabilityPartialCapture
+	CapabilityVoid
+	// CapabilityCancel means that the gateway can cancel the initiated payment, so the customer cannot pay it anymore.
+	CapabilityCancel
+	// CapabilityStatusQuery means that the gateway can report the status of the payment, see [StatusQuerier].
+	CapabilityStatusQuery
+)
+
+func (c Capability) Has(x Capability) bool {
+	return c&x == x
+}
+
+type CaptureRequest struct {
+	ExternalID string // of the payment
+	Amount     currency.Amount
+	// Partial is true when the amount is lower than the authorized one
+	Partial bool
+}
+
+type CaptureResponse struct {
+	// OK is false when the gateway declined the capture
+	OK bool
+}
+
+type VoidRequest struct {
+	ExternalID string // of the payment
+}
+
+type VoidResponse struct {
+	OK bool
+}
+
+type CancelRequest struct {
+	ExternalID string // of the payment
+}
+
+type CancelResponse struct {
+	OK bool
+}
+
+type StatusRequest struct {
+	ExternalID string // of the payment
+}
+
+type StatusResponse struct {
+	Status datastore.PaymentStatus
+}
+
+// StatusQuerier reports the status of the payment, it's the fallback for lost webhooks.
+type StatusQuerier interface {
+	QueryStatus(context.Context, StatusRequest) (StatusResponse, error)
 }
 
 type ChangeStatusRequest struct {
@@ -28,11 +129,29 @@ type doer interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
+// named is implemented by gateways having a stable name, e.g. used in the merchant configuration.
+type named interface {
+	Name() string
+}
+
 type paymentInitiator interface {
 	InitiatePayment(context.Context, InitiateRequest) (InitiateResponse, error)
 	Supports(InitiateRequest) bool
 }
 
+// paymentAuthorizer is implemented by gateways supporting operations on the existing payments (the two-step flow, cancellation),
+// operations are used only when the gateway declares the corresponding [Capability].
+type paymentAuthorizer interface {
+	Capabilities() Capability
+	Authorize(context.Context, InitiateRequest) (InitiateResponse, error)
+	Capture(context.Context, CaptureRequest) (CaptureResponse, error)
+	Void(context.Context, VoidRequest) (VoidResponse, error)
+	Cancel(context.Context, CancelRequest) (CancelResponse, error)
+	StatusQuerier
+	// Owns reports whether the payment with the given external ID has been created by the gateway
+	Owns(externalID string) bool
+}
+
 type paymentRefunder interface {
 	Refund(context.Context, RefundRequest) (RefundResponse, error)
 	SupportsRefund(RefundRequest) bool
@@ -43,10 +162,27 @@ type UpdateStatusRequest struct {
 	Status     datastore.PaymentStatus
 }
 
+// UpdateRefundStatusRequest is sent by the gateway once the refund is completed.
+type UpdateRefundStatusRequest struct {
+	ExternalID string // of the refund, see [RefundResponse]
+	Status     datastore.RefundStatus
+}
+
 type RefundRequest struct {
-	ExternalID string
+	ExternalID string // of the payment
+	// ID is unique per refund, gateways should use it as the idempotency key
+	ID     uuid.UUID
+	Amount currency.Amount
+	// MerchantID selects the fees agreed for the merchant, see [MerchantFees]
+	MerchantID uuid.UUID
 }
 
 type RefundResponse struct {
-	OK bool
+	// OK is false when the gateway declined the refund
+	OK         bool
+	ExternalID string // of the refund
+	// Pending is true when the gateway accepted the refund, but the final status will be sent by the webhook
+	Pending bool
+	// Fee is charged by the gateway for accepted refunds, it's set by [RefunderChain], see [FeeSchedule]
+	Fee currency.Amount
 }
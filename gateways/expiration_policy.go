@@ -0,0 +1,50 @@
+package gateways
+
+import "time"
+
+type paymentOwner interface {
+	// Owns reports whether the payment with the given external ID has been created by the gateway
+	Owns(externalID string) bool
+}
+
+type expirationRule struct {
+	gateway paymentOwner
+	ttl     time.Duration
+}
+
+// ExpirationPolicy defines how long the customer has to pay the payment initiated by the given gateway.
+type ExpirationPolicy struct {
+	defaultTTL time.Duration
+	rules      []expirationRule
+}
+
+func NewExpirationPolicy(defaultTTL time.Duration) *ExpirationPolicy {
+	return &ExpirationPolicy{defaultTTL: defaultTTL}
+}
+
+// WithTTL overrides the default TTL for the payments initiated by the given gateway.
+func (e *ExpirationPolicy) WithTTL(gateway paymentOwner, ttl time.Duration) *ExpirationPolicy {
+	e.rules = append(e.rules, expirationRule{gateway: gateway, ttl: ttl})
+
+	return e
+}
+
+func (e *ExpirationPolicy) TTL(externalID string) time.Duration {
+	for _, r := range e.rules {
+		if r.gateway.Owns(externalID) {
+			return r.ttl
+		}
+	}
+
+	return e.defaultTTL
+}
+
+// MinTTL returns the shortest TTL, payments younger than that cannot expire.
+func (e *ExpirationPolicy) MinTTL() time.Duration {
+	ttl := e.defaultTTL
+	for _, r := range e.rules {
+		ttl = min(ttl, r.ttl)
+	}
+
+	return ttl
+}
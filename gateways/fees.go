@@ -0,0 +1,174 @@
+package gateways
+
+import (
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+)
+
+// Fee is charged by the gateway for a single operation, all the values are in fractions of the currency (e.g. cents).
+type Fee struct {
+	Fixed uint `json:"fixed"`
+	// BasisPoints is the percentage of the amount, 1 basis point is 0.01%
+	BasisPoints uint `json:"basis_points"`
+	// Min and Max limit the fee, zero means no limit
+	Min uint `json:"min"`
+	Max uint `json:"max"`
+}
+
+// Calculate returns the fee for the given amount, the percentage is rounded half up.
+func (f Fee) Calculate(amount currency.Amount) currency.Amount {
+	fixed := currency.NewAmountFromFractions(amount.Currency, f.Fixed)
+	percentage := currency.NewAmountFromFractions(amount.Currency, (amount.ToFractional()*f.BasisPoints+5_000)/10_000)
+
+	fee, err := fixed.Add(percentage)
+	if err != nil {
+		// both amounts are in the same currency, so it's not possible
+		return currency.NewAmountFromFractions(amount.Currency, 0)
+	}
+
+	switch x := fee.ToFractional(); {
+	case x < f.Min:
+		return currency.NewAmountFromFractions(amount.Currency, f.Min)
+	case f.Max > 0 && x > f.Max:
+		return currency.NewAmountFromFractions(amount.Currency, f.Max)
+	}
+
+	return fee
+}
+
+// FeeTier is applied once the volume processed by the gateway in the current month reaches FromVolume (in fractions),
+// it's the volume of all the merchants, even when the merchant has its own fees, see [MerchantFees].
+type FeeTier struct {
+	FromVolume uint `json:"from_volume"`
+	Fee        Fee  `json:"fee"`
+}
+
+// CurrencyFees are the fees of payments and refunds in the given currency.
+type CurrencyFees struct {
+	// Tiers do not have to be sorted, payments are free below the lowest tier
+	Tiers  []FeeTier `json:"tiers"`
+	Refund Fee       `json:"refund"`
+}
+
+// FeeSchedule maps the currency code to its fees, operations in currencies not listed are free.
+type FeeSchedule map[string]CurrencyFees
+
+// PaymentFee returns the fee of the payment, monthlyVolume is the amount processed by the gateway
+// in the current month before the payment, it determines the [FeeTier].
+func (s FeeSchedule) PaymentFee(amount currency.Amount, monthlyVolume currency.Amount) currency.Amount {
+	fees := s[amount.Currency.Code]
+
+	tiers := make([]FeeTier, len(fees.Tiers))
+	copy(tiers, fees.Tiers)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].FromVolume < tiers[j].FromVolume })
+
+	var (
+		fee   Fee
+		found bool
+	)
+
+	for _, t := range tiers {
+		if t.FromVolume > monthlyVolume.ToFractional() {
+			break
+		}
+
+		fee, found = t.Fee, true
+	}
+
+	if !found {
+		return currency.NewAmountFromFractions(amount.Currency, 0)
+	}
+
+	return fee.Calculate(amount)
+}
+
+// RefundFee returns the fee of the refund.
+func (s FeeSchedule) RefundFee(amount currency.Amount) currency.Amount {
+	return s[amount.Currency.Code].Refund.Calculate(amount)
+}
+
+// MerchantFees are agreed with the gateway for specific merchants, they override the [FeeSchedule] of the gateway
+// per currency, so the currencies not listed for the merchant are charged by the schedule of the gateway.
+type MerchantFees map[uuid.UUID]FeeSchedule
+
+// feeCharger is implemented by gateways charging fees, gateways without the schedule are free.
+type feeCharger interface {
+	Fees() FeeSchedule
+}
+
+// merchantFeeCharger is implemented by gateways with fees agreed for specific merchants.
+type merchantFeeCharger interface {
+	MerchantFees() MerchantFees
+}
+
+// feesOf returns the fee schedule of the gateway for the merchant, it's empty when the gateway does not charge fees.
+func feesOf(gateway any, merchantID uuid.UUID) FeeSchedule {
+	var schedule FeeSchedule
+	if c, ok := gateway.(feeCharger); ok {
+		schedule = c.Fees()
+	}
+
+	c, ok := gateway.(merchantFeeCharger)
+	if !ok {
+		return schedule
+	}
+
+	override, ok := c.MerchantFees()[merchantID]
+	if !ok {
+		return schedule
+	}
+
+	merged := make(FeeSchedule, len(schedule)+len(override))
+	maps.Copy(merged, schedule)
+	maps.Copy(merged, override)
+
+	return merged
+}
+
+type volumeKey struct {
+	gateway  *CircuitBreaker // names are not unique, e.g. the same gateway can be configured twice
+	currency string
+	month    string
+}
+
+// volumeTracker sums the amounts initiated by every gateway in the current month, see [FeeTier].
+// TODO volumes are kept in memory, so they're reset on restart and the lowest tier applies until the volume is reached again,
+// payments do not record their gateway, so the volume cannot be rebuilt from the repository, it must be persisted separately
+type volumeTracker struct {
+	locker  *sync.Mutex
+	volumes map[volumeKey]uint
+	now     func() time.Time
+}
+
+func newVolumeTracker() *volumeTracker {
+	return &volumeTracker{locker: &sync.Mutex{}, volumes: make(map[volumeKey]uint), now: time.Now}
+}
+
+func (v *volumeTracker) key(gateway *CircuitBreaker, c currency.Currency) volumeKey {
+	return volumeKey{gateway: gateway, currency: c.Code, month: v.now().UTC().Format("2006-01")}
+}
+
+// volume returns the amount initiated by the gateway in the current month.
+func (v *volumeTracker) volume(gateway *CircuitBreaker, c currency.Currency) currency.Amount {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	return currency.NewAmountFromFractions(c, v.volumes[v.key(gateway, c)])
+}
+
+// add records the amount, and returns the volume of the month before it.
+func (v *volumeTracker) add(gateway *CircuitBreaker, amount currency.Amount) currency.Amount {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	k := v.key(gateway, amount.Currency)
+	before := v.volumes[k]
+	v.volumes[k] = before + amount.ToFractional()
+
+	return currency.NewAmountFromFractions(amount.Currency, before)
+}
@@ -0,0 +1,232 @@
+package gateways_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/gateways"
+)
+
+func TestFee_Calculate(t *testing.T) {
+	t.Parallel()
+
+	scenarios := map[string]struct {
+		fee      gateways.Fee
+		amount   currency.Amount
+		expected uint
+	}{
+		"Fixed and percentage": {
+			fee:      gateways.Fee{Fixed: 30, BasisPoints: 290},
+			amount:   currency.MustNewAmount(currency.USD, 100, 0),
+			expected: 30 + 290,
+		},
+		"Rounded half up": {
+			fee:      gateways.Fee{BasisPoints: 150},
+			amount:   currency.NewAmountFromFractions(currency.USD, 100),
+			expected: 2,
+		},
+		"Minimum": {
+			fee:      gateways.Fee{BasisPoints: 100, Min: 50},
+			amount:   currency.MustNewAmount(currency.USD, 10, 0),
+			expected: 50,
+		},
+		"Maximum": {
+			fee:      gateways.Fee{BasisPoints: 100, Max: 500},
+			amount:   currency.MustNewAmount(currency.USD, 1000, 0),
+			expected: 500,
+		},
+		"Free": {
+			amount:   currency.MustNewAmount(currency.USD, 10, 0),
+			expected: 0,
+		},
+	}
+
+	for name, s := range scenarios {
+		s := s
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fee := s.fee.Calculate(s.amount)
+			assert.Equal(t, s.expected, fee.ToFractional())
+			assert.True(t, fee.Currency.Is(s.amount.Currency))
+		})
+	}
+}
+
+func TestFeeSchedule(t *testing.T) {
+	t.Parallel()
+
+	schedule := gateways.FeeSchedule{
+		"AED": {
+			Tiers: []gateways.FeeTier{
+				{FromVolume: 100_000, Fee: gateways.Fee{BasisPoints: 100}},
+				{FromVolume: 0, Fee: gateways.Fee{BasisPoints: 200}},
+			},
+			Refund: gateways.Fee{Fixed: 100},
+		},
+	}
+
+	amount := currency.MustNewAmount(currency.AED, 100, 0)
+
+	assert.Equal(t, uint(200), schedule.PaymentFee(amount, currency.NewAmountFromFractions(currency.AED, 99_999)).ToFractional())
+	assert.Equal(t, uint(100), schedule.PaymentFee(amount, currency.NewAmountFromFractions(currency.AED, 100_000)).ToFractional())
+	assert.Equal(t, uint(100), schedule.RefundFee(amount).ToFractional())
+
+	usd := currency.MustNewAmount(currency.USD, 100, 0)
+	assert.True(t, schedule.PaymentFee(usd, usd).IsZero())
+	assert.True(t, gateways.FeeSchedule(nil).RefundFee(usd).IsZero())
+}
+
+type feeChargingMock struct {
+	authorizerMock
+	fees         gateways.FeeSchedule
+	merchantFees gateways.MerchantFees
+}
+
+func (f feeChargingMock) Fees() gateways.FeeSchedule {
+	return f.fees
+}
+
+func (f feeChargingMock) MerchantFees() gateways.MerchantFees {
+	return f.merchantFees
+}
+
+func (f feeChargingMock) Refund(context.Context, gateways.RefundRequest) (gateways.RefundResponse, error) {
+	return gateways.RefundResponse{OK: true, ExternalID: f.name + "-refund"}, nil
+}
+
+func (f feeChargingMock) SupportsRefund(gateways.RefundRequest) bool {
+	return true
+}
+
+func TestFees_Chains(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	gateway := feeChargingMock{
+		authorizerMock: authorizerMock{name: "charging"},
+		fees: gateways.FeeSchedule{
+			"AED": {
+				Tiers: []gateways.FeeTier{
+					{FromVolume: 0, Fee: gateways.Fee{Fixed: 100}},
+					{FromVolume: 15_000, Fee: gateways.Fee{Fixed: 50}},
+				},
+				Refund: gateways.Fee{Fixed: 25},
+			},
+		},
+	}
+
+	t.Run("Payments", func(t *testing.T) {
+		t.Parallel()
+
+		chain := gateways.NewInitPaymentChain(gateway)
+		r := gateways.InitiateRequest{Amount: currency.MustNewAmount(currency.AED, 100, 0)}
+
+		var fees []uint
+		for i := 0; i < 3; i++ {
+			resp, err := chain.InitiatePayment(ctx, r)
+			require.NoError(t, err)
+			fees = append(fees, resp.Fee.ToFractional())
+		}
+
+		// the volume of the first two payments reaches the cheaper tier
+		assert.Equal(t, []uint{100, 100, 50}, fees)
+
+		free, err := gateways.NewInitPaymentChain(authorizerMock{name: "free"}).InitiatePayment(ctx, r)
+		require.NoError(t, err)
+		assert.True(t, free.Fee.IsZero())
+		assert.True(t, free.Fee.Currency.Is(currency.AED))
+	})
+
+	t.Run("Refunds", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := gateways.NewRefunderChain(gateway).Refund(ctx, gateways.RefundRequest{
+			ExternalID: "charging-sale",
+			ID:         uuid.New(),
+			Amount:     currency.MustNewAmount(currency.AED, 10, 0),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, uint(25), resp.Fee.ToFractional())
+	})
+}
+
+func TestMerchantFees(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	negotiated := uuid.New()
+
+	aed := func(basisPoints uint) gateways.CurrencyFees {
+		return gateways.CurrencyFees{Tiers: []gateways.FeeTier{{Fee: gateways.Fee{BasisPoints: basisPoints}}}, Refund: gateways.Fee{Fixed: basisPoints}}
+	}
+
+	first := feeChargingMock{
+		authorizerMock: authorizerMock{name: "first"},
+		fees:           gateways.FeeSchedule{"AED": aed(300), "USD": aed(300)},
+		merchantFees:   gateways.MerchantFees{negotiated: {"AED": aed(100)}},
+	}
+	second := feeChargingMock{
+		authorizerMock: authorizerMock{name: "second"},
+		fees:           gateways.FeeSchedule{"AED": aed(200), "USD": aed(200)},
+	}
+
+	chain := gateways.NewInitPaymentChain(first, second).WithStrategy(gateways.SelectCheapest)
+
+	scenarios := map[string]struct {
+		request  gateways.InitiateRequest
+		external string
+		fee      uint
+	}{
+		"Gateway fees": {
+			request:  gateways.InitiateRequest{MerchantID: uuid.New(), Amount: currency.MustNewAmount(currency.AED, 100, 0)},
+			external: "second-sale",
+			fee:      200,
+		},
+		"Merchant fees": {
+			request:  gateways.InitiateRequest{MerchantID: negotiated, Amount: currency.MustNewAmount(currency.AED, 100, 0)},
+			external: "first-sale",
+			fee:      100,
+		},
+	}
+
+	for name, s := range scenarios {
+		s := s
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := chain.InitiatePayment(ctx, s.request)
+			require.NoError(t, err)
+			assert.Equal(t, s.external, resp.ExternalID)
+			assert.Equal(t, s.fee, resp.Fee.ToFractional())
+		})
+	}
+
+	t.Run("Refunds", func(t *testing.T) {
+		t.Parallel()
+
+		r := gateways.RefundRequest{ExternalID: "first-sale", ID: uuid.New(), Amount: currency.MustNewAmount(currency.AED, 10, 0)}
+
+		resp, err := gateways.NewRefunderChain(first).Refund(ctx, r)
+		require.NoError(t, err)
+		assert.Equal(t, uint(300), resp.Fee.ToFractional())
+
+		r.MerchantID = negotiated
+		resp, err = gateways.NewRefunderChain(first).Refund(ctx, r)
+		require.NoError(t, err)
+		assert.Equal(t, uint(100), resp.Fee.ToFractional())
+
+		// the currency not overridden for the merchant
+		r.Amount = currency.MustNewAmount(currency.USD, 10, 0)
+		resp, err = gateways.NewRefunderChain(first).Refund(ctx, r)
+		require.NoError(t, err)
+		assert.Equal(t, uint(300), resp.Fee.ToFractional())
+	})
+}
@@ -2,13 +2,16 @@ package gateways
 
 import (
 	"context"
-	"errors"
+	"fmt"
 
 	"github.com/opentracing/opentracing-go"
+	"payments/currency"
 )
 
 type InitPaymentChain struct {
 	gateways []*CircuitBreaker
+	volumes  *volumeTracker
+	strategy SelectionStrategy
 }
 
 func NewInitPaymentChain(gateways ...paymentInitiator) *InitPaymentChain {
@@ -21,9 +24,17 @@ func NewInitPaymentChain(gateways ...paymentInitiator) *InitPaymentChain {
 
 	return &InitPaymentChain{
 		gateways: tmp,
+		volumes:  newVolumeTracker(),
+		strategy: SelectFirst,
 	}
 }
 
+// WithStrategy changes the way the gateway is selected among the active ones, see [SelectCheapest].
+func (i *InitPaymentChain) WithStrategy(s SelectionStrategy) *InitPaymentChain {
+	i.strategy = s
+	return i
+}
+
 func (i InitPaymentChain) InitiatePayment(ctx context.Context, r InitiateRequest) (_ InitiateResponse, err error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "InitPaymentChain.InitiatePayment")
 	defer span.Finish()
@@ -34,20 +45,101 @@ func (i InitPaymentChain) InitiatePayment(ctx context.Context, r InitiateRequest
 		}
 	}()
 
-	var selected *CircuitBreaker
+	selected, err := i.selectGateway(r, 0)
+	if err != nil {
+		return InitiateResponse{}, err
+	}
+
+	span.SetTag("selected", selected.Gateway.Name())
+	span.SetTag("estimated_fee", selected.EstimatedFee.String())
+
+	resp, err := selected.Gateway.InitiatePayment(ctx, r)
+	if err != nil {
+		return InitiateResponse{}, err
+	}
+
+	resp.Fee = i.chargeFee(span, selected.Gateway, r)
+
+	return resp, nil
+}
+
+// Authorize reserves the amount using the active gateway with [CapabilityAuthorize],
+// the payment must be captured or voided later, see [AuthorizationChain].
+func (i InitPaymentChain) Authorize(ctx context.Context, r InitiateRequest) (_ InitiateResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "InitPaymentChain.Authorize")
+	defer span.Finish()
 
 	defer func() {
-		if selected != nil {
-			span.SetTag("selected", selected.Name())
+		if err != nil {
+			span.SetTag("error", err)
 		}
 	}()
 
+	selected, err := i.selectGateway(r, CapabilityAuthorize)
+	if err != nil {
+		return InitiateResponse{}, err
+	}
+
+	span.SetTag("selected", selected.Gateway.Name())
+	span.SetTag("estimated_fee", selected.EstimatedFee.String())
+
+	resp, err := selected.Gateway.Authorize(ctx, r)
+	if err != nil {
+		return InitiateResponse{}, err
+	}
+
+	resp.Fee = i.chargeFee(span, selected.Gateway, r)
+
+	return resp, nil
+}
+
+// chargeFee returns the fee of the initiated payment, the amount is counted towards the monthly volume of the gateway.
+func (i InitPaymentChain) chargeFee(span opentracing.Span, g *CircuitBreaker, r InitiateRequest) currency.Amount {
+	fee := g.Fees(r.MerchantID).PaymentFee(r.Amount, i.volumes.add(g, r.Amount))
+	span.SetTag("fee", fee.String())
+
+	return fee
+}
+
+// selectGateway returns the active gateway supporting the request and having the required capabilities,
+// the strategy decides when there are many of them.
+func (i InitPaymentChain) selectGateway(r InitiateRequest, required Capability) (Candidate, error) {
+	var (
+		supported, capable bool
+		candidates         []Candidate
+	)
+
 	for _, g := range i.gateways {
-		if g.Active() && g.Supports(r) {
-			selected = g
-			return g.InitiatePayment(ctx, r)
+		if !g.Supports(r) || !r.allows(g.Name()) {
+			continue
 		}
+
+		supported = true
+
+		if !g.Capabilities().Has(required) {
+			continue
+		}
+
+		capable = true
+
+		if g.Active() {
+			candidates = append(candidates, Candidate{
+				Gateway:      g,
+				EstimatedFee: g.Fees(r.MerchantID).PaymentFee(r.Amount, i.volumes.volume(g, r.Amount.Currency)),
+			})
+		}
+	}
+
+	if len(candidates) > 0 {
+		return i.strategy(candidates), nil
+	}
+
+	switch {
+	case capable:
+		return Candidate{}, fmt.Errorf("all the gateways supporting %s are inactive: %w", r.Amount.Currency.Code, ErrUnavailable)
+	case supported:
+		return Candidate{}, fmt.Errorf("no gateways supporting %s can authorize: %w", r.Amount.Currency.Code, ErrNotSupported)
 	}
 
-	return InitiateResponse{}, errors.New("no gateways supports the given request")
+	return Candidate{}, fmt.Errorf("no gateways supports %s: %w", r.Amount.Currency.Code, ErrUnsupportedCurrency)
 }
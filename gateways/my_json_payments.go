@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -18,12 +19,40 @@ type MyJSONPayments struct {
 	baseURL string
 	http    doer
 	timeout time.Duration
+	fees    FeeSchedule
+	// merchantFees override fees for merchants with their own agreements
+	merchantFees MerchantFees
 }
 
 func NewMyJSONPayments(baseURL string, http doer, timeout time.Duration) *MyJSONPayments {
 	return &MyJSONPayments{baseURL: baseURL, http: http, timeout: timeout}
 }
 
+// Name is used in the merchant configuration and settlement reports.
+func (m *MyJSONPayments) Name() string {
+	return "my-json-payments"
+}
+
+// WithFees sets the fees agreed with the gateway, payments are free by default.
+func (m *MyJSONPayments) WithFees(s FeeSchedule) *MyJSONPayments {
+	m.fees = s
+	return m
+}
+
+func (m *MyJSONPayments) Fees() FeeSchedule {
+	return m.fees
+}
+
+// WithMerchantFees sets the fees agreed with the gateway for specific merchants, see [MerchantFees].
+func (m *MyJSONPayments) WithMerchantFees(f MerchantFees) *MyJSONPayments {
+	m.merchantFees = f
+	return m
+}
+
+func (m *MyJSONPayments) MerchantFees() MerchantFees {
+	return m.merchantFees
+}
+
 func (m *MyJSONPayments) InitiatePayment(ctx context.Context, r InitiateRequest) (_ InitiateResponse, err error) {
 	defer func() {
 		if err != nil {
@@ -31,6 +60,21 @@ func (m *MyJSONPayments) InitiatePayment(ctx context.Context, r InitiateRequest)
 		}
 	}()
 
+	return m.initiate(ctx, r, "initiate-payment")
+}
+
+// Authorize is the same as [MyJSONPayments.InitiatePayment], but the payment must be captured later.
+func (m *MyJSONPayments) Authorize(ctx context.Context, r InitiateRequest) (_ InitiateResponse, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("MyJSONPayments.Authorize: %w", err)
+		}
+	}()
+
+	return m.initiate(ctx, r, "authorize-payment")
+}
+
+func (m *MyJSONPayments) initiate(ctx context.Context, r InitiateRequest, path string) (InitiateResponse, error) {
 	var cancel func()
 
 	ctx, cancel = context.WithTimeout(ctx, m.timeout)
@@ -51,7 +95,7 @@ func (m *MyJSONPayments) InitiatePayment(ctx context.Context, r InitiateRequest)
 
 	req, err := http.NewRequest(
 		http.MethodPost,
-		fmt.Sprintf("%s/%s", m.baseURL, "initiate-payment"),
+		fmt.Sprintf("%s/%s", m.baseURL, path),
 		bytes.NewBuffer(body),
 	)
 	// unpopular opinion - no need to handle that error, we could use "must" func here, because
@@ -79,23 +123,28 @@ func (m *MyJSONPayments) InitiatePayment(ctx context.Context, r InitiateRequest)
 			fmt.Errorf("invalid status code, %d given, %d expected", resp.StatusCode, http.StatusCreated)
 	}
 
-	// TODO only for test purposes, remove the following section to execute the real logic
-	{
-		return InitiateResponse{
-			ExternalID: "my-payment-gateway-json-id-123",
-		}, nil
-	}
-
 	var jsonResp struct {
-		ID string `json:"id"`
+		ID          string `json:"id"`
+		RedirectURL string `json:"redirect_url"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
 		return InitiateResponse{}, fmt.Errorf("corrupted response format") // TODO should we log the body?
 	}
 
+	// without the ID we could not match webhooks, so the payment is treated as failed
+	if jsonResp.ID == "" {
+		return InitiateResponse{}, fmt.Errorf("empty payment ID in the response")
+	}
+
+	var nextAction *NextAction
+	if jsonResp.RedirectURL != "" {
+		nextAction = &NextAction{Type: NextActionRedirect, RedirectURL: jsonResp.RedirectURL}
+	}
+
 	return InitiateResponse{
 		ExternalID: jsonResp.ID,
+		NextAction: nextAction,
 	}, nil
 }
 
@@ -132,11 +181,108 @@ func (m *MyJSONPayments) UpdateStatusRequestToInternal(request any) (UpdateStatu
 	}, nil
 }
 
-func (m *MyJSONPayments) Refund(context.Context, RefundRequest) (RefundResponse, error) {
+func (m *MyJSONPayments) Refund(_ context.Context, r RefundRequest) (RefundResponse, error) {
 	// TODO it's just a mock for the design, in real life it should have a proper implementation
-	return RefundResponse{OK: true}, nil
+	return RefundResponse{OK: true, ExternalID: fmt.Sprintf("my-payment-gateway-json-refund-%s", r.ID)}, nil
+}
+
+func (m *MyJSONPayments) UpdateRefundStatusRequestToInternal(request any) (UpdateRefundStatusRequest, error) {
+	req, ok := request.(*http.Request)
+	if !ok {
+		return UpdateRefundStatusRequest{}, fmt.Errorf("expected %T, given %T", req, request)
+	}
+
+	// TODO this layer is responsible for token/signature
+
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	var p struct {
+		ExternalID string                 `json:"external_id"`
+		Status     datastore.RefundStatus `json:"status"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		return UpdateRefundStatusRequest{}, fmt.Errorf("could not decode request: %w", err)
+	}
+
+	return UpdateRefundStatusRequest{
+		ExternalID: p.ExternalID,
+		Status:     p.Status,
+	}, nil
 }
 
 func (m *MyJSONPayments) SupportsRefund(r RefundRequest) bool {
-	return strings.HasPrefix(r.ExternalID, "my-payment-gateway-json-")
+	return m.Owns(r.ExternalID)
+}
+
+func (m *MyJSONPayments) Capabilities() Capability {
+	return CapabilityAuthorize | CapabilityCapture | CapabilityPartialCapture | CapabilityVoid | CapabilityCancel | CapabilityStatusQuery
+}
+
+func (m *MyJSONPayments) Capture(context.Context, CaptureRequest) (CaptureResponse, error) {
+	// TODO it's just a mock for the design, in real life it should have a proper implementation
+	return CaptureResponse{OK: true}, nil
+}
+
+func (m *MyJSONPayments) Void(context.Context, VoidRequest) (VoidResponse, error) {
+	// TODO it's just a mock for the design, in real life it should have a proper implementation
+	return VoidResponse{OK: true}, nil
+}
+
+func (m *MyJSONPayments) Cancel(context.Context, CancelRequest) (CancelResponse, error) {
+	// TODO it's just a mock for the design, in real life it should have a proper implementation
+	return CancelResponse{OK: true}, nil
+}
+
+func (m *MyJSONPayments) QueryStatus(ctx context.Context, r StatusRequest) (_ StatusResponse, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("MyJSONPayments.QueryStatus(%+q): %w", r.ExternalID, err)
+		}
+	}()
+
+	var cancel func()
+
+	ctx, cancel = context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf("%s/payments/%s", m.baseURL, url.PathEscape(r.ExternalID)),
+		nil,
+	)
+	if err != nil {
+		return StatusResponse{}, fmt.Errorf("could not build request: %w", err)
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return StatusResponse{}, fmt.Errorf("could not perform http request: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return StatusResponse{}, fmt.Errorf("invalid status code, %d given, %d expected", resp.StatusCode, http.StatusOK)
+	}
+
+	// the same statuses as in the webhook
+	var jsonResp struct {
+		Status datastore.PaymentStatus `json:"status"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
+		return StatusResponse{}, fmt.Errorf("corrupted response format")
+	}
+
+	return StatusResponse{Status: jsonResp.Status}, nil
+}
+
+func (m *MyJSONPayments) Owns(externalID string) bool {
+	return strings.HasPrefix(externalID, "my-payment-gateway-json-")
 }
@@ -2,13 +2,16 @@ package gateways_test
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"payments/currency"
+	"payments/datastore"
 	"payments/gateways"
 )
 
@@ -32,6 +35,74 @@ func TestMyJSONPayments_InitiatePayment(t *testing.T) {
 		require.EqualError(t, err, "MyJSONPayments.InitiatePayment: invalid status code, 500 given, 201 expected")
 	})
 
+	t.Run("Redirect", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Amount string `json:"amount"`
+			}
+
+			if r.URL.Path != "/initiate-payment" || json.NewDecoder(r.Body).Decode(&body) != nil || body.Amount != "50.00 AED" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"my-payment-gateway-json-id-1","redirect_url":"https://gateway.example.com/pay/1"}`))
+		}))
+
+		defer server.Close()
+
+		jsonPayments := gateways.NewMyJSONPayments(server.URL, http.DefaultClient, time.Second)
+		resp, err := jsonPayments.InitiatePayment(context.Background(), gateways.InitiateRequest{
+			Amount: currency.MustNewAmount(currency.AED, 50, 0),
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "my-payment-gateway-json-id-1", resp.ExternalID)
+		assert.True(t, jsonPayments.Owns(resp.ExternalID))
+		assert.Equal(t, &gateways.NextAction{Type: gateways.NextActionRedirect, RedirectURL: "https://gateway.example.com/pay/1"}, resp.NextAction)
+	})
+
+	t.Run("No action", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"my-payment-gateway-json-id-2"}`))
+		}))
+
+		defer server.Close()
+
+		jsonPayments := gateways.NewMyJSONPayments(server.URL, http.DefaultClient, time.Second)
+		resp, err := jsonPayments.InitiatePayment(context.Background(), gateways.InitiateRequest{
+			Amount: currency.MustNewAmount(currency.AED, 50, 0),
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "my-payment-gateway-json-id-2", resp.ExternalID)
+		assert.Nil(t, resp.NextAction)
+	})
+
+	t.Run("Corrupted response", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{}`))
+		}))
+
+		defer server.Close()
+
+		jsonPayments := gateways.NewMyJSONPayments(server.URL, http.DefaultClient, time.Second)
+		_, err := jsonPayments.InitiatePayment(context.Background(), gateways.InitiateRequest{
+			Amount: currency.MustNewAmount(currency.AED, 50, 0),
+		})
+
+		require.EqualError(t, err, "MyJSONPayments.InitiatePayment: empty payment ID in the response")
+	})
+
 	t.Run("Timeout", func(t *testing.T) {
 		t.Parallel()
 
@@ -50,3 +121,27 @@ func TestMyJSONPayments_InitiatePayment(t *testing.T) {
 		require.ErrorIs(t, err, context.DeadlineExceeded)
 	})
 }
+
+func TestMyJSONPayments_QueryStatus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/payments/my-payment-gateway-json-id-123" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"status":"paid"}`))
+	}))
+
+	defer server.Close()
+
+	jsonPayments := gateways.NewMyJSONPayments(server.URL, http.DefaultClient, time.Second)
+
+	resp, err := jsonPayments.QueryStatus(context.Background(), gateways.StatusRequest{ExternalID: "my-payment-gateway-json-id-123"})
+	require.NoError(t, err)
+	require.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), resp.Status)
+
+	_, err = jsonPayments.QueryStatus(context.Background(), gateways.StatusRequest{ExternalID: "unknown"})
+	require.EqualError(t, err, `MyJSONPayments.QueryStatus("unknown"): invalid status code, 404 given, 200 expected`)
+}
@@ -2,7 +2,7 @@ package gateways
 
 import (
 	"context"
-	"errors"
+	"fmt"
 )
 
 type RefunderChain struct {
@@ -11,12 +11,23 @@ type RefunderChain struct {
 
 func (r RefunderChain) Refund(ctx context.Context, req RefundRequest) (RefundResponse, error) {
 	for _, g := range r.gateways {
-		if g.SupportsRefund(req) {
-			return g.Refund(ctx, req)
+		if !g.SupportsRefund(req) {
+			continue
 		}
+
+		resp, err := g.Refund(ctx, req)
+		if err != nil {
+			return RefundResponse{}, err
+		}
+
+		if resp.OK {
+			resp.Fee = feesOf(g, req.MerchantID).RefundFee(req.Amount)
+		}
+
+		return resp, nil
 	}
 
-	return RefundResponse{}, errors.New("refund request not supported")
+	return RefundResponse{}, fmt.Errorf("refund of %+q: %w", req.ExternalID, ErrNotSupported)
 }
 
 func NewRefunderChain(gateways ...paymentRefunder) *RefunderChain {
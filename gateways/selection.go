@@ -0,0 +1,37 @@
+package gateways
+
+import (
+	"payments/currency"
+)
+
+// Candidate is an active gateway able to handle the request.
+type Candidate struct {
+	Gateway *CircuitBreaker
+	// EstimatedFee is the fee the gateway would charge for the request, see [FeeSchedule]
+	EstimatedFee currency.Amount
+}
+
+// SelectionStrategy picks the gateway handling the request, candidates are never empty,
+// and they're in the same order as gateways injected to [InitPaymentChain].
+type SelectionStrategy func([]Candidate) Candidate
+
+// SelectFirst picks the first candidate, it's the default strategy, so the order of gateways defines their priority.
+func SelectFirst(candidates []Candidate) Candidate {
+	return candidates[0]
+}
+
+// SelectCheapest picks the candidate with the lowest estimated fee,
+// ties are broken by the recent success rate (see [CircuitBreaker.SuccessRate]), and then by the order.
+func SelectCheapest(candidates []Candidate) Candidate {
+	best := candidates[0]
+
+	for _, c := range candidates[1:] {
+		fee, bestFee := c.EstimatedFee.ToFractional(), best.EstimatedFee.ToFractional()
+
+		if fee < bestFee || (fee == bestFee && c.Gateway.SuccessRate() > best.Gateway.SuccessRate()) {
+			best = c
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,101 @@
+package gateways_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/gateways"
+)
+
+func TestSelectCheapest(t *testing.T) {
+	t.Parallel()
+
+	fee := func(fractions uint) currency.Amount {
+		return currency.NewAmountFromFractions(currency.AED, fractions)
+	}
+
+	// outcomes are recorded in the rolling window of the circuit breaker, so every subtest records its own right before
+	// the selection, parallel subtests are deferred until the other tests in the package finish
+	breakers := func(t *testing.T) (reliable, failing, unused *gateways.CircuitBreaker) {
+		t.Helper()
+
+		reliable = gateways.NewCircuitBreaker(authorizerMock{name: "reliable"})
+		_, err := reliable.InitiatePayment(context.Background(), gateways.InitiateRequest{Amount: fee(100)})
+		require.NoError(t, err)
+
+		failing = gateways.NewCircuitBreaker(failingPaymentInitiator{})
+		_, err = failing.InitiatePayment(context.Background(), gateways.InitiateRequest{Amount: fee(100)})
+		require.Error(t, err)
+
+		return reliable, failing, gateways.NewCircuitBreaker(authorizerMock{name: "unused"})
+	}
+
+	t.Run("Lowest fee", func(t *testing.T) {
+		t.Parallel()
+
+		reliable, failing, _ := breakers(t)
+
+		selected := gateways.SelectCheapest([]gateways.Candidate{
+			{Gateway: reliable, EstimatedFee: fee(200)},
+			{Gateway: failing, EstimatedFee: fee(100)},
+		})
+		assert.Same(t, failing, selected.Gateway)
+	})
+
+	t.Run("Ties broken by success rate", func(t *testing.T) {
+		t.Parallel()
+
+		reliable, failing, unused := breakers(t)
+
+		selected := gateways.SelectCheapest([]gateways.Candidate{
+			{Gateway: failing, EstimatedFee: fee(100)},
+			{Gateway: reliable, EstimatedFee: fee(100)},
+		})
+		assert.Same(t, reliable, selected.Gateway)
+
+		// both have never failed
+		selected = gateways.SelectCheapest([]gateways.Candidate{
+			{Gateway: reliable, EstimatedFee: fee(100)},
+			{Gateway: unused, EstimatedFee: fee(100)},
+		})
+		assert.Same(t, reliable, selected.Gateway)
+	})
+}
+
+func TestInitPaymentChain_WithStrategy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := gateways.InitiateRequest{Amount: currency.MustNewAmount(currency.AED, 100, 0)}
+
+	expensive := feeChargingMock{
+		authorizerMock: authorizerMock{name: "expensive"},
+		fees:           gateways.FeeSchedule{"AED": {Tiers: []gateways.FeeTier{{Fee: gateways.Fee{BasisPoints: 300}}}}},
+	}
+	cheap := feeChargingMock{
+		authorizerMock: authorizerMock{name: "cheap"},
+		fees:           gateways.FeeSchedule{"AED": {Tiers: []gateways.FeeTier{{Fee: gateways.Fee{BasisPoints: 200}}}}},
+	}
+
+	resp, err := gateways.NewInitPaymentChain(expensive, cheap).InitiatePayment(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, "expensive-sale", resp.ExternalID)
+
+	resp, err = gateways.NewInitPaymentChain(expensive, cheap).WithStrategy(gateways.SelectCheapest).InitiatePayment(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, "cheap-sale", resp.ExternalID)
+	assert.Equal(t, uint(200), resp.Fee.ToFractional())
+
+	// the merchant can limit the gateways
+	r.Gateways = []string{"expensive"}
+	resp, err = gateways.NewInitPaymentChain(expensive, cheap).WithStrategy(gateways.SelectCheapest).InitiatePayment(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, "expensive-sale", resp.ExternalID)
+
+	r.Gateways = []string{"unknown"}
+	_, err = gateways.NewInitPaymentChain(expensive, cheap).InitiatePayment(ctx, r)
+	require.ErrorIs(t, err, gateways.ErrUnsupportedCurrency)
+}
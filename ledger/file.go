@@ -0,0 +1,115 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// File is the [InMemory] journal that survives restarts, every entry is appended to the file (and synced) before it's posted,
+// on start-up all the entries are loaded.
+//
+// Entries cannot be modified, so the file is never compacted.
+// It's designed for local development and small deployments, use a proper DB otherwise.
+type File struct {
+	*InMemory
+
+	file   *os.File
+	closed sync.Once
+}
+
+func NewFile(path string) (_ *File, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("NewFile(%+q): %w", path, err)
+		}
+	}()
+
+	f := &File{InMemory: NewInMemory()}
+
+	f.file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.load(); err != nil {
+		_ = f.file.Close()
+		return nil, err
+	}
+
+	f.journal = f.append
+
+	return f, nil
+}
+
+func (f *File) Close() (err error) {
+	f.closed.Do(func() {
+		err = f.file.Close()
+	})
+
+	return err
+}
+
+// append is used as the journal of the embedded [InMemory], so it's called under its write lock.
+func (f *File) append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not marshal the entry: %w", err)
+	}
+
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write the entry: %w", err)
+	}
+
+	// the entry is posted once the outbox message is acknowledged, so it must not be lost
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("could not sync the file: %w", err)
+	}
+
+	return nil
+}
+
+// load applies all the entries from the file, the torn last entry (a crash during the write) is truncated.
+func (f *File) load() error {
+	r := bufio.NewReader(f.file)
+	offset := int64(0)
+
+	for line := 1; ; line++ {
+		raw, readErr := r.ReadBytes('\n')
+		if errors.Is(readErr, io.EOF) && len(raw) == 0 {
+			return nil
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return readErr
+		}
+
+		var e Entry
+		decodeErr := json.Unmarshal(raw, &e)
+
+		if readErr != nil {
+			// the entry without the trailing new line hasn't been synced, so it hasn't been posted
+			log.Default().Println(fmt.Sprintf("ledger.File: truncating torn entry at line %d", line))
+
+			return f.file.Truncate(offset)
+		}
+
+		if decodeErr == nil {
+			decodeErr = e.validate()
+		}
+
+		if decodeErr != nil {
+			return fmt.Errorf("corrupted entry at line %d: %w", line, decodeErr)
+		}
+
+		if _, ok := f.ids[e.ID]; !ok {
+			f.apply(e)
+		}
+
+		offset += int64(len(raw))
+	}
+}
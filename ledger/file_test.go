@@ -0,0 +1,99 @@
+package ledger_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/ledger"
+)
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	aed := currency.NewAmountFromFractions(currency.AED, 1000)
+	postings := []ledger.Posting{
+		{Account: ledger.GatewayClearing, Direction: ledger.Debit, Amount: aed},
+		{Account: ledger.MerchantReceivable, Direction: ledger.Credit, Amount: aed},
+	}
+
+	t.Run("Restart", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "ledger.jsonl")
+		paymentID := uuid.New()
+
+		journal, err := ledger.NewFile(path)
+		require.NoError(t, err)
+		require.NoError(t, journal.Post(ctx, ledger.Entry{ID: "1", PaymentID: paymentID, Description: "payment paid", Postings: postings}))
+		require.NoError(t, journal.Close())
+
+		// the crash during the write of the next entry
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"ID":"2","Postings":[`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		restarted, err := ledger.NewFile(path)
+		require.NoError(t, err)
+		defer restarted.Close()
+
+		require.ErrorIs(t, restarted.Post(ctx, ledger.Entry{ID: "1", Postings: postings}), ledger.ErrDuplicate)
+
+		entries, err := restarted.Entries(ctx, paymentID)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "payment paid", entries[0].Description)
+
+		balance, err := restarted.Balance(ctx, ledger.MerchantReceivable, currency.AED)
+		require.NoError(t, err)
+		assert.Equal(t, aed, balance.Credit)
+
+		// the torn entry is truncated, so the next one is readable
+		require.NoError(t, restarted.Post(ctx, ledger.Entry{ID: "2", PaymentID: paymentID, Postings: postings}))
+		require.NoError(t, restarted.Close())
+
+		again, err := ledger.NewFile(path)
+		require.NoError(t, err)
+		defer again.Close()
+
+		entries, err = again.Entries(ctx, paymentID)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+		require.NoError(t, again.Check(ctx))
+	})
+
+	t.Run("Write failure", func(t *testing.T) {
+		t.Parallel()
+
+		paymentID := uuid.New()
+
+		journal, err := ledger.NewFile(filepath.Join(t.TempDir(), "ledger.jsonl"))
+		require.NoError(t, err)
+		require.NoError(t, journal.Close())
+
+		// the entry is not posted, so the outbox relay publishes the event again
+		require.Error(t, journal.Post(ctx, ledger.Entry{ID: "1", PaymentID: paymentID, Postings: postings}))
+
+		entries, err := journal.Entries(ctx, paymentID)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Corrupted file", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "ledger.jsonl")
+		require.NoError(t, os.WriteFile(path, []byte("{\n{}\n"), 0o644))
+
+		_, err := ledger.NewFile(path)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,239 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+)
+
+type Account string
+
+const (
+	// MerchantReceivable is what we owe merchants, it's credited when the customer pays.
+	MerchantReceivable Account = "merchant_receivable"
+	// GatewayClearing is the money held by gateways until the settlement.
+	GatewayClearing Account = "gateway_clearing"
+	// Fees charged by gateways.
+	Fees Account = "fees"
+	// Refunds returned to customers, it reduces [MerchantReceivable].
+	Refunds Account = "refunds"
+)
+
+type Direction string
+
+const (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+var (
+	// ErrUnbalanced is returned when debits do not equal credits.
+	ErrUnbalanced = errors.New("unbalanced entry")
+	// ErrDuplicate is returned when the entry with the same ID has been already posted.
+	ErrDuplicate = errors.New("duplicate entry")
+)
+
+type Posting struct {
+	Account   Account
+	Direction Direction
+	Amount    currency.Amount
+}
+
+// Entry is the journal entry, once posted it cannot be modified.
+type Entry struct {
+	// ID makes posting idempotent, e.g. it's derived from the event that caused the entry
+	ID          string
+	PaymentID   uuid.UUID
+	Description string
+	PostedAt    time.Time
+	Postings    []Posting
+}
+
+// validate checks that the entry is balanced in every currency.
+func (e Entry) validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings expected", ErrUnbalanced)
+	}
+
+	totals := make(map[string]int64)
+
+	for _, p := range e.Postings {
+		if p.Amount.IsZero() {
+			return fmt.Errorf("%w: zero amount posted to %+q", ErrUnbalanced, p.Account)
+		}
+
+		switch p.Direction {
+		case Debit:
+			totals[p.Amount.Currency.Code] += int64(p.Amount.ToFractional())
+		case Credit:
+			totals[p.Amount.Currency.Code] -= int64(p.Amount.ToFractional())
+		default:
+			return fmt.Errorf("unknown direction %+q", p.Direction)
+		}
+	}
+
+	for code, total := range totals {
+		if total != 0 {
+			return fmt.Errorf("%w: %s differs by %d", ErrUnbalanced, code, total)
+		}
+	}
+
+	return nil
+}
+
+// Balance is the sum of debits and credits of the account in the given currency.
+type Balance struct {
+	Account Account
+	Debit   currency.Amount
+	Credit  currency.Amount
+}
+
+type totals struct {
+	debit  uint
+	credit uint
+}
+
+type balanceKey struct {
+	account  Account
+	currency string
+}
+
+// InMemory is the append-only journal.
+type InMemory struct {
+	locker    *sync.RWMutex
+	entries   []Entry
+	ids       map[string]struct{}
+	balances  map[balanceKey]totals
+	byPayment map[uuid.UUID][]int
+	now       func() time.Time
+	// journal stores the entry before it's applied, see [NewFile], it's nil for the in-memory journal
+	journal func(Entry) error
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{
+		locker:    &sync.RWMutex{},
+		ids:       make(map[string]struct{}),
+		balances:  make(map[balanceKey]totals),
+		byPayment: make(map[uuid.UUID][]int),
+		now:       time.Now,
+	}
+}
+
+func (i *InMemory) Post(_ context.Context, e Entry) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemory.Post(%+q): %w", e.ID, err)
+		}
+	}()
+
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	if _, ok := i.ids[e.ID]; ok {
+		return ErrDuplicate
+	}
+
+	if e.PostedAt.IsZero() {
+		e.PostedAt = i.now().UTC()
+	}
+
+	// the caller must not be able to modify the posted entry
+	e.Postings = slices.Clone(e.Postings)
+
+	if i.journal != nil {
+		if err := i.journal(e); err != nil {
+			return err
+		}
+	}
+
+	i.apply(e)
+
+	return nil
+}
+
+// apply must be called under the write lock, the entry is already validated.
+func (i *InMemory) apply(e Entry) {
+	for _, p := range e.Postings {
+		k := balanceKey{account: p.Account, currency: p.Amount.Currency.Code}
+		t := i.balances[k]
+
+		if p.Direction == Debit {
+			t.debit += p.Amount.ToFractional()
+		} else {
+			t.credit += p.Amount.ToFractional()
+		}
+
+		i.balances[k] = t
+	}
+
+	i.ids[e.ID] = struct{}{}
+	i.byPayment[e.PaymentID] = append(i.byPayment[e.PaymentID], len(i.entries))
+	i.entries = append(i.entries, e)
+}
+
+func (i *InMemory) Balance(_ context.Context, account Account, c currency.Currency) (Balance, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	t := i.balances[balanceKey{account: account, currency: c.Code}]
+
+	return Balance{
+		Account: account,
+		Debit:   currency.NewAmountFromFractions(c, t.debit),
+		Credit:  currency.NewAmountFromFractions(c, t.credit),
+	}, nil
+}
+
+// Entries returns the entries of the given payment in the posting order.
+func (i *InMemory) Entries(_ context.Context, paymentID uuid.UUID) ([]Entry, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	entries := make([]Entry, 0, len(i.byPayment[paymentID]))
+	for _, n := range i.byPayment[paymentID] {
+		e := i.entries[n]
+		e.Postings = slices.Clone(e.Postings)
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// Check verifies that every entry is balanced, and total debits equal total credits in every currency.
+func (i *InMemory) Check(_ context.Context) error {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	for _, e := range i.entries {
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("InMemory.Check: entry %+q: %w", e.ID, err)
+		}
+	}
+
+	sums := make(map[string]totals)
+	for k, t := range i.balances {
+		s := sums[k.currency]
+		s.debit += t.debit
+		s.credit += t.credit
+		sums[k.currency] = s
+	}
+
+	for code, s := range sums {
+		if s.debit != s.credit {
+			return fmt.Errorf("InMemory.Check: %w: %s debits %d, credits %d", ErrUnbalanced, code, s.debit, s.credit)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package ledger_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/ledger"
+	"payments/outbox"
+)
+
+func TestInMemory_Post(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	journal := ledger.NewInMemory()
+	aed := currency.NewAmountFromFractions(currency.AED, 1000)
+
+	postings := []ledger.Posting{
+		{Account: ledger.GatewayClearing, Direction: ledger.Debit, Amount: aed},
+		{Account: ledger.MerchantReceivable, Direction: ledger.Credit, Amount: aed},
+	}
+
+	require.NoError(t, journal.Post(ctx, ledger.Entry{ID: "1", Postings: postings}))
+	require.ErrorIs(t, journal.Post(ctx, ledger.Entry{ID: "1", Postings: postings}), ledger.ErrDuplicate)
+
+	// postings are copied, so it does not change the posted entry, see the balance below
+	postings[0].Amount = currency.NewAmountFromFractions(currency.AED, 1)
+	require.ErrorIs(t, journal.Post(ctx, ledger.Entry{ID: "2", Postings: postings}), ledger.ErrUnbalanced)
+
+	// the same amount, but in different currencies
+	require.ErrorIs(t, journal.Post(ctx, ledger.Entry{ID: "3", Postings: []ledger.Posting{
+		{Account: ledger.GatewayClearing, Direction: ledger.Debit, Amount: aed},
+		{Account: ledger.MerchantReceivable, Direction: ledger.Credit, Amount: currency.NewAmountFromFractions(currency.USD, 1000)},
+	}}), ledger.ErrUnbalanced)
+
+	require.ErrorIs(t, journal.Post(ctx, ledger.Entry{ID: "4", Postings: postings[:1]}), ledger.ErrUnbalanced)
+
+	balance, err := journal.Balance(ctx, ledger.GatewayClearing, currency.AED)
+	require.NoError(t, err)
+	assert.Equal(t, aed, balance.Debit)
+	assert.True(t, balance.Credit.IsZero())
+
+	balance, err = journal.Balance(ctx, ledger.GatewayClearing, currency.USD)
+	require.NoError(t, err)
+	assert.True(t, balance.Debit.IsZero())
+
+	require.NoError(t, journal.Check(ctx))
+}
+
+func TestPoster_Publish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := datastore.NewInMemoryPaymentRepository()
+	journal := ledger.NewInMemory()
+	relay := outbox.NewRelay(repo, ledger.NewPoster(journal, repo), 0, 100)
+
+	paymentFee, refundFee := currency.MustNewAmount(currency.AED, 2, 50), currency.MustNewAmount(currency.AED, 0, 50)
+
+	p := datastore.Payment{
+		ID:         uuid.New(),
+		ExternalID: "external-1",
+		Status:     datastore.PaymentInitiated,
+		Amount:     currency.MustNewAmount(currency.AED, 100, 0),
+		Fee:        &paymentFee,
+	}
+	require.NoError(t, repo.Create(ctx, p))
+	require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+
+	refund := datastore.Refund{ID: uuid.New(), Amount: currency.MustNewAmount(currency.AED, 30, 0)}
+	require.NoError(t, repo.CreateRefund(ctx, p.ID, refund))
+	require.NoError(t, repo.UpdateRefund(ctx, p.ID, refund.ID, datastore.RefundUpdate{Status: datastore.RefundSucceeded, Fee: &refundFee}))
+
+	require.NoError(t, relay.RelayOnce(ctx))
+
+	// redelivered events are posted once
+	redelivered := datastore.OutboxMessage{Seq: 2, Event: datastore.Event{PaymentID: p.ID, Version: 2, Type: datastore.EventPaymentPaid}}
+	require.NoError(t, ledger.NewPoster(journal, repo).Publish(ctx, redelivered))
+
+	entries, err := journal.Entries(ctx, p.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "payment paid", entries[0].Description)
+
+	balances := make(map[ledger.Account]ledger.Balance)
+	for _, a := range []ledger.Account{ledger.GatewayClearing, ledger.MerchantReceivable, ledger.Refunds, ledger.Fees} {
+		balances[a], err = journal.Balance(ctx, a, currency.AED)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, uint(10000), balances[ledger.MerchantReceivable].Credit.ToFractional())
+	assert.Equal(t, uint(3000), balances[ledger.Refunds].Debit.ToFractional())
+	assert.Equal(t, uint(10000), balances[ledger.GatewayClearing].Debit.ToFractional())
+	assert.Equal(t, uint(3000+250+50), balances[ledger.GatewayClearing].Credit.ToFractional())
+	assert.Equal(t, uint(250+50), balances[ledger.Fees].Debit.ToFractional())
+
+	require.NoError(t, journal.Check(ctx))
+}
@@ -0,0 +1,119 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/currency"
+	"payments/datastore"
+)
+
+type journal interface {
+	Post(context.Context, Entry) error
+}
+
+type paymentsGetter interface {
+	GetByID(_ context.Context, id uuid.UUID) (datastore.Payment, error)
+}
+
+// Poster posts journal entries for the payment events, it's the [outbox.Publisher].
+//
+// Paid payments are debited to [GatewayClearing] and credited to [MerchantReceivable],
+// successful refunds are debited to [Refunds] and credited to [GatewayClearing].
+// Fees charged by the gateway are debited to [Fees] and credited to [GatewayClearing] in the same entry.
+// Events can be delivered many times, the entry ID is derived from the event, so it's posted once.
+type Poster struct {
+	journal    journal
+	repository paymentsGetter
+}
+
+func NewPoster(journal journal, repository paymentsGetter) *Poster {
+	return &Poster{journal: journal, repository: repository}
+}
+
+func (p *Poster) Publish(ctx context.Context, m datastore.OutboxMessage) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Poster.Publish(%d): %w", m.Seq, err)
+		}
+	}()
+
+	e := m.Event
+
+	switch e.Type {
+	case datastore.EventPaymentPaid, datastore.EventPaymentCaptured, datastore.EventPaymentPaidAfterCancel,
+		datastore.EventPaymentRefunded, datastore.EventRefundSucceeded:
+	default:
+		return nil
+	}
+
+	payment, err := p.repository.GetByID(ctx, e.PaymentID)
+	if err != nil {
+		return fmt.Errorf("could not fetch payment: %w", err)
+	}
+
+	var (
+		amount      currency.Amount
+		fee         *currency.Amount
+		description string
+		postings    func(currency.Amount) []Posting
+	)
+
+	switch e.Type {
+	case datastore.EventPaymentPaid, datastore.EventPaymentPaidAfterCancel:
+		amount, fee, description, postings = payment.Amount, payment.Fee, "payment paid", paid
+	case datastore.EventPaymentCaptured:
+		amount, fee, description, postings = *e.Amount, payment.Fee, "payment captured", paid
+	case datastore.EventPaymentRefunded:
+		// refunded before we introduced refund records
+		amount, description, postings = payment.CapturedAmount(), "payment refunded", refunded
+	case datastore.EventRefundSucceeded:
+		r, ok := payment.Refund(*e.RefundID)
+		if !ok {
+			return fmt.Errorf("unknown refund %+q", *e.RefundID)
+		}
+
+		amount, fee, description, postings = r.Amount, r.Fee, fmt.Sprintf("refund %s succeeded", r.ID), refunded
+	}
+
+	entryPostings := postings(amount)
+	if fee != nil && !fee.IsZero() {
+		entryPostings = append(entryPostings, charged(*fee)...)
+	}
+
+	err = p.journal.Post(ctx, Entry{
+		ID:          fmt.Sprintf("%s:%d", e.PaymentID, e.Version),
+		PaymentID:   e.PaymentID,
+		Description: description,
+		PostedAt:    e.OccurredAt,
+		Postings:    entryPostings,
+	})
+	if errors.Is(err, ErrDuplicate) {
+		return nil
+	}
+
+	return err
+}
+
+func paid(amount currency.Amount) []Posting {
+	return []Posting{
+		{Account: GatewayClearing, Direction: Debit, Amount: amount},
+		{Account: MerchantReceivable, Direction: Credit, Amount: amount},
+	}
+}
+
+func refunded(amount currency.Amount) []Posting {
+	return []Posting{
+		{Account: Refunds, Direction: Debit, Amount: amount},
+		{Account: GatewayClearing, Direction: Credit, Amount: amount},
+	}
+}
+
+func charged(fee currency.Amount) []Posting {
+	return []Posting{
+		{Account: Fees, Direction: Debit, Amount: fee},
+		{Account: GatewayClearing, Direction: Credit, Amount: fee},
+	}
+}
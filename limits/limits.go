@@ -0,0 +1,226 @@
+package limits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+	"payments/ratelimit"
+)
+
+var (
+	ErrAmountTooSmall       = errors.New("amount is below the minimum")
+	ErrAmountTooLarge       = errors.New("amount exceeds the maximum")
+	ErrDailyLimitExceeded   = errors.New("daily limit of the merchant exceeded")
+	ErrMonthlyLimitExceeded = errors.New("monthly limit of the merchant exceeded")
+	ErrVelocityExceeded     = errors.New("too many payments of the customer")
+)
+
+// CurrencyLimits are amounts in fractions, zero means unlimited.
+type CurrencyLimits struct {
+	// Min and Max are applied to every payment
+	Min uint `json:"min"`
+	Max uint `json:"max"`
+	// Daily and Monthly cap the volume of the merchant (UTC days and months)
+	Daily   uint `json:"daily"`
+	Monthly uint `json:"monthly"`
+}
+
+// Rules are applied to payments of the merchant.
+type Rules struct {
+	// Currencies by code (e.g. "AED"), currencies without limits are not limited
+	Currencies map[string]CurrencyLimits `json:"currencies"`
+	// CustomerPaymentsPerHour limits payments of the customer of the merchant (UTC hours), zero means unlimited
+	CustomerPaymentsPerHour uint `json:"customer_payments_per_hour"`
+}
+
+// Config is loaded from the file, so limits can be changed without the release.
+type Config struct {
+	Default Rules `json:"default"`
+	// Merchants override the default rules (entirely, rules are not merged)
+	Merchants map[uuid.UUID]Rules `json:"merchants"`
+	// Quotas throttle the daily volume of every merchant, exceeded quotas are rate limits (the client retries the next day),
+	// they're enforced by the payment endpoint, see ratelimit.Quotas
+	Quotas ratelimit.Quotas `json:"quotas"`
+}
+
+// LoadConfig reads the JSON config, see limits.json in the root of the repository.
+func LoadConfig(path string) (_ Config, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("LoadConfig(%+q): %w", path, err)
+		}
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+
+	var c Config
+	if err := decoder.Decode(&c); err != nil {
+		return Config{}, err
+	}
+
+	return c, c.Validate()
+}
+
+func (c Config) Validate() error {
+	for code, l := range c.Default.Currencies {
+		if l.Max > 0 && l.Min > l.Max {
+			return fmt.Errorf("default %s: min is greater than max", code)
+		}
+	}
+
+	for id, rules := range c.Merchants {
+		for code, l := range rules.Currencies {
+			if l.Max > 0 && l.Min > l.Max {
+				return fmt.Errorf("merchant %s %s: min is greater than max", id, code)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c Config) rules(merchantID uuid.UUID) Rules {
+	if r, ok := c.Merchants[merchantID]; ok {
+		return r
+	}
+
+	return c.Default
+}
+
+type counter interface {
+	Consume(_ context.Context, key string, n, limit uint64, resetAt time.Time) error
+	Release(_ context.Context, key string, n uint64) error
+}
+
+// Payment is what the limits are evaluated for.
+type Payment struct {
+	MerchantID uuid.UUID
+	// CustomerID is optional, velocity is not checked without it
+	CustomerID string
+	Amount     currency.Amount
+}
+
+// Checker enforces the limits, counters are shared with the rate limiter, see [ratelimit.InMemory] and [ratelimit.SQL].
+type Checker struct {
+	config  Config
+	counter counter
+	now     func() time.Time
+}
+
+func NewChecker(config Config, counter counter) *Checker {
+	return &Checker{config: config, counter: counter, now: time.Now}
+}
+
+// Reservation holds the volume consumed by the payment, it's released when the payment could not be initiated.
+type Reservation struct {
+	counter  counter
+	reserved []reserved
+}
+
+// limitCounter consumes n from the counter of the key, err is returned when the limit is exceeded.
+type limitCounter struct {
+	limit   uint
+	key     string
+	n       uint64
+	resetAt time.Time
+	err     error
+}
+
+type reserved struct {
+	key string
+	n   uint64
+}
+
+// Release gives back everything consumed by the reservation, it's safe to call for the empty reservation.
+func (r Reservation) Release(ctx context.Context) error {
+	var errs []error
+
+	for _, x := range r.reserved {
+		if err := r.counter.Release(ctx, x.key, x.n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reserve checks the payment against the limits of the merchant, and consumes its volume.
+// The error wraps one of ErrAmountTooSmall, ErrAmountTooLarge, ErrDailyLimitExceeded, ErrMonthlyLimitExceeded
+// or ErrVelocityExceeded when the payment is not allowed.
+func (c *Checker) Reserve(ctx context.Context, p Payment) (_ Reservation, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Checker.Reserve(%+q): %w", p.MerchantID, err)
+		}
+	}()
+
+	rules := c.config.rules(p.MerchantID)
+	code := p.Amount.Currency.Code
+	amount := p.Amount.ToFractional()
+	l := rules.Currencies[code]
+
+	if amount < l.Min {
+		return Reservation{}, fmt.Errorf("%w: %s", ErrAmountTooSmall, currency.NewAmountFromFractions(p.Amount.Currency, l.Min))
+	}
+
+	if l.Max > 0 && amount > l.Max {
+		return Reservation{}, fmt.Errorf("%w: %s", ErrAmountTooLarge, currency.NewAmountFromFractions(p.Amount.Currency, l.Max))
+	}
+
+	now := c.now()
+	day, endOfDay := ratelimit.DailyWindow(now)
+	month, endOfMonth := ratelimit.MonthlyWindow(now)
+	hour, endOfHour := ratelimit.HourlyWindow(now)
+
+	counters := []limitCounter{
+		{l.Daily, fmt.Sprintf("limit:%s:%s:%s", p.MerchantID, code, day), uint64(amount), endOfDay, ErrDailyLimitExceeded},
+		{l.Monthly, fmt.Sprintf("limit:%s:%s:%s", p.MerchantID, code, month), uint64(amount), endOfMonth, ErrMonthlyLimitExceeded},
+	}
+
+	if p.CustomerID != "" {
+		counters = append(counters, limitCounter{rules.CustomerPaymentsPerHour, fmt.Sprintf("velocity:%s:%s:%s", p.MerchantID, p.CustomerID, hour), 1, endOfHour, ErrVelocityExceeded})
+	}
+
+	r := Reservation{counter: c.counter}
+
+	for _, x := range counters {
+		if x.limit == 0 {
+			continue
+		}
+
+		err := c.counter.Consume(ctx, x.key, x.n, uint64(x.limit), x.resetAt)
+		if err == nil {
+			r.reserved = append(r.reserved, reserved{key: x.key, n: x.n})
+			continue
+		}
+
+		if releaseErr := r.Release(ctx); releaseErr != nil {
+			err = fmt.Errorf("%w (could not release: %s)", err, releaseErr)
+		}
+
+		if errors.Is(err, ratelimit.ErrQuotaExceeded) {
+			// the limit is not the rate limit, the client must not retry the same payment
+			return Reservation{}, x.err
+		}
+
+		return Reservation{}, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,149 @@
+package limits_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/limits"
+	"payments/ratelimit"
+)
+
+func TestChecker_Reserve(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	vip := uuid.New()
+
+	config := limits.Config{
+		Default: limits.Rules{
+			Currencies: map[string]limits.CurrencyLimits{
+				"AED": {Min: 1_000, Max: 50_000, Daily: 100_000, Monthly: 150_000},
+			},
+			CustomerPaymentsPerHour: 2,
+		},
+		Merchants: map[uuid.UUID]limits.Rules{
+			vip: {Currencies: map[string]limits.CurrencyLimits{"AED": {Max: 1_000_000}}},
+		},
+	}
+
+	aed := func(fractions uint) currency.Amount {
+		return currency.NewAmountFromFractions(currency.AED, fractions)
+	}
+
+	t.Run("Amount", func(t *testing.T) {
+		t.Parallel()
+
+		checker := limits.NewChecker(config, ratelimit.NewInMemory())
+		merchantID := uuid.New()
+
+		_, err := checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, Amount: aed(999)})
+		require.ErrorIs(t, err, limits.ErrAmountTooSmall)
+
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, Amount: aed(50_001)})
+		require.ErrorIs(t, err, limits.ErrAmountTooLarge)
+
+		// the merchant has its own rules
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: vip, Amount: aed(999_999)})
+		require.NoError(t, err)
+
+		// currencies without limits are not limited
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, Amount: currency.NewAmountFromFractions(currency.USD, 1)})
+		require.NoError(t, err)
+	})
+
+	t.Run("Caps", func(t *testing.T) {
+		t.Parallel()
+
+		checker := limits.NewChecker(config, ratelimit.NewInMemory())
+		merchantID := uuid.New()
+
+		_, err := checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, Amount: aed(50_000)})
+		require.NoError(t, err)
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, Amount: aed(50_000)})
+		require.NoError(t, err)
+
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, Amount: aed(1_000)})
+		require.ErrorIs(t, err, limits.ErrDailyLimitExceeded)
+
+		// caps are counted per merchant
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: uuid.New(), Amount: aed(1_000)})
+		require.NoError(t, err)
+	})
+
+	t.Run("Monthly", func(t *testing.T) {
+		t.Parallel()
+
+		monthly := limits.Config{Default: limits.Rules{Currencies: map[string]limits.CurrencyLimits{"AED": {Monthly: 1_000}}}}
+		checker := limits.NewChecker(monthly, ratelimit.NewInMemory())
+
+		_, err := checker.Reserve(ctx, limits.Payment{MerchantID: vip, Amount: aed(1_000)})
+		require.NoError(t, err)
+
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: vip, Amount: aed(1)})
+		require.ErrorIs(t, err, limits.ErrMonthlyLimitExceeded)
+	})
+
+	t.Run("Velocity", func(t *testing.T) {
+		t.Parallel()
+
+		checker := limits.NewChecker(config, ratelimit.NewInMemory())
+		merchantID := uuid.New()
+
+		for range 2 {
+			_, err := checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, CustomerID: "customer-1", Amount: aed(1_000)})
+			require.NoError(t, err)
+		}
+
+		_, err := checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, CustomerID: "customer-1", Amount: aed(1_000)})
+		require.ErrorIs(t, err, limits.ErrVelocityExceeded)
+
+		// the rejected payment does not consume the daily cap
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, CustomerID: "customer-2", Amount: aed(50_000)})
+		require.NoError(t, err)
+		_, err = checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, Amount: aed(48_000)})
+		require.NoError(t, err)
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		t.Parallel()
+
+		checker := limits.NewChecker(config, ratelimit.NewInMemory())
+		merchantID := uuid.New()
+
+		r, err := checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, CustomerID: "customer-1", Amount: aed(50_000)})
+		require.NoError(t, err)
+		require.NoError(t, r.Release(ctx))
+
+		for range 2 {
+			_, err := checker.Reserve(ctx, limits.Payment{MerchantID: merchantID, CustomerID: "customer-1", Amount: aed(50_000)})
+			require.NoError(t, err)
+		}
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	// the config shipped with the service must be valid
+	c, err := limits.LoadConfig(filepath.Join("..", "limits.json"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, c.Default.Currencies)
+	assert.NotEmpty(t, c.Quotas)
+
+	path := filepath.Join(t.TempDir(), "limits.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"default":{"currencies":{"AED":{"min":200,"max":100}}}}`), 0o600))
+
+	_, err = limits.LoadConfig(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"default":{"currencies":{"AED":{"maximum":100}}}}`), 0o600))
+
+	_, err = limits.LoadConfig(path)
+	require.Error(t, err)
+}
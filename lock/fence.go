@@ -0,0 +1,54 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type leaseContextKey struct{}
+
+// NewContext returns the context of the work done under the given lease, storages fence the writes by it, see [Fence].
+func NewContext(ctx context.Context, l Lease) context.Context {
+	return context.WithValue(ctx, leaseContextKey{}, l)
+}
+
+// FromContext returns the lease the work is done under, see [NewContext].
+func FromContext(ctx context.Context) (Lease, bool) {
+	l, ok := ctx.Value(leaseContextKey{}).(Lease)
+	return l, ok
+}
+
+// Fence rejects the writes done under the lease that has been taken over by somebody else.
+//
+// The storage admits every write atomically with applying it (e.g. under its write lock),
+// it remembers the highest token admitted per key, so the holder of the expired lease cannot overwrite
+// the changes of the new holder. Tokens are kept in memory, it's enough for the storage living in the same process.
+type Fence struct {
+	tokens map[string]uint64
+	locker *sync.Mutex
+}
+
+func NewFence() *Fence {
+	return &Fence{tokens: make(map[string]uint64), locker: &sync.Mutex{}}
+}
+
+// Admit returns [ErrLeaseLost] when the lease from the context is older than the one already admitted for the same key.
+// Writes done without the lease (e.g. gateway webhooks) are always admitted.
+func (f *Fence) Admit(ctx context.Context) error {
+	l, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	if latest := f.tokens[l.Key]; l.Token < latest {
+		return fmt.Errorf("Fence.Admit(%+q): %w, token %d is older than %d", l.Key, ErrLeaseLost, l.Token, latest)
+	}
+
+	f.tokens[l.Key] = l.Token
+
+	return nil
+}
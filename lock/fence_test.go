@@ -0,0 +1,42 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"payments/lock"
+)
+
+func TestFence_Admit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	l := lock.NewInMemory(lock.Options{TTL: time.Millisecond * 10})
+	fence := lock.NewFence()
+
+	stale, err := l.Lock(ctx, "payment:1")
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 20)
+
+	current, err := l.Lock(ctx, "payment:1")
+	require.NoError(t, err)
+
+	// the stale holder can write until the new holder does
+	require.NoError(t, fence.Admit(lock.NewContext(ctx, stale)))
+	require.NoError(t, fence.Admit(lock.NewContext(ctx, current)))
+	require.NoError(t, fence.Admit(lock.NewContext(ctx, current)))
+	require.ErrorIs(t, fence.Admit(lock.NewContext(ctx, stale)), lock.ErrLeaseLost)
+
+	// keys are fenced independently, and writes without the lease are not fenced at all
+	other, err := l.Lock(ctx, "payment:2")
+	require.NoError(t, err)
+	require.NoError(t, fence.Admit(lock.NewContext(ctx, other)))
+	require.NoError(t, fence.Admit(ctx))
+
+	leased, ok := lock.FromContext(lock.NewContext(ctx, current))
+	require.True(t, ok)
+	require.Equal(t, current.Token, leased.Token)
+}
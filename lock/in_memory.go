@@ -0,0 +1,81 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type inMemoryEntry struct {
+	token     uint64
+	expiresAt time.Time
+	released  bool
+}
+
+// InMemory is an in-process implementation, it's useful for tests and single-instance deployments.
+type InMemory struct {
+	options Options
+	entries map[string]inMemoryEntry
+	locker  *sync.Mutex
+	now     func() time.Time
+}
+
+func NewInMemory(o Options) *InMemory {
+	return &InMemory{
+		options: o.withDefaults(),
+		entries: make(map[string]inMemoryEntry),
+		locker:  &sync.Mutex{},
+		now:     time.Now,
+	}
+}
+
+func (m *InMemory) Lock(ctx context.Context, key string) (_ Lease, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemory.Lock(%+q): %w", key, err)
+		}
+	}()
+
+	return acquire(ctx, m.options, func(context.Context) (Lease, bool, error) {
+		m.locker.Lock()
+		defer m.locker.Unlock()
+
+		now := m.now()
+		e, exists := m.entries[key]
+
+		if exists && !e.released && now.Before(e.expiresAt) {
+			return Lease{}, false, nil
+		}
+
+		e = inMemoryEntry{
+			token:     e.token + 1,
+			expiresAt: now.Add(m.options.TTL),
+		}
+		m.entries[key] = e
+
+		return Lease{
+			Key:       key,
+			Token:     e.token,
+			ExpiresAt: e.expiresAt,
+			release: func(context.Context) error {
+				return m.release(key, e.token)
+			},
+		}, true, nil
+	})
+}
+
+func (m *InMemory) release(key string, token uint64) error {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	e := m.entries[key]
+	if e.token != token {
+		return fmt.Errorf("InMemory.Unlock(%+q): %w", key, ErrLeaseLost)
+	}
+
+	e.released = true
+	m.entries[key] = e
+
+	return nil
+}
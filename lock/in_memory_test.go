@@ -0,0 +1,90 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"payments/lock"
+)
+
+func TestInMemory_Lock(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		l := lock.NewInMemory(lock.Options{TTL: time.Minute, AcquireTimeout: time.Millisecond * 50})
+
+		_, err := l.Lock(context.Background(), "payment:1")
+		require.NoError(t, err)
+
+		_, err = l.Lock(context.Background(), "payment:1")
+		require.ErrorIs(t, err, lock.ErrNotAcquired)
+
+		_, err = l.Lock(context.Background(), "payment:2")
+		require.NoError(t, err)
+	})
+
+	t.Run("Unlock", func(t *testing.T) {
+		t.Parallel()
+
+		l := lock.NewInMemory(lock.Options{TTL: time.Minute, AcquireTimeout: time.Second})
+
+		first, err := l.Lock(context.Background(), "payment:1")
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			_ = first.Unlock(context.Background())
+		}()
+
+		second, err := l.Lock(context.Background(), "payment:1")
+		require.NoError(t, err)
+		require.Greater(t, second.Token, first.Token)
+	})
+
+	t.Run("Expired lease", func(t *testing.T) {
+		t.Parallel()
+
+		l := lock.NewInMemory(lock.Options{TTL: time.Millisecond * 50, AcquireTimeout: time.Second})
+
+		first, err := l.Lock(context.Background(), "payment:1")
+		require.NoError(t, err)
+
+		second, err := l.Lock(context.Background(), "payment:1")
+		require.NoError(t, err)
+		require.Greater(t, second.Token, first.Token)
+
+		require.ErrorIs(t, first.Unlock(context.Background()), lock.ErrLeaseLost)
+		require.NoError(t, second.Unlock(context.Background()))
+	})
+
+	t.Run("Expired lease not taken over", func(t *testing.T) {
+		t.Parallel()
+
+		l := lock.NewInMemory(lock.Options{TTL: time.Millisecond * 10})
+
+		lease, err := l.Lock(context.Background(), "payment:1")
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond * 20)
+		require.NoError(t, lease.Unlock(context.Background()))
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		t.Parallel()
+
+		l := lock.NewInMemory(lock.Options{TTL: time.Minute, AcquireTimeout: time.Minute})
+
+		_, err := l.Lock(context.Background(), "payment:1")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = l.Lock(ctx, "payment:1")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
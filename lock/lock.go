@@ -0,0 +1,92 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotAcquired is returned when the lock could not be acquired before the acquire timeout.
+	ErrNotAcquired = errors.New("lock not acquired")
+	// ErrLeaseLost is returned when the lease expired and somebody else took over the lock.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Lease represents the ownership of the lock for the limited period of time (TTL).
+//
+// Token increases monotonically for the given key, so every holder gets its own one, and [Lease.Unlock] can tell
+// whether somebody else took over the lock. It's the fencing token as well, the work done under the lock passes the lease
+// to the storage by [NewContext], and the storage rejects the writes of the holder whose lease has been taken over, see [Fence].
+type Lease struct {
+	Key       string
+	Token     uint64
+	ExpiresAt time.Time
+	release   func(context.Context) error
+}
+
+// Unlock releases the lock. Unlocking the expired lease is a no-op unless somebody else has acquired the lock since,
+// then ErrLeaseLost is returned, because the work done under the lock could have overlapped with the new holder.
+func (l Lease) Unlock(ctx context.Context) error {
+	if l.release == nil {
+		return nil
+	}
+
+	return l.release(ctx)
+}
+
+// Options are shared across all the implementations.
+type Options struct {
+	// TTL defines how long the lease is valid, it protects us against crashed holders.
+	TTL time.Duration
+	// AcquireTimeout defines how long we wait for the lock, the context deadline wins if it's shorter.
+	AcquireTimeout time.Duration
+	// RetryInterval defines how often we retry to acquire the lock.
+	RetryInterval time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.TTL <= 0 {
+		o.TTL = time.Second * 30
+	}
+
+	if o.AcquireTimeout <= 0 {
+		o.AcquireTimeout = time.Second * 5
+	}
+
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = time.Millisecond * 20
+	}
+
+	return o
+}
+
+// acquire calls try until it succeeds, fails or the timeout is exceeded.
+func acquire(ctx context.Context, o Options, try func(context.Context) (Lease, bool, error)) (Lease, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.AcquireTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(o.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		l, ok, err := try(ctx)
+		if err != nil {
+			return Lease{}, err
+		}
+
+		if ok {
+			return l, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return Lease{}, ErrNotAcquired
+			}
+
+			return Lease{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLSchema creates the table used by [SQL], the dialect is PostgreSQL.
+const SQLSchema = `
+CREATE TABLE IF NOT EXISTS distributed_locks (
+    lock_key   TEXT PRIMARY KEY,
+    token      BIGINT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+)`
+
+// SQL implements leases using the rows in the same database we store the payments,
+// so we don't need any extra infrastructure.
+// The row is never deleted, so the fencing token keeps increasing for the given key.
+type SQL struct {
+	db      *sql.DB
+	options Options
+}
+
+func NewSQL(db *sql.DB, o Options) *SQL {
+	return &SQL{db: db, options: o.withDefaults()}
+}
+
+func (s *SQL) Lock(ctx context.Context, key string) (_ Lease, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("SQL.Lock(%+q): %w", key, err)
+		}
+	}()
+
+	const query = `
+INSERT INTO distributed_locks (lock_key, token, expires_at)
+VALUES ($1, 1, now() + $2 * interval '1 millisecond')
+ON CONFLICT (lock_key) DO UPDATE
+    SET token = distributed_locks.token + 1, expires_at = EXCLUDED.expires_at
+    WHERE distributed_locks.expires_at <= now()
+RETURNING token, expires_at`
+
+	return acquire(ctx, s.options, func(ctx context.Context) (Lease, bool, error) {
+		var (
+			token     uint64
+			expiresAt time.Time
+		)
+
+		err := s.db.QueryRowContext(ctx, query, key, s.options.TTL.Milliseconds()).Scan(&token, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the row exists and the lease is still valid
+			return Lease{}, false, nil
+		}
+		if err != nil {
+			return Lease{}, false, err
+		}
+
+		return Lease{
+			Key:       key,
+			Token:     token,
+			ExpiresAt: expiresAt,
+			release: func(ctx context.Context) error {
+				return s.release(ctx, key, token)
+			},
+		}, true, nil
+	})
+}
+
+func (s *SQL) release(ctx context.Context, key string, token uint64) error {
+	const query = `UPDATE distributed_locks SET expires_at = now() WHERE lock_key = $1 AND token = $2`
+
+	res, err := s.db.ExecContext(ctx, query, key, token)
+	if err != nil {
+		return fmt.Errorf("SQL.Unlock(%+q): %w", key, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("SQL.Unlock(%+q): %w", key, ErrLeaseLost)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+//go:build integration
+
+package lock_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/lock"
+)
+
+// schemaLocker serializes the schema creation, concurrent CREATE TABLE IF NOT EXISTS can fail in PostgreSQL.
+var schemaLocker sync.Mutex
+
+// openPostgres connects to the DB given by POSTGRES_DSN, see "make test-integration".
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_DSN")
+	require.NotEmpty(t, dsn, "POSTGRES_DSN is required by integration tests")
+
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	schemaLocker.Lock()
+	defer schemaLocker.Unlock()
+
+	_, err = db.ExecContext(context.Background(), lock.SQLSchema)
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestSQL_Lock(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := openPostgres(t)
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		// keys are unique, so the tests can share the DB
+		first, second := "payment:"+uuid.NewString(), "payment:"+uuid.NewString()
+		l := lock.NewSQL(db, lock.Options{TTL: time.Minute, AcquireTimeout: time.Millisecond * 50})
+
+		lease, err := l.Lock(ctx, first)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), lease.Token)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), lease.ExpiresAt, time.Second*5)
+
+		_, err = l.Lock(ctx, first)
+		require.ErrorIs(t, err, lock.ErrNotAcquired)
+
+		_, err = l.Lock(ctx, second)
+		require.NoError(t, err)
+	})
+
+	t.Run("Unlock", func(t *testing.T) {
+		t.Parallel()
+
+		key := "payment:" + uuid.NewString()
+		l := lock.NewSQL(db, lock.Options{TTL: time.Minute, AcquireTimeout: time.Second})
+
+		first, err := l.Lock(ctx, key)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			_ = first.Unlock(context.Background())
+		}()
+
+		second, err := l.Lock(ctx, key)
+		require.NoError(t, err)
+		require.Greater(t, second.Token, first.Token, "the row is kept, so the token keeps increasing")
+	})
+
+	t.Run("Expired lease", func(t *testing.T) {
+		t.Parallel()
+
+		key := "payment:" + uuid.NewString()
+		l := lock.NewSQL(db, lock.Options{TTL: time.Millisecond * 50, AcquireTimeout: time.Second})
+
+		first, err := l.Lock(ctx, key)
+		require.NoError(t, err)
+
+		second, err := l.Lock(ctx, key)
+		require.NoError(t, err)
+		require.Greater(t, second.Token, first.Token)
+
+		require.ErrorIs(t, first.Unlock(ctx), lock.ErrLeaseLost)
+		require.NoError(t, second.Unlock(ctx))
+
+		// the token of the SQL lease fences the writes as well
+		fence := lock.NewFence()
+		require.NoError(t, fence.Admit(lock.NewContext(ctx, second)))
+		require.ErrorIs(t, fence.Admit(lock.NewContext(ctx, first)), lock.ErrLeaseLost)
+	})
+
+	t.Run("Expired lease not taken over", func(t *testing.T) {
+		t.Parallel()
+
+		l := lock.NewSQL(db, lock.Options{TTL: time.Millisecond * 10})
+
+		lease, err := l.Lock(ctx, "payment:"+uuid.NewString())
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond * 20)
+		require.NoError(t, lease.Unlock(ctx))
+	})
+
+	t.Run("DB error", func(t *testing.T) {
+		t.Parallel()
+
+		closed := openPostgres(t)
+		require.NoError(t, closed.Close())
+
+		_, err := lock.NewSQL(closed, lock.Options{}).Lock(ctx, "payment:"+uuid.NewString())
+		require.Error(t, err)
+		require.NotErrorIs(t, err, lock.ErrNotAcquired)
+	})
+}
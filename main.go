@@ -2,25 +2,59 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/opentracing/opentracing-go"
+	"payments/currency"
 	"payments/datastore"
 	"payments/gateways"
+	"payments/ledger"
+	"payments/limits"
+	"payments/lock"
+	"payments/merchant"
+	"payments/outbox"
+	"payments/ratelimit"
+	"payments/reconciliation"
+	"payments/risk"
 	"payments/usecases/payment"
+	"payments/webhooks"
 )
 
 func main() {
+	// ctx is cancelled on shutdown, it stops all the background workers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// TODO inject proper tracer
 	opentracing.SetGlobalTracer(opentracing.NoopTracer{})
 
-	myJSONPayments := gateways.NewMyJSONPayments("https://httpstat.us/201", http.DefaultClient, time.Second*5)
+	// the gateway (or its sandbox) responds with {"id": "my-payment-gateway-json-...", "redirect_url": "..."}
+	myJSONPaymentsURL := os.Getenv("MY_JSON_PAYMENTS_URL")
+	if myJSONPaymentsURL == "" {
+		myJSONPaymentsURL = "http://localhost:8081"
+	}
+
+	// TODO fees agreed with the gateway should be loaded from the configuration
+	myJSONPayments := gateways.NewMyJSONPayments(myJSONPaymentsURL, http.DefaultClient, time.Second*5).WithFees(gateways.FeeSchedule{
+		"AED": {
+			Tiers: []gateways.FeeTier{
+				{FromVolume: 0, Fee: gateways.Fee{Fixed: 100, BasisPoints: 290, Min: 150}},
+				{FromVolume: 100_000_000, Fee: gateways.Fee{Fixed: 100, BasisPoints: 250, Min: 150}},
+			},
+			Refund: gateways.Fee{Fixed: 100},
+		},
+	})
 
 	/*
 		TODO
@@ -30,18 +64,157 @@ func main() {
 		once it's implemented, it can be injected, see the following comments:
 	*/
 
-	initiator := gateways.NewInitPaymentChain(myJSONPayments /*, mySOAPPayments*/)
+	initiator := gateways.NewInitPaymentChain(myJSONPayments /*, mySOAPPayments*/).WithStrategy(gateways.SelectCheapest)
 	refunder := gateways.NewRefunderChain(myJSONPayments /*, mySOAPPayments*/)
+	authorizations := gateways.NewAuthorizationChain(myJSONPayments)
+
+	// every gateway delivers settlement reports in its own format
+	settlements := []reconciliation.Source{
+		{Gateway: "my-json-payments", Owner: myJSONPayments, Parser: reconciliation.NewJSONParser()},
+		// {Gateway: "my-soap-payments", Owner: mySOAPPayments, Parser: reconciliation.NewCSVParser()},
+	}
+
+	// payments survive restarts, and the same directory is reconciled by the "reconcile" command
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := reconcile(ctx, os.Args[2:], dataDir, settlements); err != nil {
+			log.Fatalf("reconcile: %s", err)
+		}
+
+		return
+	}
+
+	// TODO replace by the repository backed by the DB
+	repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{
+		Dir:          dataDir,
+		Sync:         datastore.SyncInterval,
+		CompactAfter: 10_000,
+	})
+	if err != nil {
+		log.Fatalf("could not open payments: %s", err)
+	}
+
+	defer func() {
+		if err := repo.Close(); err != nil {
+			log.Printf("could not close payments: %s\n", err)
+		}
+	}()
+
+	// TODO merchants would be onboarded by the admin API and stored in the DB, the demo merchant is created for local development
+	merchants := merchant.NewInMemory()
+	if err := merchants.Create(ctx, merchant.Merchant{
+		ID:         uuid.MustParse("9b1f3c4e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"),
+		Name:       "Demo",
+		Currencies: []string{"AED"},
+		Gateways:   []string{myJSONPayments.Name()},
+	}); err != nil {
+		log.Fatalf("could not create the demo merchant: %s", err)
+	}
+
+	// merchant webhooks and the ledger are fed by the outbox relay, callback URLs are provided by merchants, so only public addresses are called
+	// subscriptions and deliveries are stored next to the payments, the relay acknowledges events once they're stored
+	dispatcher, err := webhooks.NewFileDispatcher(webhooks.NewHTTPClient(time.Second*5), webhooks.Options{}, filepath.Join(dataDir, "webhooks.json"))
+	if err != nil {
+		log.Fatalf("could not open webhooks: %s", err)
+	}
+
+	go dispatcher.Run(ctx, time.Second)
+	// TODO replace by the ledger backed by the DB
+	journal, err := ledger.NewFile(filepath.Join(dataDir, "ledger.jsonl"))
+	if err != nil {
+		log.Fatalf("could not open the ledger: %s", err)
+	}
+
+	defer func() {
+		if err := journal.Close(); err != nil {
+			log.Printf("could not close the ledger: %s\n", err)
+		}
+	}()
+
+	go outbox.NewRelay(repo, outbox.NewFanOut(dispatcher, ledger.NewPoster(journal, repo)), time.Second, 100).Run(ctx)
+
+	// TODO replace by lock.NewSQL once we have a proper DB, the in-memory lock works for a single instance only
+	locker := lock.NewInMemory(lock.Options{
+		TTL:            time.Second * 30,
+		AcquireTimeout: time.Second * 2,
+	})
+
+	// refunds are accepted by the HTTP endpoint, and submitted to the gateway in the background
+	refundProcessor := payment.NewRefundProcessor(payment.NewGatewayRefunderAdapter(refunder), repo, locker, payment.RefundProcessorOptions{})
+	go refundProcessor.Run(ctx, time.Second)
+
+	// customers have limited time to pay, abandoned payments are expired in the background
+	expirationPolicy := gateways.NewExpirationPolicy(time.Hour).WithTTL(myJSONPayments, time.Minute*30)
+	statusQuerier := payment.NewGatewayAuthorizationAdapter(authorizations)
+	expirer := payment.NewPaymentExpirer(statusQuerier, expirationPolicy, repo, locker, payment.PaymentExpirerOptions{})
+	go expirer.Run(ctx, time.Minute)
+
+	// webhooks can be lost, so we ask gateways for the status of aging payments as well
+	statusPoller := payment.NewStatusPoller(statusQuerier, repo, payment.NewEndpointStatusUpdater(repo), locker, payment.StatusPollerOptions{})
+	go statusPoller.Run(ctx, time.Minute)
 
-	repo := datastore.NewInMemoryPaymentRepository()
+	// TODO the directories would be configurable, settlement reports would be fetched from gateways (e.g. SFTP)
+	reconciliationJob := reconciliation.NewJob(
+		reconciliation.NewReconciler(repo),
+		settlements,
+		reconciliation.NewDirFetcher("settlements"),
+		reconciliation.NewDirWriter("reconciliation-reports"),
+		locker,
+		reconciliation.JobOptions{},
+	)
+	go reconciliationJob.Run(ctx, time.Hour)
+
+	// TODO rate limits would be configurable per merchant, limiter would be replaced by ratelimit.NewSQL to share limits across instances
+	limiter := ratelimit.NewInMemory()
+	writeLimit := ratelimit.Limit{Rate: 10, Burst: 20}
+	readLimit := ratelimit.Limit{Rate: 50, Burst: 100}
+
+	// transaction limits and daily quotas are configured outside the code, so they can be changed without the release
+	limitsPath := os.Getenv("LIMITS_CONFIG")
+	if limitsPath == "" {
+		limitsPath = "limits.json"
+	}
+
+	limitsConfig, err := limits.LoadConfig(limitsPath)
+	if err != nil {
+		log.Fatalf("could not load limits: %s", err)
+	}
+
+	// shared by the initiator and the reviewer, payments held for the review are counted once approved
+	limitsChecker := limits.NewChecker(limitsConfig, limiter)
+
+	// TODO blocklists and thresholds would be managed by the back office
+	riskEngine := risk.NewEngine(
+		risk.Blocklist("email", "fraud@example.com"),
+		risk.Blocklist("country", "XX"),
+		risk.AmountThreshold(currency.AED, 2_000_000, 0),
+		risk.Velocity(limiter, ratelimit.Limit{Rate: 3.0 / 3600, Burst: 3}),
+	)
 
 	mux := http.NewServeMux()
 	mux.Handle(
 		"/init-payment",
 		handlerWithTimeout( // add timeout
-			payment.NewHTTPEndpointInit( // make an http endpoint
-				payment.NewInitiatorTracingDecorator( // add tracing
-					payment.NewEndpointInitiator(payment.NewInitiatorAdapter(initiator), repo), // make an endpoint
+			merchant.NewHTTPAuthenticate( // authenticate the merchant
+				merchants,
+				merchant.ScopePaymentsWrite,
+				payment.NewHTTPRateLimit( // limit requests of the merchant
+					limiter,
+					"init-payment",
+					writeLimit,
+					payment.NewHTTPEndpointInit( // make an http endpoint
+						payment.NewInitiatorTracingDecorator( // add tracing
+							payment.NewInitiatorQuotaDecorator( // limit the daily volume
+								limiter,
+								limitsConfig.Quotas,
+								payment.NewEndpointInitiator(payment.NewInitiatorAdapter(initiator), repo, locker).WithLimits(limitsChecker).WithRisk(riskEngine), // make an endpoint
+							),
+						),
+					),
 				),
 			),
 			time.Second*5,
@@ -59,17 +232,154 @@ func main() {
 			time.Second,
 		),
 	)
+	mux.Handle(
+		"/external/json-refund-webhook",
+		handlerWithTimeout( // add timeout
+			payment.NewHTTPUpdateRefundStatus( // make an http endpoint
+				payment.NewRefundUpdaterTracingDecorator( // add tracing
+					payment.NewEndpointRefundStatusUpdater(repo), // make an endpoint
+				),
+				myJSONPayments,
+			),
+			time.Second,
+		),
+	)
 	mux.Handle(
 		"/refund",
 		handlerWithTimeout( // add timeout
-			payment.NewHTTPRefund( // make an http endpoint
-				payment.NewRefunderTracingDecorator( // add tracing
-					payment.NewEndpointRefunder(payment.NewGatewayRefunderAdapter(refunder), repo), // make an endpoint
+			merchant.NewHTTPAuthenticate( // authenticate the merchant
+				merchants,
+				merchant.ScopeRefundsWrite,
+				payment.NewHTTPRateLimit( // limit requests of the merchant
+					limiter,
+					"refund",
+					writeLimit,
+					payment.NewHTTPRefund( // make an http endpoint
+						payment.NewRefunderTracingDecorator( // add tracing
+							payment.NewEndpointRefunder(repo, locker), // make an endpoint
+						),
+					),
+				),
+			),
+			time.Second*5,
+		),
+	)
+	mux.Handle(
+		"POST /payments/{id}/capture",
+		handlerWithTimeout( // add timeout
+			merchant.NewHTTPAuthenticate( // authenticate the merchant
+				merchants,
+				merchant.ScopePaymentsWrite,
+				payment.NewHTTPRateLimit( // limit requests of the merchant
+					limiter,
+					"capture",
+					writeLimit,
+					payment.NewHTTPCapture( // make an http endpoint
+						payment.NewCapturerTracingDecorator( // add tracing
+							payment.NewEndpointCapturer(payment.NewGatewayAuthorizationAdapter(authorizations), repo, locker), // make an endpoint
+						),
+					),
 				),
 			),
 			time.Second*5,
 		),
 	)
+	mux.Handle(
+		"POST /payments/{id}/void",
+		handlerWithTimeout( // add timeout
+			merchant.NewHTTPAuthenticate( // authenticate the merchant
+				merchants,
+				merchant.ScopePaymentsWrite,
+				payment.NewHTTPRateLimit( // limit requests of the merchant
+					limiter,
+					"void",
+					writeLimit,
+					payment.NewHTTPVoid( // make an http endpoint
+						payment.NewVoiderTracingDecorator( // add tracing
+							payment.NewEndpointVoider(payment.NewGatewayAuthorizationAdapter(authorizations), repo, locker), // make an endpoint
+						),
+					),
+				),
+			),
+			time.Second*5,
+		),
+	)
+	mux.Handle(
+		"POST /payments/{id}/cancel",
+		handlerWithTimeout( // add timeout
+			merchant.NewHTTPAuthenticate( // authenticate the merchant
+				merchants,
+				merchant.ScopePaymentsWrite,
+				payment.NewHTTPRateLimit( // limit requests of the merchant
+					limiter,
+					"cancel",
+					writeLimit,
+					payment.NewHTTPCancel( // make an http endpoint
+						payment.NewCancellerTracingDecorator( // add tracing
+							payment.NewEndpointCanceller(payment.NewGatewayAuthorizationAdapter(authorizations), repo, locker), // make an endpoint
+						),
+					),
+				),
+			),
+			time.Second*5,
+		),
+	)
+	mux.Handle(
+		"GET /payments/{id}",
+		handlerWithTimeout( // add timeout
+			merchant.NewHTTPAuthenticate( // authenticate the merchant
+				merchants,
+				merchant.ScopePaymentsRead,
+				payment.NewHTTPRateLimit( // limit requests of the merchant
+					limiter,
+					"get-payment",
+					readLimit,
+					payment.NewHTTPGetPayment( // make an http endpoint
+						payment.NewGetterTracingDecorator( // add tracing
+							payment.NewEndpointGetter(repo), // make an endpoint
+						),
+					),
+				),
+			),
+			time.Second,
+		),
+	)
+	mux.Handle(
+		"GET /payments",
+		handlerWithTimeout( // add timeout
+			merchant.NewHTTPAuthenticate( // authenticate the merchant
+				merchants,
+				merchant.ScopePaymentsRead,
+				payment.NewHTTPRateLimit( // limit requests of the merchant
+					limiter,
+					"list-payments",
+					readLimit,
+					payment.NewHTTPListPayments( // make an http endpoint
+						payment.NewListerTracingDecorator( // add tracing
+							payment.NewEndpointLister(repo), // make an endpoint
+						),
+					),
+				),
+			),
+			time.Second*5,
+		),
+	)
+	mux.Handle("POST /webhooks", merchant.NewHTTPAuthenticate(merchants, merchant.ScopeWebhooksWrite, webhooks.NewHTTPSubscribe(dispatcher)))
+	mux.Handle("GET /webhooks/deliveries", merchant.NewHTTPAuthenticate(merchants, merchant.ScopeWebhooksRead, webhooks.NewHTTPDeliveries(dispatcher)))
+	mux.Handle("POST /webhooks/deliveries/{id}/redeliver", merchant.NewHTTPAuthenticate(merchants, merchant.ScopeWebhooksWrite, webhooks.NewHTTPRedeliver(dispatcher)))
+
+	// the back office issues and revokes API keys of merchants, the admin API is disabled without the token
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		mux.Handle("POST /admin/merchants/{id}/keys", merchant.NewHTTPAdmin(token, merchant.NewHTTPCreateKey(merchants)))
+		mux.Handle("GET /admin/merchants/{id}/keys", merchant.NewHTTPAdmin(token, merchant.NewHTTPListKeys(merchants)))
+		mux.Handle("POST /admin/merchants/{id}/keys/{key_id}/revoke", merchant.NewHTTPAdmin(token, merchant.NewHTTPRevokeKey(merchants)))
+
+		// payments held by the risk evaluation wait for the manual approval
+		reviewer := payment.NewReviewerTracingDecorator(payment.NewEndpointReviewer(payment.NewInitiatorAdapter(initiator), repo, merchants, locker).WithLimits(limitsChecker))
+		mux.Handle("GET /admin/reviews", merchant.NewHTTPAdmin(token, payment.NewHTTPReviewQueue(payment.NewEndpointLister(repo))))
+		mux.Handle("POST /admin/reviews/{id}/approve", merchant.NewHTTPAdmin(token, handlerWithTimeout(payment.NewHTTPApprovePayment(reviewer), time.Second*5)))
+		mux.Handle("POST /admin/reviews/{id}/reject", merchant.NewHTTPAdmin(token, payment.NewHTTPRejectPayment(reviewer)))
+	}
 	//mux.Handle("/external/soap-webhook", nil) // TODO https://github.com/tiaguinho/gosoap
 
 	server := &http.Server{
@@ -82,6 +392,7 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		log.Println("Signal", <-sigChan)
+		cancel()
 		_ = server.Shutdown(context.Background())
 	}()
 
@@ -111,3 +422,75 @@ func handlerWithTimeout(h http.Handler, t time.Duration) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+
+// reconcile compares the settlement report with the payments stored in the data directory, e.g.:
+//
+//	go run main.go reconcile -gateway my-json-payments -report 2024-07-01.json -from 2024-07-01 -to 2024-07-02
+//
+// The data directory of the server is opened read-only, so it can be reconciled while the server is running.
+func reconcile(ctx context.Context, args []string, dataDir string, sources []reconciliation.Source) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	gateway := flags.String("gateway", "", "gateway that delivered the report")
+	reportPath := flags.String("report", "", "path to the settlement report")
+	from := flags.String("from", "", "the first day of the period (inclusive), YYYY-MM-DD")
+	to := flags.String("to", "", "the last day of the period (exclusive), YYYY-MM-DD")
+	dir := flags.String("data-dir", dataDir, "data directory of the server (DATA_DIR)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var period reconciliation.Period
+
+	for _, x := range []struct {
+		value string
+		dst   *time.Time
+	}{{*from, &period.From}, {*to, &period.To}} {
+		t, err := time.Parse(time.DateOnly, x.value)
+		if err != nil {
+			return fmt.Errorf("invalid period: %w", err)
+		}
+
+		*x.dst = t
+	}
+
+	var source *reconciliation.Source
+
+	for i := range sources {
+		if sources[i].Gateway == *gateway {
+			source = &sources[i]
+		}
+	}
+
+	if source == nil {
+		return fmt.Errorf("unknown gateway %+q", *gateway)
+	}
+
+	repo, err := datastore.NewFilePaymentRepository(datastore.FileOptions{Dir: *dir, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = repo.Close()
+	}()
+
+	f, err := os.Open(*reportPath)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	report, err := reconciliation.NewReconciler(repo).Reconcile(ctx, *source, f, period)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
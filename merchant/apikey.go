@@ -0,0 +1,218 @@
+package merchant
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scope limits what the API key can be used for.
+type Scope string
+
+const (
+	ScopePaymentsRead  Scope = "payments:read"
+	ScopePaymentsWrite Scope = "payments:write"
+	ScopeRefundsWrite  Scope = "refunds:write"
+	ScopeWebhooksRead  Scope = "webhooks:read"
+	ScopeWebhooksWrite Scope = "webhooks:write"
+)
+
+// Scopes lists all the known scopes.
+var Scopes = []Scope{ScopePaymentsRead, ScopePaymentsWrite, ScopeRefundsWrite, ScopeWebhooksRead, ScopeWebhooksWrite}
+
+var (
+	// ErrForbidden is returned when the API key does not have the scope required by the request.
+	ErrForbidden    = errors.New("forbidden")
+	ErrKeyNotFound  = errors.New("API key not found")
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// keyPrefix makes the keys easy to recognize, e.g. by secret scanners.
+const keyPrefix = "sk_"
+
+// APIKey authenticates requests of the merchant, only the hash of the key is stored.
+// Merchants can have multiple active keys, so the keys can be rotated without downtime.
+type APIKey struct {
+	ID         uuid.UUID `json:"id"`
+	MerchantID uuid.UUID `json:"merchant_id"`
+	// Prefix identifies the key, it is a part of the key, so it can be shown in the dashboards and logs
+	Prefix    string     `json:"prefix"`
+	Hash      []byte     `json:"-"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// NewAPIKey generates the key, the plain key is returned only once, and it cannot be restored from [APIKey].
+func NewAPIKey(merchantID uuid.UUID, scopes []Scope) (APIKey, string, error) {
+	if len(scopes) == 0 {
+		return APIKey{}, "", fmt.Errorf("%w: no scopes", ErrInvalidScope)
+	}
+
+	for _, s := range scopes {
+		if !slices.Contains(Scopes, s) {
+			return APIKey{}, "", fmt.Errorf("%w: %+q", ErrInvalidScope, s)
+		}
+	}
+
+	prefix := make([]byte, 6)
+	secret := make([]byte, 32)
+
+	for _, b := range [][]byte{prefix, secret} {
+		if _, err := rand.Read(b); err != nil {
+			return APIKey{}, "", fmt.Errorf("could not generate the key: %w", err)
+		}
+	}
+
+	k := APIKey{
+		ID:         uuid.New(),
+		MerchantID: merchantID,
+		Prefix:     keyPrefix + hex.EncodeToString(prefix),
+		Scopes:     slices.Clone(scopes),
+	}
+
+	plain := k.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hashKey(plain)
+
+	return k, plain, nil
+}
+
+// Allows reports whether the key can be used for requests requiring the scope.
+func (k APIKey) Allows(s Scope) bool {
+	return slices.Contains(k.Scopes, s)
+}
+
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Verify compares the plain key with the stored hash in constant time.
+func (k APIKey) Verify(plain string) bool {
+	return subtle.ConstantTimeCompare(k.Hash, hashKey(plain)) == 1
+}
+
+// parseKeyPrefix returns the prefix the key is looked up by.
+func parseKeyPrefix(plain string) (string, bool) {
+	if !strings.HasPrefix(plain, keyPrefix) {
+		return "", false
+	}
+
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(plain, keyPrefix), "_")
+	if !ok || prefix == "" {
+		return "", false
+	}
+
+	return keyPrefix + prefix, true
+}
+
+// hashKey doesn't need a slow password hash, the keys are random and long enough to resist brute force.
+func hashKey(plain string) []byte {
+	sum := sha256.Sum256([]byte(plain))
+	return sum[:]
+}
+
+func (i *InMemory) CreateKey(_ context.Context, k APIKey) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemory.CreateKey(%+q): %w", k.MerchantID, err)
+		}
+	}()
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	if _, ok := i.merchants[k.MerchantID]; !ok {
+		return ErrNotFound
+	}
+
+	if _, ok := i.keys[k.Prefix]; ok {
+		return ErrDuplicate
+	}
+
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = i.now().UTC()
+	}
+
+	i.keys[k.Prefix] = k
+
+	return nil
+}
+
+// Keys returns keys of the merchant, including revoked ones, the oldest go first.
+func (i *InMemory) Keys(_ context.Context, merchantID uuid.UUID) ([]APIKey, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	if _, ok := i.merchants[merchantID]; !ok {
+		return nil, fmt.Errorf("InMemory.Keys(%+q): %w", merchantID, ErrNotFound)
+	}
+
+	keys := make([]APIKey, 0)
+
+	for _, k := range i.keys {
+		if k.MerchantID == merchantID {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b APIKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// RevokeKey makes the key unusable, revoking the revoked key is a no-op.
+func (i *InMemory) RevokeKey(_ context.Context, merchantID, id uuid.UUID) (APIKey, error) {
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	for prefix, k := range i.keys {
+		if k.ID != id || k.MerchantID != merchantID {
+			continue
+		}
+
+		if !k.Revoked() {
+			now := i.now().UTC()
+			k.RevokedAt = &now
+			i.keys[prefix] = k
+		}
+
+		return k, nil
+	}
+
+	return APIKey{}, fmt.Errorf("InMemory.RevokeKey(%+q): %w", id, ErrKeyNotFound)
+}
+
+// Authenticate returns the merchant the key belongs to, unknown and revoked keys are reported as [ErrUnauthenticated].
+func (i *InMemory) Authenticate(_ context.Context, plain string) (Merchant, APIKey, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	prefix, ok := parseKeyPrefix(plain)
+	if !ok {
+		return Merchant{}, APIKey{}, fmt.Errorf("InMemory.Authenticate: malformed key: %w", ErrUnauthenticated)
+	}
+
+	k, ok := i.keys[prefix]
+	if !ok || !k.Verify(plain) || k.Revoked() {
+		return Merchant{}, APIKey{}, fmt.Errorf("InMemory.Authenticate(%+q): %w", prefix, ErrUnauthenticated)
+	}
+
+	m, ok := i.merchants[k.MerchantID]
+	if !ok {
+		return Merchant{}, APIKey{}, fmt.Errorf("InMemory.Authenticate(%+q): %w", prefix, ErrUnauthenticated)
+	}
+
+	return m, k, nil
+}
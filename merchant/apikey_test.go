@@ -0,0 +1,137 @@
+package merchant_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/merchant"
+	"payments/problem"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := merchant.NewInMemory()
+
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	require.NoError(t, repo.Create(ctx, m))
+
+	_, _, err := merchant.NewAPIKey(m.ID, nil)
+	require.ErrorIs(t, err, merchant.ErrInvalidScope)
+	_, _, err = merchant.NewAPIKey(m.ID, []merchant.Scope{"payments:delete"})
+	require.ErrorIs(t, err, merchant.ErrInvalidScope)
+
+	unknown, _, err := merchant.NewAPIKey(uuid.New(), []merchant.Scope{merchant.ScopePaymentsRead})
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.CreateKey(ctx, unknown), merchant.ErrNotFound)
+
+	old, oldPlain, err := merchant.NewAPIKey(m.ID, []merchant.Scope{merchant.ScopePaymentsRead})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateKey(ctx, old))
+	require.ErrorIs(t, repo.CreateKey(ctx, old), merchant.ErrDuplicate)
+
+	assert.True(t, strings.HasPrefix(oldPlain, old.Prefix+"_"))
+	assert.NotContains(t, string(old.Hash), oldPlain)
+	assert.True(t, old.Verify(oldPlain))
+
+	// the key is rotated, both keys are active until the old one is revoked
+	rotated, rotatedPlain, err := merchant.NewAPIKey(m.ID, []merchant.Scope{merchant.ScopePaymentsRead})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateKey(ctx, rotated))
+
+	for _, plain := range []string{oldPlain, rotatedPlain} {
+		got, k, err := repo.Authenticate(ctx, plain)
+		require.NoError(t, err)
+		assert.Equal(t, m.ID, got.ID)
+		assert.True(t, k.Allows(merchant.ScopePaymentsRead))
+		assert.False(t, k.Allows(merchant.ScopeRefundsWrite))
+	}
+
+	_, err = repo.RevokeKey(ctx, uuid.New(), old.ID)
+	require.ErrorIs(t, err, merchant.ErrKeyNotFound)
+
+	revoked, err := repo.RevokeKey(ctx, m.ID, old.ID)
+	require.NoError(t, err)
+	assert.True(t, revoked.Revoked())
+
+	_, _, err = repo.Authenticate(ctx, oldPlain)
+	require.ErrorIs(t, err, merchant.ErrUnauthenticated)
+
+	_, _, err = repo.Authenticate(ctx, rotatedPlain)
+	require.NoError(t, err)
+
+	keys, err := repo.Keys(ctx, m.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.ElementsMatch(t, []uuid.UUID{old.ID, rotated.ID}, []uuid.UUID{keys[0].ID, keys[1].ID})
+}
+
+func TestAdminKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := merchant.NewInMemory()
+
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	require.NoError(t, repo.Create(ctx, m))
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /admin/merchants/{id}/keys", merchant.NewHTTPAdmin("admin-token", merchant.NewHTTPCreateKey(repo)))
+	mux.Handle("POST /admin/merchants/{id}/keys/{key_id}/revoke", merchant.NewHTTPAdmin("admin-token", merchant.NewHTTPRevokeKey(repo)))
+
+	do := func(token, path, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	// errors are problems with the stable code
+	assertProblem := func(recorder *httptest.ResponseRecorder, status int, code problem.Code) {
+		t.Helper()
+
+		require.Equal(t, status, recorder.Code)
+		assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+
+		var response problem.Problem
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		assert.Equal(t, code, response.Code)
+	}
+
+	keysPath := "/admin/merchants/" + m.ID.String() + "/keys"
+
+	assertProblem(do("invalid", keysPath, `{"scopes":["payments:write"]}`), http.StatusUnauthorized, problem.CodeUnauthenticated)
+	assertProblem(do("admin-token", keysPath, `{"scopes":`), http.StatusBadRequest, problem.CodeMalformedRequest)
+	assertProblem(do("admin-token", keysPath, `{"scopes":["unknown"]}`), http.StatusUnprocessableEntity, merchant.ProblemInvalidScope)
+	assertProblem(do("admin-token", "/admin/merchants/"+uuid.NewString()+"/keys", `{"scopes":["payments:write"]}`), http.StatusNotFound, merchant.ProblemMerchantNotFound)
+
+	recorder := do("admin-token", keysPath, `{"scopes":["payments:write","refunds:write"]}`)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var created struct {
+		ID  uuid.UUID `json:"id"`
+		Key string    `json:"key"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&created))
+
+	_, k, err := repo.Authenticate(ctx, created.Key)
+	require.NoError(t, err)
+	assert.True(t, k.Allows(merchant.ScopeRefundsWrite))
+
+	assertProblem(do("admin-token", keysPath+"/"+uuid.NewString()+"/revoke", ""), http.StatusNotFound, merchant.ProblemKeyNotFound)
+	assert.Equal(t, http.StatusOK, do("admin-token", keysPath+"/"+created.ID.String()+"/revoke", "").Code)
+
+	_, _, err = repo.Authenticate(ctx, created.Key)
+	require.ErrorIs(t, err, merchant.ErrUnauthenticated)
+}
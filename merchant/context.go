@@ -0,0 +1,23 @@
+package merchant
+
+import (
+	"context"
+)
+
+type contextKey struct{}
+
+// NewContext returns the context of the request performed by the given merchant.
+func NewContext(ctx context.Context, m Merchant) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the merchant performing the request, see [NewHTTPAuthenticate].
+// It returns [ErrUnauthenticated] when the handler is not wrapped by the middleware.
+func FromContext(ctx context.Context) (Merchant, error) {
+	m, ok := ctx.Value(contextKey{}).(Merchant)
+	if !ok {
+		return Merchant{}, ErrUnauthenticated
+	}
+
+	return m, nil
+}
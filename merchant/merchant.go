@@ -0,0 +1,93 @@
+package merchant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+)
+
+var (
+	ErrNotFound  = errors.New("merchant not found")
+	ErrDuplicate = errors.New("merchant already exists")
+	// ErrUnauthenticated is returned when the request does not carry a valid API key.
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// Merchant owns payments, merchants cannot see or change payments of each other.
+type Merchant struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// Currencies accepted by the merchant (codes, e.g. "AED"), payments in other currencies are rejected
+	Currencies []string `json:"currencies"`
+	// Gateways the payments of the merchant can be routed to (by name), all the gateways are allowed when empty
+	Gateways  []string  `json:"gateways,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Accepts reports whether the merchant accepts payments in the given currency.
+func (m Merchant) Accepts(c currency.Currency) bool {
+	return slices.Contains(m.Currencies, c.Code)
+}
+
+// InMemory stores merchants in the memory, in real life they would be stored in the DB.
+type InMemory struct {
+	merchants map[uuid.UUID]Merchant
+	// keys are indexed by the prefix
+	keys   map[string]APIKey
+	locker *sync.RWMutex
+	now    func() time.Time
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{
+		merchants: make(map[uuid.UUID]Merchant),
+		keys:      make(map[string]APIKey),
+		locker:    &sync.RWMutex{},
+		now:       time.Now,
+	}
+}
+
+func (i *InMemory) Create(_ context.Context, m Merchant) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("InMemory.Create(%+q): %w", m.ID, err)
+		}
+	}()
+
+	if m.ID == uuid.Nil {
+		return errors.New("empty ID")
+	}
+
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	if _, ok := i.merchants[m.ID]; ok {
+		return ErrDuplicate
+	}
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = i.now().UTC()
+	}
+
+	i.merchants[m.ID] = m
+
+	return nil
+}
+
+func (i *InMemory) GetByID(_ context.Context, id uuid.UUID) (Merchant, error) {
+	i.locker.RLock()
+	defer i.locker.RUnlock()
+
+	m, ok := i.merchants[id]
+	if !ok {
+		return Merchant{}, fmt.Errorf("InMemory.GetByID(%+q): %w", id, ErrNotFound)
+	}
+
+	return m, nil
+}
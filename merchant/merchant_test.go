@@ -0,0 +1,117 @@
+package merchant_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/merchant"
+	"payments/problem"
+)
+
+func TestInMemory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := merchant.NewInMemory()
+
+	m := merchant.Merchant{ID: uuid.New(), Name: "Shop", Currencies: []string{"AED"}}
+	require.NoError(t, repo.Create(ctx, m))
+	require.ErrorIs(t, repo.Create(ctx, m), merchant.ErrDuplicate)
+	require.Error(t, repo.Create(ctx, merchant.Merchant{}))
+
+	got, err := repo.GetByID(ctx, m.ID)
+	require.NoError(t, err)
+	assert.False(t, got.CreatedAt.IsZero())
+	assert.True(t, got.Accepts(currency.AED))
+	assert.False(t, got.Accepts(currency.USD))
+
+	_, err = repo.GetByID(ctx, uuid.New())
+	require.ErrorIs(t, err, merchant.ErrNotFound)
+}
+
+func TestNewHTTPAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := merchant.NewInMemory()
+
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	require.NoError(t, repo.Create(ctx, m))
+
+	key, plain, err := merchant.NewAPIKey(m.ID, []merchant.Scope{merchant.ScopePaymentsWrite})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateKey(ctx, key))
+
+	revoked, revokedPlain, err := merchant.NewAPIKey(m.ID, []merchant.Scope{merchant.ScopePaymentsWrite})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateKey(ctx, revoked))
+	_, err = repo.RevokeKey(ctx, m.ID, revoked.ID)
+	require.NoError(t, err)
+
+	readOnly, readOnlyPlain, err := merchant.NewAPIKey(m.ID, []merchant.Scope{merchant.ScopePaymentsRead})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateKey(ctx, readOnly))
+
+	scenarios := map[string]struct {
+		header string
+		status int
+		code   problem.Code
+	}{
+		"Valid":     {header: "Bearer " + plain, status: http.StatusOK},
+		"Revoked":   {header: "Bearer " + revokedPlain, status: http.StatusUnauthorized, code: problem.CodeUnauthenticated},
+		"Scope":     {header: "Bearer " + readOnlyPlain, status: http.StatusForbidden, code: problem.CodeForbidden},
+		"Forged":    {header: "Bearer " + key.Prefix + "_forged", status: http.StatusUnauthorized, code: problem.CodeUnauthenticated},
+		"Malformed": {header: "Bearer invalid", status: http.StatusUnauthorized, code: problem.CodeUnauthenticated},
+		"Scheme":    {header: "Basic " + plain, status: http.StatusUnauthorized, code: problem.CodeUnauthenticated},
+		"Missing":   {status: http.StatusUnauthorized, code: problem.CodeUnauthenticated},
+	}
+
+	for name, s := range scenarios {
+		s := s
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				identified merchant.Merchant
+				called     bool
+			)
+
+			handler := merchant.NewHTTPAuthenticate(repo, merchant.ScopePaymentsWrite, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				called = true
+				identified, _ = merchant.FromContext(r.Context())
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/init-payment", nil)
+			if s.header != "" {
+				request.Header.Set("Authorization", s.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, s.status, recorder.Code)
+
+			if s.code != "" {
+				// the middleware rejects the request, so the endpoint never sees it
+				assert.False(t, called)
+
+				var response problem.Problem
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+				assert.Equal(t, s.code, response.Code)
+
+				return
+			}
+
+			require.True(t, called)
+			assert.Equal(t, m.ID, identified.ID)
+		})
+	}
+}
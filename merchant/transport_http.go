@@ -0,0 +1,192 @@
+package merchant
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"payments/problem"
+)
+
+// Codes of the merchant and admin endpoints, see [problem.Code].
+const (
+	ProblemMerchantNotFound problem.Code = "merchant_not_found"
+	ProblemKeyNotFound      problem.Code = "api_key_not_found"
+	ProblemInvalidScope     problem.Code = "invalid_scope"
+)
+
+var problems = []problem.Definition{
+	{Err: ErrUnauthenticated, Code: problem.CodeUnauthenticated, Status: http.StatusUnauthorized, Title: "Authentication required"},
+	{Err: ErrForbidden, Code: problem.CodeForbidden, Status: http.StatusForbidden, Title: "The API key is not allowed to perform the operation"},
+	{Err: ErrNotFound, Code: ProblemMerchantNotFound, Status: http.StatusNotFound, Title: "Merchant not found"},
+	{Err: ErrKeyNotFound, Code: ProblemKeyNotFound, Status: http.StatusNotFound, Title: "API key not found"},
+	{Err: ErrInvalidScope, Code: ProblemInvalidScope, Status: http.StatusUnprocessableEntity, Title: "Unknown scope"},
+}
+
+type authenticator interface {
+	Authenticate(_ context.Context, plain string) (Merchant, APIKey, error)
+}
+
+// NewHTTPAuthenticate adds the merchant owning the API key from the "Authorization: Bearer <key>" header
+// to the request context, see [FromContext].
+// Requests without a valid key are rejected with 401 ([problem.CodeUnauthenticated]),
+// and requests with the key lacking the scope with 403 ([problem.CodeForbidden]), so they never reach the endpoint.
+func NewHTTPAuthenticate(keys authenticator, scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		plain, ok := bearerToken(request)
+		if !ok {
+			problem.WriteError(writer, request, ErrUnauthenticated, problems)
+			return
+		}
+
+		m, k, err := keys.Authenticate(request.Context(), plain)
+		if err != nil {
+			// unknown keys are reported as ErrUnauthenticated, anything else is the failure of the repository
+			problem.WriteError(writer, request, err, problems)
+			return
+		}
+
+		if !k.Allows(scope) {
+			problem.WriteError(writer, request, fmt.Errorf("%w: %+q scope required", ErrForbidden, scope), problems)
+			return
+		}
+
+		next.ServeHTTP(writer, request.WithContext(NewContext(request.Context(), m)))
+	})
+}
+
+// NewHTTPAdmin allows requests with the admin token only, the token is shared with the back office.
+//
+// TODO admins should be authenticated by SSO, and their actions audited
+func NewHTTPAdmin(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		plain, ok := bearerToken(request)
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(plain), []byte(token)) != 1 {
+			problem.WriteError(writer, request, ErrUnauthenticated, problems)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+type keysCreator interface {
+	CreateKey(_ context.Context, k APIKey) error
+}
+
+// NewHTTPCreateKey expects the merchant ID in the {id} path value, the plain key is returned only once.
+func NewHTTPCreateKey(keys keysCreator) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			_ = request.Body.Close()
+		}()
+
+		merchantID, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid merchant ID")
+			return
+		}
+
+		var payload struct {
+			Scopes []Scope `json:"scopes"`
+		}
+
+		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+			problem.WriteMalformed(writer, request, "invalid JSON")
+			return
+		}
+
+		k, plain, err := NewAPIKey(merchantID, payload.Scopes)
+		if err == nil {
+			err = keys.CreateKey(request.Context(), k)
+		}
+		if err != nil {
+			problem.WriteError(writer, request, fmt.Errorf("could not create the API key: %w", err), problems)
+			return
+		}
+
+		var output struct {
+			APIKey
+			Key string `json:"key"`
+		}
+		output.APIKey = k
+		output.Key = plain
+
+		writeJSON(writer, http.StatusCreated, output)
+	})
+}
+
+type keysLister interface {
+	Keys(_ context.Context, merchantID uuid.UUID) ([]APIKey, error)
+}
+
+// NewHTTPListKeys expects the merchant ID in the {id} path value.
+func NewHTTPListKeys(keys keysLister) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		merchantID, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid merchant ID")
+			return
+		}
+
+		list, err := keys.Keys(request.Context(), merchantID)
+		if err != nil {
+			problem.WriteError(writer, request, fmt.Errorf("could not list API keys: %w", err), problems)
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, list)
+	})
+}
+
+type keysRevoker interface {
+	RevokeKey(_ context.Context, merchantID, id uuid.UUID) (APIKey, error)
+}
+
+// NewHTTPRevokeKey expects the merchant ID in the {id}, and the key ID in the {key_id} path values.
+func NewHTTPRevokeKey(keys keysRevoker) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		merchantID, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid merchant ID")
+			return
+		}
+
+		id, err := uuid.Parse(request.PathValue("key_id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid API key ID")
+			return
+		}
+
+		k, err := keys.RevokeKey(request.Context(), merchantID, id)
+		if err != nil {
+			problem.WriteError(writer, request, fmt.Errorf("could not revoke the API key: %w", err), problems)
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, k)
+	})
+}
+
+func bearerToken(request *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+func writeJSON(writer http.ResponseWriter, status int, v any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	if err := json.NewEncoder(writer).Encode(v); err != nil {
+		log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+	}
+}
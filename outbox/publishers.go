@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"payments/datastore"
+)
+
+// ChannelPublisher passes messages to in-process consumers.
+type ChannelPublisher struct {
+	messages chan datastore.OutboxMessage
+}
+
+func NewChannelPublisher(buffer int) *ChannelPublisher {
+	return &ChannelPublisher{messages: make(chan datastore.OutboxMessage, buffer)}
+}
+
+func (c *ChannelPublisher) Messages() <-chan datastore.OutboxMessage {
+	return c.messages
+}
+
+func (c *ChannelPublisher) Publish(ctx context.Context, m datastore.OutboxMessage) error {
+	select {
+	case c.messages <- m:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("ChannelPublisher.Publish: %w", ctx.Err())
+	}
+}
+
+// FilePublisher appends messages to the file, one JSON per line.
+type FilePublisher struct {
+	file   *os.File
+	locker *sync.Mutex
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("NewFilePublisher(%+q): %w", path, err)
+	}
+
+	return &FilePublisher{file: f, locker: &sync.Mutex{}}, nil
+}
+
+func (f *FilePublisher) Publish(_ context.Context, m datastore.OutboxMessage) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("FilePublisher.Publish: %w", err)
+	}
+
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("FilePublisher.Publish: %w", err)
+	}
+
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("FilePublisher.Publish: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FilePublisher) Close() error {
+	return f.file.Close()
+}
+
+type doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// HTTPPublisher posts every message to the given URL, any 2xx response is treated as delivered.
+// The Idempotency-Key header contains the sequence number of the message.
+type HTTPPublisher struct {
+	url  string
+	http doer
+}
+
+func NewHTTPPublisher(url string, http doer) *HTTPPublisher {
+	return &HTTPPublisher{url: url, http: http}
+}
+
+func (h *HTTPPublisher) Publish(ctx context.Context, m datastore.OutboxMessage) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("HTTPPublisher.Publish: %w", err)
+		}
+	}()
+
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("could not marshal json: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("could not build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.FormatUint(m.Seq, 10))
+
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not perform http request: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("invalid status code, %d given", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// FanOut publishes every message to all the publishers, consumers must be idempotent,
+// because the message is published again to all of them when any fails.
+type FanOut struct {
+	publishers []Publisher
+}
+
+func NewFanOut(publishers ...Publisher) *FanOut {
+	return &FanOut{publishers: publishers}
+}
+
+func (f *FanOut) Publish(ctx context.Context, m datastore.OutboxMessage) error {
+	var failures []error
+
+	for _, p := range f.publishers {
+		if err := p.Publish(ctx, m); err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	if err := errors.Join(failures...); err != nil {
+		return fmt.Errorf("FanOut.Publish: %w", err)
+	}
+
+	return nil
+}
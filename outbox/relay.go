@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+)
+
+type Publisher interface {
+	Publish(context.Context, datastore.OutboxMessage) error
+}
+
+type source interface {
+	PendingEvents(ctx context.Context, limit int) ([]datastore.OutboxMessage, error)
+	AckEvents(ctx context.Context, seqs ...uint64) error
+}
+
+// Relay publishes the messages stored in the outbox.
+//
+// The delivery is at-least-once - the message is acknowledged after it's published,
+// so consumers must deduplicate messages using [datastore.OutboxMessage.Seq].
+// Messages of the given payment are published in order, when one fails,
+// the following messages of the same payment wait for the next attempt.
+type Relay struct {
+	source    source
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelay(source source, publisher Publisher, interval time.Duration, batchSize int) *Relay {
+	return &Relay{source: source, publisher: publisher, interval: interval, batchSize: batchSize}
+}
+
+// Run relays the messages until the context is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RelayOnce(ctx); err != nil {
+			// TODO logger would be injected
+			log.Default().Println(fmt.Sprintf("outbox relay: %s", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes a single batch of pending messages.
+func (r *Relay) RelayOnce(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Relay.RelayOnce: %w", err)
+		}
+	}()
+
+	messages, err := r.source.PendingEvents(ctx, r.batchSize)
+	if err != nil {
+		return fmt.Errorf("could not fetch pending events: %w", err)
+	}
+
+	var (
+		published = make([]uint64, 0, len(messages))
+		blocked   = make(map[uuid.UUID]struct{})
+		failures  []error
+	)
+
+	for _, m := range messages {
+		if _, ok := blocked[m.Event.PaymentID]; ok {
+			continue
+		}
+
+		if err := r.publisher.Publish(ctx, m); err != nil {
+			blocked[m.Event.PaymentID] = struct{}{}
+			failures = append(failures, fmt.Errorf("could not publish %d: %w", m.Seq, err))
+
+			continue
+		}
+
+		published = append(published, m.Seq)
+	}
+
+	if len(published) > 0 {
+		if err := r.source.AckEvents(ctx, published...); err != nil {
+			return fmt.Errorf("could not ack events: %w", err)
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d failed, first error: %w", len(failures), len(messages), failures[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/outbox"
+)
+
+func init() {
+	log.SetOutput(io.Discard)
+}
+
+type recordingPublisher struct {
+	failFor   map[uuid.UUID]bool
+	published []datastore.OutboxMessage
+}
+
+func (r *recordingPublisher) Publish(_ context.Context, m datastore.OutboxMessage) error {
+	if r.failFor[m.Event.PaymentID] {
+		return errors.New("my error")
+	}
+
+	r.published = append(r.published, m)
+
+	return nil
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := datastore.NewInMemoryPaymentRepository()
+
+	failing, working := uuid.New(), uuid.New()
+	for n, id := range []uuid.UUID{failing, working} {
+		require.NoError(t, repo.Create(ctx, datastore.Payment{
+			ID:         id,
+			ExternalID: id.String(),
+			Status:     datastore.PaymentInitiated,
+			Amount:     currency.MustNewAmount(currency.AED, uint(n+1), 0),
+		}))
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, id.String(), datastore.PaymentPaid))
+	}
+
+	publisher := &recordingPublisher{failFor: map[uuid.UUID]bool{failing: true}}
+	relay := outbox.NewRelay(repo, publisher, time.Second, 10)
+
+	require.Error(t, relay.RelayOnce(ctx))
+	require.Len(t, publisher.published, 2)
+	assert.Equal(t, datastore.EventPaymentInitiated, publisher.published[0].Event.Type)
+	assert.Equal(t, uint64(1), publisher.published[0].Event.Version)
+	assert.Equal(t, datastore.EventPaymentPaid, publisher.published[1].Event.Type)
+	assert.Equal(t, uint64(2), publisher.published[1].Event.Version)
+
+	pending, err := repo.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+
+	// the failing payment recovers, its messages are delivered in order
+	publisher.failFor = nil
+	publisher.published = nil
+
+	require.NoError(t, relay.RelayOnce(ctx))
+	require.Len(t, publisher.published, 2)
+	assert.Equal(t, failing, publisher.published[0].Event.PaymentID)
+	assert.Less(t, publisher.published[0].Seq, publisher.published[1].Seq)
+
+	pending, err = repo.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestFanOut_Publish(t *testing.T) {
+	t.Parallel()
+
+	failing := uuid.New()
+	first := &recordingPublisher{}
+	second := &recordingPublisher{failFor: map[uuid.UUID]bool{failing: true}}
+	fanOut := outbox.NewFanOut(first, second)
+
+	require.NoError(t, fanOut.Publish(context.Background(), datastore.OutboxMessage{Seq: 1, Event: datastore.Event{PaymentID: uuid.New()}}))
+	require.Error(t, fanOut.Publish(context.Background(), datastore.OutboxMessage{Seq: 2, Event: datastore.Event{PaymentID: failing}}))
+
+	assert.Len(t, first.published, 2, "the failure of one publisher does not stop the others")
+	assert.Len(t, second.published, 1)
+}
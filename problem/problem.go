@@ -0,0 +1,129 @@
+// Package problem writes errors of the HTTP API as application/problem+json (RFC 7807),
+// every package maps its own errors to the problems, see [Definition].
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Code is a stable, machine-readable identifier of the problem, clients can rely on it.
+type Code string
+
+// Codes shared by all the endpoints, packages define their own codes for their errors.
+const (
+	CodeMalformedRequest Code = "malformed_request"
+	CodeUnauthenticated  Code = "unauthenticated"
+	CodeForbidden        Code = "forbidden"
+	CodeValidationFailed Code = "validation_failed"
+	CodeInternal         Code = "internal_error"
+)
+
+// Problem implements RFC 7807, extended by the code and the validation errors.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	// Field is the path from the JSON schema, e.g. "amount_fractions"
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when the request does not match the schema.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("validation failed, %d errors", len(v.Fields))
+}
+
+// Definition maps the error (matched by [errors.Is]) to the problem.
+type Definition struct {
+	Err    error
+	Code   Code
+	Status int
+	Title  string
+}
+
+// retryAfter is implemented by the errors telling clients when to retry, e.g. ratelimit.ExceededError.
+type retryAfter interface {
+	RetryAfterSeconds() int
+}
+
+func New(code Code, status int, title string) Problem {
+	return Problem{
+		Type:   fmt.Sprintf("/problems/%s", code),
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+// FromError maps the error to the problem, definitions are checked in order, so specific errors must go first.
+// The error message is not exposed, it can contain internal details, unknown errors are reported as [CodeInternal].
+func FromError(err error, definitions []Definition) Problem {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		p := New(CodeValidationFailed, http.StatusUnprocessableEntity, "Request does not match the schema")
+		p.Errors = validationErr.Fields
+
+		return p
+	}
+
+	for _, d := range definitions {
+		if errors.Is(err, d.Err) {
+			return New(d.Code, d.Status, d.Title)
+		}
+	}
+
+	return New(CodeInternal, http.StatusInternalServerError, "Internal error")
+}
+
+// WriteError writes the problem for the given error, 5xx errors are logged.
+func WriteError(writer http.ResponseWriter, request *http.Request, err error, definitions []Definition) {
+	p := FromError(err, definitions)
+
+	var r retryAfter
+	if errors.As(err, &r) {
+		writer.Header().Set("Retry-After", strconv.Itoa(r.RetryAfterSeconds()))
+	}
+
+	if p.Status >= http.StatusInternalServerError {
+		// TODO logger would be injected
+		log.Default().Println(fmt.Sprintf("%s %s: %s", request.Method, request.URL.Path, err))
+	}
+
+	Write(writer, request, p)
+}
+
+// WriteMalformed writes [CodeMalformedRequest], the detail tells the client what is wrong.
+func WriteMalformed(writer http.ResponseWriter, request *http.Request, detail string) {
+	p := New(CodeMalformedRequest, http.StatusBadRequest, "Malformed request")
+	p.Detail = detail
+
+	Write(writer, request, p)
+}
+
+// Write writes the problem, the instance is the path of the request.
+func Write(writer http.ResponseWriter, request *http.Request, p Problem) {
+	p.Instance = request.URL.Path
+
+	writer.Header().Set("Content-Type", "application/problem+json")
+	writer.WriteHeader(p.Status)
+
+	if err := json.NewEncoder(writer).Encode(p); err != nil {
+		log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+	}
+}
@@ -0,0 +1,101 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/problem"
+)
+
+func init() {
+	log.SetOutput(io.Discard)
+}
+
+var (
+	errSpecific = errors.New("specific")
+	errGeneric  = errors.New("generic")
+)
+
+type retryError struct{}
+
+func (retryError) Error() string {
+	return "retry later"
+}
+
+func (retryError) RetryAfterSeconds() int {
+	return 30
+}
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+
+	definitions := []problem.Definition{
+		{Err: errSpecific, Code: "specific", Status: http.StatusConflict, Title: "Specific"},
+		{Err: errGeneric, Code: "generic", Status: http.StatusUnprocessableEntity, Title: "Generic"},
+		{Err: retryError{}, Code: "retry", Status: http.StatusTooManyRequests, Title: "Retry"},
+	}
+
+	tests := map[string]struct {
+		err        error
+		code       problem.Code
+		status     int
+		retryAfter string
+		fields     int
+	}{
+		"Specific first": {err: fmt.Errorf("%w: %w", errGeneric, errSpecific), code: "specific", status: http.StatusConflict},
+		"Wrapped":        {err: fmt.Errorf("secret details: %w", errGeneric), code: "generic", status: http.StatusUnprocessableEntity},
+		"Retry-After":    {err: fmt.Errorf("limited: %w", retryError{}), code: "retry", status: http.StatusTooManyRequests, retryAfter: "30"},
+		"Validation": {
+			err:    &problem.ValidationError{Fields: []problem.FieldError{{Field: "amount", Message: "Required"}}},
+			code:   problem.CodeValidationFailed,
+			status: http.StatusUnprocessableEntity,
+			fields: 1,
+		},
+		"Unknown": {err: errors.New("secret details"), code: problem.CodeInternal, status: http.StatusInternalServerError},
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+			problem.WriteError(recorder, httptest.NewRequest(http.MethodGet, "/payments", nil), s.err, definitions)
+
+			require.Equal(t, s.status, recorder.Code)
+			assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+			assert.Equal(t, s.retryAfter, recorder.Header().Get("Retry-After"))
+			assert.NotContains(t, recorder.Body.String(), "secret details")
+
+			var response problem.Problem
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+			assert.Equal(t, s.code, response.Code)
+			assert.Equal(t, s.status, response.Status)
+			assert.Equal(t, "/problems/"+string(s.code), response.Type)
+			assert.Equal(t, "/payments", response.Instance)
+			assert.Len(t, response.Errors, s.fields)
+		})
+	}
+}
+
+func TestWriteMalformed(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+	problem.WriteMalformed(recorder, httptest.NewRequest(http.MethodGet, "/payments/x", nil), "invalid payment ID")
+
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var response problem.Problem
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, problem.CodeMalformedRequest, response.Code)
+	assert.Equal(t, "invalid payment ID", response.Detail)
+	assert.Equal(t, "/payments/x", response.Instance)
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type inMemoryCounter struct {
+	used    uint64
+	resetAt time.Time
+}
+
+// InMemory is an in-process implementation, it's useful for tests and single-instance deployments,
+// every instance would have its own limits otherwise.
+type InMemory struct {
+	buckets  map[string]bucket
+	counters map[string]inMemoryCounter
+	locker   *sync.Mutex
+	now      func() time.Time
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{
+		buckets:  make(map[string]bucket),
+		counters: make(map[string]inMemoryCounter),
+		locker:   &sync.Mutex{},
+		now:      time.Now,
+	}
+}
+
+// Allow takes the token from the bucket of the key, it returns [ExceededError] when the bucket is empty.
+func (i *InMemory) Allow(_ context.Context, key string, l Limit) error {
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	now := i.now()
+
+	b, ok := i.buckets[key]
+	if !ok {
+		b = newBucket(l, now)
+	}
+
+	b, retryAfter := b.take(l, now)
+	i.buckets[key] = b
+
+	if retryAfter > 0 {
+		return fmt.Errorf("InMemory.Allow(%+q): %w", key, &ExceededError{Err: ErrLimitExceeded, RetryAfter: retryAfter})
+	}
+
+	return nil
+}
+
+// Consume adds n to the counter of the key, unless it exceeds the limit, the counter is reset at resetAt.
+// It returns [ExceededError] when the limit would be exceeded.
+func (i *InMemory) Consume(_ context.Context, key string, n, limit uint64, resetAt time.Time) error {
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	now := i.now()
+
+	c, ok := i.counters[key]
+	if !ok || !now.Before(c.resetAt) {
+		c = inMemoryCounter{resetAt: resetAt}
+	}
+
+	if c.used+n > limit {
+		return fmt.Errorf("InMemory.Consume(%+q): %w", key, &ExceededError{Err: ErrQuotaExceeded, RetryAfter: c.resetAt.Sub(now)})
+	}
+
+	c.used += n
+	i.counters[key] = c
+
+	return nil
+}
+
+// Release gives back the consumed amount, e.g. when the operation failed.
+func (i *InMemory) Release(_ context.Context, key string, n uint64) error {
+	i.locker.Lock()
+	defer i.locker.Unlock()
+
+	c, ok := i.counters[key]
+	if !ok {
+		return nil
+	}
+
+	c.used -= min(n, c.used)
+	i.counters[key] = c
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/ratelimit"
+)
+
+func TestInMemory_Allow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("Burst", func(t *testing.T) {
+		t.Parallel()
+
+		limiter := ratelimit.NewInMemory()
+		l := ratelimit.Limit{Rate: 0.01, Burst: 2}
+
+		require.NoError(t, limiter.Allow(ctx, "merchant:1", l))
+		require.NoError(t, limiter.Allow(ctx, "merchant:1", l))
+
+		err := limiter.Allow(ctx, "merchant:1", l)
+		require.ErrorIs(t, err, ratelimit.ErrLimitExceeded)
+
+		var exceeded *ratelimit.ExceededError
+		require.ErrorAs(t, err, &exceeded)
+		assert.InDelta(t, 100, exceeded.RetryAfter.Seconds(), 1)
+		assert.Equal(t, 100, exceeded.RetryAfterSeconds())
+
+		// buckets are independent
+		require.NoError(t, limiter.Allow(ctx, "merchant:2", l))
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		t.Parallel()
+
+		limiter := ratelimit.NewInMemory()
+		l := ratelimit.Limit{Rate: 100, Burst: 1}
+
+		require.NoError(t, limiter.Allow(ctx, "merchant:1", l))
+		require.ErrorIs(t, limiter.Allow(ctx, "merchant:1", l), ratelimit.ErrLimitExceeded)
+
+		time.Sleep(time.Millisecond * 20)
+
+		require.NoError(t, limiter.Allow(ctx, "merchant:1", l))
+	})
+}
+
+func TestInMemory_Consume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	limiter := ratelimit.NewInMemory()
+	resetAt := time.Now().Add(time.Hour)
+
+	require.NoError(t, limiter.Consume(ctx, "quota:1", 60, 100, resetAt))
+
+	err := limiter.Consume(ctx, "quota:1", 50, 100, resetAt)
+	require.ErrorIs(t, err, ratelimit.ErrQuotaExceeded)
+
+	var exceeded *ratelimit.ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.InDelta(t, time.Hour.Seconds(), exceeded.RetryAfter.Seconds(), 1)
+
+	require.NoError(t, limiter.Consume(ctx, "quota:1", 40, 100, resetAt))
+
+	require.NoError(t, limiter.Release(ctx, "quota:1", 50))
+	require.NoError(t, limiter.Consume(ctx, "quota:1", 50, 100, resetAt))
+
+	// the counter starts from scratch once it's expired
+	require.NoError(t, limiter.Consume(ctx, "quota:2", 100, 100, time.Now().Add(-time.Second)))
+	require.NoError(t, limiter.Consume(ctx, "quota:2", 100, 100, resetAt))
+}
+
+func TestDailyWindow(t *testing.T) {
+	t.Parallel()
+
+	day, resetAt := ratelimit.DailyWindow(time.Date(2024, 7, 1, 23, 30, 0, 0, time.FixedZone("GST", 4*3600)))
+	assert.Equal(t, "2024-07-01", day)
+	assert.Equal(t, time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC), resetAt)
+
+	hour, resetAt := ratelimit.HourlyWindow(time.Date(2024, 7, 1, 13, 30, 0, 0, time.UTC))
+	assert.Equal(t, "2024-07-01T13", hour)
+	assert.Equal(t, time.Date(2024, 7, 1, 14, 0, 0, 0, time.UTC), resetAt)
+
+	month, resetAt := ratelimit.MonthlyWindow(time.Date(2024, 12, 31, 13, 30, 0, 0, time.UTC))
+	assert.Equal(t, "2024-12", month)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), resetAt)
+}
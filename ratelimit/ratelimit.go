@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	// ErrLimitExceeded is returned when the client sends requests faster than the [Limit] allows.
+	ErrLimitExceeded = errors.New("rate limit exceeded")
+	// ErrQuotaExceeded is returned when the volume exceeds the quota of the period.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// ExceededError tells the client when the request can be retried.
+type ExceededError struct {
+	// Err is either ErrLimitExceeded or ErrQuotaExceeded
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Err, e.RetryAfter)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterSeconds returns the value of the Retry-After header, it's never zero, so clients don't retry immediately.
+func (e *ExceededError) RetryAfterSeconds() int {
+	return max(1, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Limit configures the token bucket, Burst requests are allowed at once, then Rate requests per second.
+type Limit struct {
+	Rate  float64
+	Burst uint
+}
+
+// Quotas is the daily volume allowed per currency (code, e.g. "AED"), in fractions.
+// Currencies without the quota are not limited.
+type Quotas map[string]uint
+
+// bucket is shared by all the implementations, the state is refilled lazily when the token is taken.
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func newBucket(l Limit, now time.Time) bucket {
+	return bucket{tokens: float64(l.Burst), updatedAt: now}
+}
+
+// take returns the new state of the bucket, and how long the client must wait when there is no token.
+func (b bucket) take(l Limit, now time.Time) (bucket, time.Duration) {
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens = min(float64(l.Burst), b.tokens+elapsed.Seconds()*l.Rate)
+		b.updatedAt = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return b, 0
+	}
+
+	if l.Rate <= 0 {
+		// the bucket is never refilled, it's not expected to be configured this way
+		return b, time.Hour * 24
+	}
+
+	return b, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+}
+
+// HourlyWindow returns the current UTC hour the counters are counted for, and when the next hour starts.
+func HourlyWindow(now time.Time) (string, time.Time) {
+	hour := now.UTC().Truncate(time.Hour)
+	return hour.Format("2006-01-02T15"), hour.Add(time.Hour)
+}
+
+// DailyWindow returns the current UTC day the quotas are counted for, and when the next day starts.
+func DailyWindow(now time.Time) (string, time.Time) {
+	day := now.UTC().Truncate(time.Hour * 24)
+	return day.Format(time.DateOnly), day.Add(time.Hour * 24)
+}
+
+// MonthlyWindow returns the current UTC month the counters are counted for, and when the next month starts.
+func MonthlyWindow(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return month.Format("2006-01"), month.AddDate(0, 1, 0)
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLSchema creates the tables used by [SQL], the dialect is PostgreSQL.
+const SQLSchema = `
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key TEXT PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS quota_counters (
+    counter_key TEXT PRIMARY KEY,
+    used        BIGINT NOT NULL,
+    reset_at    TIMESTAMPTZ NOT NULL
+)`
+
+// SQL shares the limits across all the instances, using the same database we store the payments,
+// so we don't need any extra infrastructure.
+//
+// TODO expired counters and idle buckets should be deleted by a background job
+type SQL struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func NewSQL(db *sql.DB) *SQL {
+	return &SQL{db: db, now: time.Now}
+}
+
+// Allow takes the token from the bucket of the key, see [InMemory.Allow].
+// The row is locked, so concurrent requests of the same key are serialized.
+func (s *SQL) Allow(ctx context.Context, key string, l Limit) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("SQL.Allow(%+q): %w", key, err)
+		}
+	}()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := s.now().UTC()
+	b := newBucket(l, now)
+
+	const insert = `INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at) VALUES ($1, $2, $3) ON CONFLICT (bucket_key) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, insert, key, b.tokens, b.updatedAt); err != nil {
+		return err
+	}
+
+	const selectForUpdate = `SELECT tokens, updated_at FROM rate_limit_buckets WHERE bucket_key = $1 FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, selectForUpdate, key).Scan(&b.tokens, &b.updatedAt); err != nil {
+		return err
+	}
+
+	b, retryAfter := b.take(l, now)
+
+	const update = `UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE bucket_key = $1`
+	if _, err := tx.ExecContext(ctx, update, key, b.tokens, b.updatedAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if retryAfter > 0 {
+		return &ExceededError{Err: ErrLimitExceeded, RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// Consume adds n to the counter of the key, see [InMemory.Consume].
+func (s *SQL) Consume(ctx context.Context, key string, n, limit uint64, resetAt time.Time) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("SQL.Consume(%+q): %w", key, err)
+		}
+	}()
+
+	now := s.now().UTC()
+
+	if n > limit {
+		return &ExceededError{Err: ErrQuotaExceeded, RetryAfter: resetAt.Sub(now)}
+	}
+
+	// the expired counter starts from scratch, the limit is checked by the update only,
+	// because n does not exceed the limit on insert
+	const query = `
+INSERT INTO quota_counters (counter_key, used, reset_at)
+VALUES ($1, $2, $4)
+ON CONFLICT (counter_key) DO UPDATE
+    SET used     = CASE WHEN quota_counters.reset_at <= $5 THEN EXCLUDED.used ELSE quota_counters.used + EXCLUDED.used END,
+        reset_at = CASE WHEN quota_counters.reset_at <= $5 THEN EXCLUDED.reset_at ELSE quota_counters.reset_at END
+    WHERE quota_counters.reset_at <= $5 OR quota_counters.used + EXCLUDED.used <= $3
+RETURNING used`
+
+	var used uint64
+
+	err = s.db.QueryRowContext(ctx, query, key, n, limit, resetAt, now).Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		var currentResetAt time.Time
+		if err := s.db.QueryRowContext(ctx, `SELECT reset_at FROM quota_counters WHERE counter_key = $1`, key).Scan(&currentResetAt); err != nil {
+			return err
+		}
+
+		return &ExceededError{Err: ErrQuotaExceeded, RetryAfter: currentResetAt.Sub(now)}
+	}
+
+	return err
+}
+
+// Release gives back the consumed amount, see [InMemory.Release].
+func (s *SQL) Release(ctx context.Context, key string, n uint64) error {
+	const query = `UPDATE quota_counters SET used = GREATEST(used - $2, 0) WHERE counter_key = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, key, n); err != nil {
+		return fmt.Errorf("SQL.Release(%+q): %w", key, err)
+	}
+
+	return nil
+}
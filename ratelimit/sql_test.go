@@ -0,0 +1,114 @@
+//go:build integration
+
+package ratelimit_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/ratelimit"
+)
+
+// schemaLocker serializes the schema creation, concurrent CREATE TABLE IF NOT EXISTS can fail in PostgreSQL.
+var schemaLocker sync.Mutex
+
+// openPostgres connects to the DB given by POSTGRES_DSN, see "make test-integration".
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_DSN")
+	require.NotEmpty(t, dsn, "POSTGRES_DSN is required by integration tests")
+
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	schemaLocker.Lock()
+	defer schemaLocker.Unlock()
+
+	_, err = db.ExecContext(context.Background(), ratelimit.SQLSchema)
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestSQL_Allow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	limiter := ratelimit.NewSQL(openPostgres(t))
+
+	t.Run("Burst", func(t *testing.T) {
+		t.Parallel()
+
+		// keys are unique, so the tests can share the DB
+		first, second := "merchant:"+uuid.NewString(), "merchant:"+uuid.NewString()
+		l := ratelimit.Limit{Rate: 0.01, Burst: 2}
+
+		require.NoError(t, limiter.Allow(ctx, first, l))
+		require.NoError(t, limiter.Allow(ctx, first, l))
+
+		err := limiter.Allow(ctx, first, l)
+		require.ErrorIs(t, err, ratelimit.ErrLimitExceeded)
+
+		var exceeded *ratelimit.ExceededError
+		require.ErrorAs(t, err, &exceeded)
+		assert.InDelta(t, 100, exceeded.RetryAfter.Seconds(), 1)
+		assert.Equal(t, 100, exceeded.RetryAfterSeconds())
+
+		// buckets are independent
+		require.NoError(t, limiter.Allow(ctx, second, l))
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		t.Parallel()
+
+		key := "merchant:" + uuid.NewString()
+		l := ratelimit.Limit{Rate: 100, Burst: 1}
+
+		require.NoError(t, limiter.Allow(ctx, key, l))
+		require.ErrorIs(t, limiter.Allow(ctx, key, l), ratelimit.ErrLimitExceeded)
+
+		time.Sleep(time.Millisecond * 20)
+
+		require.NoError(t, limiter.Allow(ctx, key, l))
+	})
+}
+
+func TestSQL_Consume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	limiter := ratelimit.NewSQL(openPostgres(t))
+	resetAt := time.Now().Add(time.Hour)
+	first, second := "quota:"+uuid.NewString(), "quota:"+uuid.NewString()
+
+	require.NoError(t, limiter.Consume(ctx, first, 60, 100, resetAt))
+
+	err := limiter.Consume(ctx, first, 50, 100, resetAt)
+	require.ErrorIs(t, err, ratelimit.ErrQuotaExceeded)
+
+	var exceeded *ratelimit.ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.InDelta(t, time.Hour.Seconds(), exceeded.RetryAfter.Seconds(), 1)
+
+	require.NoError(t, limiter.Consume(ctx, first, 40, 100, resetAt))
+
+	require.NoError(t, limiter.Release(ctx, first, 50))
+	require.NoError(t, limiter.Consume(ctx, first, 50, 100, resetAt))
+
+	// the counter starts from scratch once it's expired
+	require.NoError(t, limiter.Consume(ctx, second, 100, 100, time.Now().Add(-time.Second)))
+	require.NoError(t, limiter.Consume(ctx, second, 100, 100, resetAt))
+}
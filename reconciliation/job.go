@@ -0,0 +1,193 @@
+package reconciliation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"payments/lock"
+)
+
+// jobLockKey makes sure that only one instance reconciles at the time.
+const jobLockKey = "reconciliation"
+
+type distributedLock interface {
+	Lock(ctx context.Context, key string) (lock.Lease, error)
+}
+
+type fetcher interface {
+	// Fetch returns the settlement report of the given day, [os.ErrNotExist] when it's not delivered yet.
+	Fetch(_ context.Context, s Source, day time.Time) (io.ReadCloser, error)
+}
+
+type reportWriter interface {
+	Write(_ context.Context, day time.Time, r Report) error
+}
+
+// DirFetcher reads reports from <dir>/<gateway>/<YYYY-MM-DD>.<format>.
+type DirFetcher struct {
+	dir string
+}
+
+func NewDirFetcher(dir string) *DirFetcher {
+	return &DirFetcher{dir: dir}
+}
+
+func (d DirFetcher) Fetch(_ context.Context, s Source, day time.Time) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(d.dir, s.Gateway, day.Format(time.DateOnly)+"."+s.Parser.Format()))
+}
+
+// DirWriter writes reports to <dir>/<gateway>/<YYYY-MM-DD>.discrepancies.json.
+type DirWriter struct {
+	dir string
+}
+
+func NewDirWriter(dir string) *DirWriter {
+	return &DirWriter{dir: dir}
+}
+
+func (d DirWriter) Write(_ context.Context, day time.Time, r Report) error {
+	dir := filepath.Join(d.dir, r.Gateway)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, day.Format(time.DateOnly)+".discrepancies.json"), body, 0o644)
+}
+
+type JobOptions struct {
+	// Now is the clock, time.Now by default
+	Now func() time.Time
+}
+
+// Job reconciles the reports of the previous day (UTC), as soon as gateways deliver them.
+type Job struct {
+	reconciler      *Reconciler
+	sources         []Source
+	fetcher         fetcher
+	writer          reportWriter
+	distributedLock distributedLock
+	options         JobOptions
+	// done contains the last reconciled day of every gateway
+	done map[string]time.Time
+}
+
+func NewJob(
+	reconciler *Reconciler,
+	sources []Source,
+	fetcher fetcher,
+	writer reportWriter,
+	distributedLock distributedLock,
+	o JobOptions,
+) *Job {
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+
+	return &Job{
+		reconciler:      reconciler,
+		sources:         sources,
+		fetcher:         fetcher,
+		writer:          writer,
+		distributedLock: distributedLock,
+		options:         o,
+		done:            make(map[string]time.Time),
+	}
+}
+
+// Run reconciles reports until the context is cancelled.
+func (j *Job) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.RunOnce(ctx); err != nil {
+			// TODO logger would be injected
+			log.Default().Println(fmt.Sprintf("reconciliation: %s", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce reconciles the reports of the previous day, which have not been reconciled yet.
+func (j *Job) RunOnce(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Job.RunOnce: %w", err)
+		}
+	}()
+
+	leader, err := j.distributedLock.Lock(ctx, jobLockKey)
+	if errors.Is(err, lock.ErrNotAcquired) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		_ = leader.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	day := j.options.Now().UTC().Truncate(time.Hour*24).AddDate(0, 0, -1)
+
+	var failures []error
+
+	for _, s := range j.sources {
+		if j.done[s.Gateway].Equal(day) {
+			continue
+		}
+
+		err := j.reconcile(ctx, s, day)
+		if errors.Is(err, os.ErrNotExist) {
+			// we will try again during the next run
+			continue
+		}
+		if err != nil {
+			failures = append(failures, fmt.Errorf("gateway %+q: %w", s.Gateway, err))
+			continue
+		}
+
+		j.done[s.Gateway] = day
+	}
+
+	return errors.Join(failures...)
+}
+
+func (j *Job) reconcile(ctx context.Context, s Source, day time.Time) error {
+	f, err := j.fetcher.Fetch(ctx, s, day)
+	if err != nil {
+		return fmt.Errorf("could not fetch report: %w", err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	r, err := j.reconciler.Reconcile(ctx, s, f, Period{From: day, To: day.AddDate(0, 0, 1)})
+	if err != nil {
+		return err
+	}
+
+	if err := j.writer.Write(ctx, day, r); err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package reconciliation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"payments/currency"
+	"payments/datastore"
+)
+
+// Parser reads the settlement report in the format of the given gateway.
+type Parser interface {
+	Parse(io.Reader) ([]Record, error)
+	// Format is used as the extension of report files, e.g. "csv"
+	Format() string
+}
+
+// JSONParser reads reports of the MyJSONPayments gateway:
+//
+//	{"transactions": [{"id": "my-payment-gateway-json-id-123", "amount": "100.15 AED", "status": "paid", "settled_at": "2024-07-01T10:00:00Z"}]}
+type JSONParser struct{}
+
+func NewJSONParser() *JSONParser {
+	return &JSONParser{}
+}
+
+func (JSONParser) Format() string {
+	return "json"
+}
+
+func (JSONParser) Parse(r io.Reader) ([]Record, error) {
+	var report struct {
+		Transactions []struct {
+			ID        string                  `json:"id"`
+			Amount    string                  `json:"amount"`
+			Status    datastore.PaymentStatus `json:"status"`
+			SettledAt time.Time               `json:"settled_at"`
+		} `json:"transactions"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("JSONParser.Parse: could not decode: %w", err)
+	}
+
+	records := make([]Record, 0, len(report.Transactions))
+
+	for n, t := range report.Transactions {
+		amount, err := currency.ParseAmount(t.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("JSONParser.Parse: transaction %d: %w", n, err)
+		}
+
+		if t.ID == "" {
+			return nil, fmt.Errorf("JSONParser.Parse: transaction %d: empty id", n)
+		}
+
+		records = append(records, Record{ExternalID: t.ID, Amount: amount, Status: t.Status, SettledAt: t.SettledAt})
+	}
+
+	return records, nil
+}
+
+// CSVParser reads reports with the header, columns can go in any order:
+//
+//	external_id,amount_fractions,currency,status,settled_at
+//	my-payment-gateway-soap-id-123,10015,AED,paid,2024-07-01T10:00:00Z
+type CSVParser struct{}
+
+func NewCSVParser() *CSVParser {
+	return &CSVParser{}
+}
+
+func (CSVParser) Format() string {
+	return "csv"
+}
+
+func (CSVParser) Parse(r io.Reader) (_ []Record, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("CSVParser.Parse: %w", err)
+		}
+	}()
+
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for n, name := range header {
+		columns[name] = n
+	}
+
+	for _, name := range []string{"external_id", "amount_fractions", "currency", "status", "settled_at"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %+q", name)
+		}
+	}
+
+	records := make([]Record, 0)
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := csvRecord(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		records = append(records, record)
+	}
+}
+
+func csvRecord(row []string, columns map[string]int) (Record, error) {
+	c, err := currency.ByCode(row[columns["currency"]])
+	if err != nil {
+		return Record{}, err
+	}
+
+	fractions, err := strconv.ParseUint(row[columns["amount_fractions"]], 10, 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid amount_fractions: %w", err)
+	}
+
+	settledAt, err := time.Parse(time.RFC3339, row[columns["settled_at"]])
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid settled_at: %w", err)
+	}
+
+	if row[columns["external_id"]] == "" {
+		return Record{}, errors.New("empty external_id")
+	}
+
+	return Record{
+		ExternalID: row[columns["external_id"]],
+		Amount:     currency.NewAmountFromFractions(c, uint(fractions)),
+		Status:     datastore.PaymentStatus(row[columns["status"]]),
+		SettledAt:  settledAt,
+	}, nil
+}
@@ -0,0 +1,207 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/currency"
+	"payments/datastore"
+)
+
+type DiscrepancyType string
+
+const (
+	// MissingLocally means that the gateway settled the payment we don't know about.
+	MissingLocally DiscrepancyType = "missing_locally"
+	// MissingAtGateway means that we consider the payment paid, but the gateway did not settle it.
+	MissingAtGateway DiscrepancyType = "missing_at_gateway"
+	AmountMismatch   DiscrepancyType = "amount_mismatch"
+	StatusMismatch   DiscrepancyType = "status_mismatch"
+)
+
+// Record is a single transaction of the settlement report.
+type Record struct {
+	ExternalID string
+	Amount     currency.Amount
+	// Status uses our statuses, gateways report paid and refunded payments only
+	Status    datastore.PaymentStatus
+	SettledAt time.Time
+}
+
+type Discrepancy struct {
+	Type          DiscrepancyType         `json:"type"`
+	ExternalID    string                  `json:"external_id"`
+	PaymentID     *uuid.UUID              `json:"payment_id,omitempty"`
+	LocalAmount   string                  `json:"local_amount,omitempty"`
+	GatewayAmount string                  `json:"gateway_amount,omitempty"`
+	LocalStatus   datastore.PaymentStatus `json:"local_status,omitempty"`
+	GatewayStatus datastore.PaymentStatus `json:"gateway_status,omitempty"`
+}
+
+type Report struct {
+	Gateway       string        `json:"gateway"`
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	Matched       int           `json:"matched"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Period of the settlement report, payments are reconciled by their creation time.
+type Period struct {
+	From time.Time // inclusive
+	To   time.Time // exclusive
+}
+
+type paymentOwner interface {
+	// Owns reports whether the payment with the given external ID has been created by the gateway
+	Owns(externalID string) bool
+}
+
+// Source describes the settlement reports of the given gateway, every gateway has its own format.
+type Source struct {
+	Gateway string
+	Owner   paymentOwner
+	Parser  Parser
+}
+
+type repository interface {
+	GetByExternalID(_ context.Context, extID string) (datastore.Payment, error)
+	List(context.Context, datastore.ListQuery) (datastore.ListResult, error)
+}
+
+// Reconciler compares settlement reports with our payments.
+type Reconciler struct {
+	repository repository
+	batchSize  int
+}
+
+func NewReconciler(repository repository) *Reconciler {
+	return &Reconciler{repository: repository, batchSize: 100}
+}
+
+// Reconcile matches the records of the report to our payments by the external ID,
+// and then looks for our paid payments of the gateway created in the given period, which are missing in the report.
+func (r *Reconciler) Reconcile(ctx context.Context, s Source, report io.Reader, period Period) (_ Report, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Reconciler.Reconcile(%+q): %w", s.Gateway, err)
+		}
+	}()
+
+	records, err := s.Parser.Parse(report)
+	if err != nil {
+		return Report{}, fmt.Errorf("could not parse report: %w", err)
+	}
+
+	result := Report{Gateway: s.Gateway, From: period.From, To: period.To, Discrepancies: make([]Discrepancy, 0)}
+	settled := make(map[string]struct{}, len(records))
+
+	for _, record := range records {
+		settled[record.ExternalID] = struct{}{}
+
+		p, err := r.repository.GetByExternalID(ctx, record.ExternalID)
+		if errors.Is(err, datastore.ErrNotFound) {
+			result.Discrepancies = append(result.Discrepancies, Discrepancy{
+				Type:          MissingLocally,
+				ExternalID:    record.ExternalID,
+				GatewayAmount: record.Amount.String(),
+				GatewayStatus: record.Status,
+			})
+
+			continue
+		}
+		if err != nil {
+			return Report{}, fmt.Errorf("could not fetch payment %+q: %w", record.ExternalID, err)
+		}
+
+		if d, ok := compare(p, record); ok {
+			result.Discrepancies = append(result.Discrepancies, d...)
+			continue
+		}
+
+		result.Matched++
+	}
+
+	q := datastore.ListQuery{CreatedFrom: period.From, CreatedTo: period.To, Limit: r.batchSize}
+
+	for {
+		page, err := r.repository.List(ctx, q)
+		if err != nil {
+			return Report{}, fmt.Errorf("could not list payments: %w", err)
+		}
+
+		for _, p := range page.Payments {
+			if _, ok := settled[p.ExternalID]; ok || !s.Owner.Owns(p.ExternalID) || !shouldBeSettled(p.Status) {
+				continue
+			}
+
+			id := p.ID
+			result.Discrepancies = append(result.Discrepancies, Discrepancy{
+				Type:        MissingAtGateway,
+				ExternalID:  p.ExternalID,
+				PaymentID:   &id,
+				LocalAmount: p.CapturedAmount().String(),
+				LocalStatus: p.Status,
+			})
+		}
+
+		if page.NextCursor == "" {
+			return result, nil
+		}
+
+		q.Cursor = page.NextCursor
+	}
+}
+
+// compare returns the discrepancies between the payment and the record, false when they match.
+func compare(p datastore.Payment, record Record) ([]Discrepancy, bool) {
+	var result []Discrepancy
+
+	id := p.ID
+	local := p.CapturedAmount()
+
+	if !local.Currency.Is(record.Amount.Currency) || local.ToFractional() != record.Amount.ToFractional() {
+		result = append(result, Discrepancy{
+			Type:          AmountMismatch,
+			ExternalID:    p.ExternalID,
+			PaymentID:     &id,
+			LocalAmount:   local.String(),
+			GatewayAmount: record.Amount.String(),
+		})
+	}
+
+	if settledStatus(p.Status) != record.Status {
+		result = append(result, Discrepancy{
+			Type:          StatusMismatch,
+			ExternalID:    p.ExternalID,
+			PaymentID:     &id,
+			LocalStatus:   p.Status,
+			GatewayStatus: record.Status,
+		})
+	}
+
+	return result, len(result) > 0
+}
+
+// settledStatus maps our status to the one reported by gateways, partial refunds are settled as paid.
+func settledStatus(s datastore.PaymentStatus) datastore.PaymentStatus {
+	switch s {
+	case datastore.PaymentPartiallyRefunded, datastore.PaymentRefundPending:
+		return datastore.PaymentPaid
+	}
+
+	return s
+}
+
+func shouldBeSettled(s datastore.PaymentStatus) bool {
+	switch settledStatus(s) {
+	case datastore.PaymentPaid, datastore.PaymentRefunded:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,158 @@
+package reconciliation_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+	"payments/reconciliation"
+)
+
+type ownerMock struct{}
+
+func (ownerMock) Owns(externalID string) bool {
+	return strings.HasPrefix(externalID, "json-")
+}
+
+var day = time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+
+func newRepository(t *testing.T) *datastore.InMemoryPaymentRepository {
+	t.Helper()
+
+	ctx := context.Background()
+	repo := datastore.NewInMemoryPaymentRepository()
+
+	for _, x := range []struct {
+		externalID string
+		status     datastore.PaymentStatus
+	}{
+		{"json-matched", datastore.PaymentPaid},
+		{"json-amount", datastore.PaymentPaid},
+		{"json-status", datastore.PaymentPaid},
+		{"json-missing", datastore.PaymentPaid},
+		{"json-unpaid", datastore.PaymentInitiated},
+		{"soap-paid", datastore.PaymentPaid},
+	} {
+		p := datastore.Payment{
+			ID:         uuid.New(),
+			ExternalID: x.externalID,
+			Status:     datastore.PaymentInitiated,
+			Amount:     currency.MustNewAmount(currency.AED, 100, 15),
+			CreatedAt:  day.Add(time.Hour),
+		}
+		require.NoError(t, repo.Create(ctx, p))
+
+		if x.status != datastore.PaymentInitiated {
+			require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, x.status))
+		}
+	}
+
+	return repo
+}
+
+const jsonReport = `{"transactions": [
+	{"id": "json-matched", "amount": "100.15 AED", "status": "paid", "settled_at": "2024-07-01T10:00:00Z"},
+	{"id": "json-amount", "amount": "100.00 AED", "status": "paid", "settled_at": "2024-07-01T10:00:00Z"},
+	{"id": "json-status", "amount": "100.15 AED", "status": "refunded", "settled_at": "2024-07-01T10:00:00Z"},
+	{"id": "json-unknown", "amount": "5.00 AED", "status": "paid", "settled_at": "2024-07-01T10:00:00Z"}
+]}`
+
+func TestReconciler_Reconcile(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepository(t)
+	source := reconciliation.Source{Gateway: "json", Owner: ownerMock{}, Parser: reconciliation.NewJSONParser()}
+
+	report, err := reconciliation.NewReconciler(repo).Reconcile(
+		context.Background(),
+		source,
+		strings.NewReader(jsonReport),
+		reconciliation.Period{From: day, To: day.AddDate(0, 0, 1)},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Matched)
+
+	byType := make(map[reconciliation.DiscrepancyType]reconciliation.Discrepancy)
+	for _, d := range report.Discrepancies {
+		byType[d.Type] = d
+	}
+
+	require.Len(t, report.Discrepancies, 4)
+	assert.Equal(t, "json-unknown", byType[reconciliation.MissingLocally].ExternalID)
+	assert.Equal(t, "json-missing", byType[reconciliation.MissingAtGateway].ExternalID, "unpaid and other gateways' payments are ignored")
+	assert.Equal(t, "100.15 AED", byType[reconciliation.AmountMismatch].LocalAmount)
+	assert.Equal(t, "100.00 AED", byType[reconciliation.AmountMismatch].GatewayAmount)
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefunded), byType[reconciliation.StatusMismatch].GatewayStatus)
+
+	_, err = reconciliation.NewReconciler(repo).Reconcile(context.Background(), source, strings.NewReader(`{"transactions": [{"id": "x", "amount": "1 AED"}]}`), reconciliation.Period{})
+	require.Error(t, err)
+}
+
+func TestCSVParser_Parse(t *testing.T) {
+	t.Parallel()
+
+	records, err := reconciliation.NewCSVParser().Parse(strings.NewReader(
+		"status,external_id,amount_fractions,currency,settled_at\n" +
+			"paid,soap-1,10015,AED,2024-07-01T10:00:00Z\n" +
+			"refunded,soap-2,500,USD,2024-07-01T11:00:00Z\n",
+	))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, reconciliation.Record{
+		ExternalID: "soap-1",
+		Amount:     currency.MustNewAmount(currency.AED, 100, 15),
+		Status:     datastore.PaymentPaid,
+		SettledAt:  time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC),
+	}, records[0])
+
+	_, err = reconciliation.NewCSVParser().Parse(strings.NewReader("external_id,amount_fractions\nsoap-1,100\n"))
+	require.EqualError(t, err, `CSVParser.Parse: missing column "currency"`)
+
+	_, err = reconciliation.NewCSVParser().Parse(strings.NewReader(
+		"external_id,amount_fractions,currency,status,settled_at\nsoap-1,100,EUR,paid,2024-07-01T10:00:00Z\n",
+	))
+	require.ErrorIs(t, err, currency.ErrUnknownCurrency)
+}
+
+func TestJob_RunOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	source := reconciliation.Source{Gateway: "json", Owner: ownerMock{}, Parser: reconciliation.NewJSONParser()}
+
+	job := reconciliation.NewJob(
+		reconciliation.NewReconciler(newRepository(t)),
+		[]reconciliation.Source{source},
+		reconciliation.NewDirFetcher(filepath.Join(dir, "settlements")),
+		reconciliation.NewDirWriter(filepath.Join(dir, "reports")),
+		lock.NewInMemory(lock.Options{TTL: time.Second}),
+		reconciliation.JobOptions{Now: func() time.Time { return day.Add(time.Hour * 30) }},
+	)
+
+	// the report is not delivered yet
+	require.NoError(t, job.RunOnce(ctx))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "settlements", "json"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "settlements", "json", "2024-07-01.json"), []byte(jsonReport), 0o644))
+	require.NoError(t, job.RunOnce(ctx))
+
+	body, err := os.ReadFile(filepath.Join(dir, "reports", "json", "2024-07-01.discrepancies.json"))
+	require.NoError(t, err)
+
+	var report reconciliation.Report
+	require.NoError(t, json.Unmarshal(body, &report))
+	assert.Equal(t, 1, report.Matched)
+	assert.Len(t, report.Discrepancies, 4)
+}
@@ -0,0 +1,154 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"payments/currency"
+	"payments/merchant"
+	"payments/ratelimit"
+)
+
+// ErrDenied is returned when the payment is denied by the risk evaluation.
+var ErrDenied = errors.New("payment denied by the risk evaluation")
+
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	// Review holds the payment until it's approved manually
+	Review Decision = "review"
+	Deny   Decision = "deny"
+)
+
+// severity orders decisions, the strictest one wins.
+func (d Decision) severity() int {
+	switch d {
+	case Review:
+		return 1
+	case Deny:
+		return 2
+	}
+
+	return 0
+}
+
+// Assessment is the result of the evaluation, reasons are meant for the back office, not for the merchant.
+type Assessment struct {
+	Decision Decision
+	Reasons  []string
+}
+
+// Input is the payment being initiated.
+type Input struct {
+	PaymentID  uuid.UUID
+	Merchant   merchant.Merchant
+	Amount     currency.Amount
+	CustomerID string
+	// Context is provided by the merchant, e.g. the email or the IP address of the customer
+	Context map[string]any
+}
+
+// field returns the value of the customer ID or the context field.
+func (in Input) field(name string) string {
+	if name == "customer_id" {
+		return in.CustomerID
+	}
+
+	v, ok := in.Context[name]
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+// Rule evaluates a single aspect of the payment, see [NewEngine].
+type Rule func(context.Context, Input) (Assessment, error)
+
+// Engine is a simple rules engine, all the rules are evaluated, the strictest decision wins.
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+func (e *Engine) Evaluate(ctx context.Context, in Input) (Assessment, error) {
+	result := Assessment{Decision: Allow}
+
+	for _, rule := range e.rules {
+		a, err := rule(ctx, in)
+		if err != nil {
+			return Assessment{}, fmt.Errorf("Engine.Evaluate(%+q): %w", in.PaymentID, err)
+		}
+
+		if a.Decision.severity() > result.Decision.severity() {
+			result.Decision = a.Decision
+		}
+
+		result.Reasons = append(result.Reasons, a.Reasons...)
+	}
+
+	return result, nil
+}
+
+// Blocklist denies payments with the blocked value of the field, the field is either "customer_id", or the name of the context field.
+func Blocklist(field string, values ...string) Rule {
+	return func(_ context.Context, in Input) (Assessment, error) {
+		v := in.field(field)
+		if v == "" || !slices.Contains(values, v) {
+			return Assessment{Decision: Allow}, nil
+		}
+
+		return Assessment{Decision: Deny, Reasons: []string{fmt.Sprintf("%s is blocklisted", field)}}, nil
+	}
+}
+
+// AmountThreshold holds payments above review for the review, and denies payments above deny (fractions, zero disables the threshold).
+func AmountThreshold(c currency.Currency, review, deny uint) Rule {
+	return func(_ context.Context, in Input) (Assessment, error) {
+		if in.Amount.Currency.Code != c.Code {
+			return Assessment{Decision: Allow}, nil
+		}
+
+		amount := in.Amount.ToFractional()
+
+		switch {
+		case deny > 0 && amount > deny:
+			return Assessment{Decision: Deny, Reasons: []string{fmt.Sprintf("amount exceeds %s", currency.NewAmountFromFractions(c, deny))}}, nil
+		case review > 0 && amount > review:
+			return Assessment{Decision: Review, Reasons: []string{fmt.Sprintf("amount exceeds %s", currency.NewAmountFromFractions(c, review))}}, nil
+		}
+
+		return Assessment{Decision: Allow}, nil
+	}
+}
+
+type rateLimiter interface {
+	Allow(_ context.Context, key string, l ratelimit.Limit) error
+}
+
+// Velocity holds payments of the customer exceeding the limit for the review, payments without the customer are not checked.
+// Unlike the limits, every attempt is counted, so card testing is caught even when payments are declined.
+func Velocity(limiter rateLimiter, l ratelimit.Limit) Rule {
+	return func(ctx context.Context, in Input) (Assessment, error) {
+		if in.CustomerID == "" {
+			return Assessment{Decision: Allow}, nil
+		}
+
+		err := limiter.Allow(ctx, fmt.Sprintf("risk:%s:%s", in.Merchant.ID, in.CustomerID), l)
+		if errors.Is(err, ratelimit.ErrLimitExceeded) {
+			return Assessment{Decision: Review, Reasons: []string{"too many payments of the customer"}}, nil
+		}
+		if err != nil {
+			return Assessment{}, err
+		}
+
+		return Assessment{Decision: Allow}, nil
+	}
+}
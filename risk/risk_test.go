@@ -0,0 +1,93 @@
+package risk_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/merchant"
+	"payments/ratelimit"
+	"payments/risk"
+)
+
+func TestEngine(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	engine := risk.NewEngine(
+		risk.Blocklist("customer_id", "fraudster"),
+		risk.Blocklist("email", "fraud@example.com"),
+		risk.AmountThreshold(currency.AED, 100_000, 500_000),
+		risk.Velocity(ratelimit.NewInMemory(), ratelimit.Limit{Rate: 0.001, Burst: 2}),
+	)
+
+	input := func(units uint, customerID string, context map[string]any) risk.Input {
+		return risk.Input{
+			PaymentID:  uuid.New(),
+			Merchant:   merchant.Merchant{ID: uuid.New()},
+			Amount:     currency.MustNewAmount(currency.AED, units, 0),
+			CustomerID: customerID,
+			Context:    context,
+		}
+	}
+
+	scenarios := map[string]struct {
+		input    risk.Input
+		decision risk.Decision
+		reasons  []string
+	}{
+		"Allow":              {input: input(100, "customer", nil), decision: risk.Allow},
+		"Blocked customer":   {input: input(100, "fraudster", nil), decision: risk.Deny, reasons: []string{"customer_id is blocklisted"}},
+		"Blocked context":    {input: input(100, "", map[string]any{"email": "fraud@example.com"}), decision: risk.Deny, reasons: []string{"email is blocklisted"}},
+		"Review threshold":   {input: input(1_001, "", nil), decision: risk.Review, reasons: []string{"amount exceeds 1000.00 AED"}},
+		"Deny threshold":     {input: input(5_001, "", nil), decision: risk.Deny, reasons: []string{"amount exceeds 5000.00 AED"}},
+		"Other currency":     {input: risk.Input{Amount: currency.MustNewAmount(currency.USD, 10_000, 0)}, decision: risk.Allow},
+		"The strictest wins": {input: input(1_001, "fraudster", nil), decision: risk.Deny, reasons: []string{"customer_id is blocklisted", "amount exceeds 1000.00 AED"}},
+	}
+
+	for name, s := range scenarios {
+		s := s
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			a, err := engine.Evaluate(ctx, s.input)
+			require.NoError(t, err)
+			assert.Equal(t, s.decision, a.Decision)
+			assert.Equal(t, s.reasons, a.Reasons)
+		})
+	}
+
+	t.Run("Velocity", func(t *testing.T) {
+		t.Parallel()
+
+		in := input(100, "customer-1", nil)
+
+		for range 2 {
+			a, err := engine.Evaluate(ctx, in)
+			require.NoError(t, err)
+			assert.Equal(t, risk.Allow, a.Decision)
+		}
+
+		a, err := engine.Evaluate(ctx, in)
+		require.NoError(t, err)
+		assert.Equal(t, risk.Review, a.Decision)
+		assert.Equal(t, []string{"too many payments of the customer"}, a.Reasons)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+
+		failing := risk.NewEngine(func(context.Context, risk.Input) (risk.Assessment, error) {
+			return risk.Assessment{}, errors.New("scoring service is unavailable")
+		})
+
+		_, err := failing.Evaluate(ctx, input(100, "", nil))
+		require.Error(t, err)
+	})
+}
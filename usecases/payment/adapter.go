@@ -2,6 +2,7 @@ package payment
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"payments/gateways"
@@ -9,6 +10,7 @@ import (
 
 type GatewayInitiate interface {
 	InitiatePayment(context.Context, gateways.InitiateRequest) (gateways.InitiateResponse, error)
+	Authorize(context.Context, gateways.InitiateRequest) (gateways.InitiateResponse, error)
 }
 
 type GatewayInitiatorAdapter struct {
@@ -26,16 +28,34 @@ func (i *GatewayInitiatorAdapter) InitiatePayment(ctx context.Context, req Gatew
 		}
 	}()
 
-	resp, err := i.gateway.InitiatePayment(ctx, gateways.InitiateRequest{
-		Amount:  req.Amount,
-		Context: req.Context,
+	initiate := i.gateway.InitiatePayment
+	if req.ManualCapture {
+		initiate = i.gateway.Authorize
+	}
+
+	resp, err := initiate(ctx, gateways.InitiateRequest{
+		MerchantID: req.MerchantID,
+		Amount:     req.Amount,
+		Context:    req.Context,
+		Gateways:   req.Gateways,
 	})
 	if err != nil {
 		return GatewayInitResponse{}, err
 	}
 
+	var nextAction *NextAction
+	if resp.NextAction != nil {
+		nextAction = &NextAction{
+			Type:             NextActionType(resp.NextAction.Type),
+			RedirectURL:      resp.NextAction.RedirectURL,
+			ThreeDSecureData: resp.NextAction.ThreeDSecureData,
+		}
+	}
+
 	return GatewayInitResponse{
 		ExternalID: resp.ExternalID,
+		NextAction: nextAction,
+		Fee:        resp.Fee,
 	}, nil
 }
 
@@ -50,13 +70,77 @@ type GatewayRefunderAdapter struct {
 func (g GatewayRefunderAdapter) Refund(ctx context.Context, request GatewayRefundRequest) (GatewayRefundResponse, error) {
 	resp, err := g.gateway.Refund(ctx, gateways.RefundRequest{
 		ExternalID: request.ExternalID,
+		ID:         request.RefundID,
+		Amount:     request.Amount,
+		MerchantID: request.MerchantID,
 	})
 	if err != nil {
 		return GatewayRefundResponse{}, fmt.Errorf("gateway error: %w", err)
 	}
-	return GatewayRefundResponse{OK: resp.OK}, nil
+	return GatewayRefundResponse{OK: resp.OK, ExternalID: resp.ExternalID, Pending: resp.Pending, Fee: resp.Fee}, nil
 }
 
 func NewGatewayRefunderAdapter(gateway GatewayRefunder) *GatewayRefunderAdapter {
 	return &GatewayRefunderAdapter{gateway: gateway}
 }
+
+type GatewayAuthorization interface {
+	Capture(context.Context, gateways.CaptureRequest) (gateways.CaptureResponse, error)
+	Void(context.Context, gateways.VoidRequest) (gateways.VoidResponse, error)
+	Cancel(context.Context, gateways.CancelRequest) (gateways.CancelResponse, error)
+	QueryStatus(context.Context, gateways.StatusRequest) (gateways.StatusResponse, error)
+}
+
+type GatewayAuthorizationAdapter struct {
+	gateway GatewayAuthorization
+}
+
+func NewGatewayAuthorizationAdapter(gateway GatewayAuthorization) *GatewayAuthorizationAdapter {
+	return &GatewayAuthorizationAdapter{gateway: gateway}
+}
+
+func (g GatewayAuthorizationAdapter) Capture(ctx context.Context, request GatewayCaptureRequest) (GatewayCaptureResponse, error) {
+	resp, err := g.gateway.Capture(ctx, gateways.CaptureRequest{
+		ExternalID: request.ExternalID,
+		Amount:     request.Amount,
+		Partial:    request.Partial,
+	})
+	if err != nil {
+		return GatewayCaptureResponse{}, fmt.Errorf("gateway error: %w", err)
+	}
+
+	return GatewayCaptureResponse{OK: resp.OK}, nil
+}
+
+func (g GatewayAuthorizationAdapter) Void(ctx context.Context, request GatewayVoidRequest) (GatewayVoidResponse, error) {
+	resp, err := g.gateway.Void(ctx, gateways.VoidRequest{ExternalID: request.ExternalID})
+	if err != nil {
+		return GatewayVoidResponse{}, fmt.Errorf("gateway error: %w", err)
+	}
+
+	return GatewayVoidResponse{OK: resp.OK}, nil
+}
+
+func (g GatewayAuthorizationAdapter) Cancel(ctx context.Context, request GatewayCancelRequest) (GatewayCancelResponse, error) {
+	resp, err := g.gateway.Cancel(ctx, gateways.CancelRequest{ExternalID: request.ExternalID})
+	if errors.Is(err, gateways.ErrNotSupported) {
+		return GatewayCancelResponse{NotSupported: true}, nil
+	}
+	if err != nil {
+		return GatewayCancelResponse{}, fmt.Errorf("gateway error: %w", err)
+	}
+
+	return GatewayCancelResponse{OK: resp.OK}, nil
+}
+
+func (g GatewayAuthorizationAdapter) QueryStatus(ctx context.Context, request GatewayStatusRequest) (GatewayStatusResponse, error) {
+	resp, err := g.gateway.QueryStatus(ctx, gateways.StatusRequest{ExternalID: request.ExternalID})
+	if errors.Is(err, gateways.ErrNotSupported) {
+		return GatewayStatusResponse{NotSupported: true}, nil
+	}
+	if err != nil {
+		return GatewayStatusResponse{}, fmt.Errorf("gateway error: %w", err)
+	}
+
+	return GatewayStatusResponse{Status: resp.Status}, nil
+}
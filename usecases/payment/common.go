@@ -2,30 +2,63 @@ package payment
 
 import (
 	"context"
+	"errors"
 
 	"github.com/google/uuid"
 	"payments/currency"
 	"payments/datastore"
+	"payments/merchant"
 )
 
+// ErrGateway wraps all the errors returned by gateways.
+var ErrGateway = errors.New("gateway error")
+
 type InitiateRequest struct {
-	ID      uuid.UUID
-	Amount  currency.Amount
-	Context map[string]any // TODO I assume in the future we may need some extra gateway-specific details
+	ID uuid.UUID
+	// Merchant owns the payment, its configuration limits currencies and gateways
+	Merchant          merchant.Merchant
+	Amount            currency.Amount
+	MerchantReference string
+	// CustomerID identifies the customer of the merchant, payments of the customer are limited by velocity rules
+	CustomerID string
+	// ManualCapture means that the payment is authorized only, it must be captured or voided later
+	ManualCapture bool
+	Context       map[string]any // TODO I assume in the future we may need some extra gateway-specific details
 }
 
 type InitiateResponse struct {
-	Payment datastore.Payment
+	Payment    datastore.Payment
+	NextAction *NextAction
+}
+
+type NextActionType string
+
+const (
+	NextActionRedirect     NextActionType = "redirect"
+	NextActionThreeDSecure NextActionType = "three_d_secure"
+)
+
+// NextAction is required by the gateway to complete the payment (e.g. redirect, 3DS challenge).
+type NextAction struct {
+	Type             NextActionType
+	RedirectURL      string
+	ThreeDSecureData map[string]string
 }
 
 type GatewayInitRequest struct {
-	ID      uuid.UUID
-	Amount  currency.Amount
-	Context map[string]any
+	ID            uuid.UUID
+	MerchantID    uuid.UUID
+	Amount        currency.Amount
+	ManualCapture bool
+	Context       map[string]any
+	// Gateways allowed by the merchant, all of them when empty
+	Gateways []string
 }
 
 type GatewayInitResponse struct {
 	ExternalID string
+	NextAction *NextAction
+	Fee        currency.Amount
 }
 
 type UpdateStatusRequest struct {
@@ -47,18 +80,166 @@ type endpointRefund interface {
 	RefundPayment(context.Context, RefundRequest) (RefundResponse, error)
 }
 
+type endpointGet interface {
+	GetPayment(context.Context, GetPaymentRequest) (GetPaymentResponse, error)
+}
+
+type GetPaymentRequest struct {
+	ID         uuid.UUID
+	MerchantID uuid.UUID
+}
+
+type GetPaymentResponse struct {
+	Payment datastore.Payment
+}
+
+type endpointList interface {
+	ListPayments(context.Context, ListPaymentsRequest) (ListPaymentsResponse, error)
+}
+
+type ListPaymentsRequest struct {
+	Query datastore.ListQuery
+}
+
+type ListPaymentsResponse struct {
+	Payments   []datastore.Payment
+	NextCursor string
+}
+
 type RefundRequest struct {
-	ID uuid.UUID
+	ID         uuid.UUID // of the payment
+	MerchantID uuid.UUID
+	// RefundID is generated on the client side, unique per refund
+	RefundID uuid.UUID
+	// AmountFractions is optional, the whole refundable amount is refunded when it's nil,
+	// the refund is always in the currency of the payment
+	AmountFractions *uint
 }
 
 type RefundResponse struct {
-	OK bool
+	// OK is true when the refund is accepted, it's processed asynchronously, see [RefundProcessor]
+	OK      bool
+	Refund  datastore.Refund
+	Payment datastore.Payment
 }
 
 type GatewayRefundRequest struct {
-	ExternalID string
+	ExternalID string // of the payment
+	RefundID   uuid.UUID
+	Amount     currency.Amount
+	MerchantID uuid.UUID
 }
 
 type GatewayRefundResponse struct {
+	OK         bool
+	ExternalID string // of the refund
+	Pending    bool
+	Fee        currency.Amount
+}
+
+type endpointCapture interface {
+	CapturePayment(context.Context, CaptureRequest) (CaptureResponse, error)
+}
+
+type CaptureRequest struct {
+	ID         uuid.UUID
+	MerchantID uuid.UUID
+	// AmountFractions is optional, the whole authorized amount is captured when it's nil
+	AmountFractions *uint
+}
+
+type CaptureResponse struct {
+	Payment datastore.Payment
+}
+
+type GatewayCaptureRequest struct {
+	ExternalID string // of the payment
+	Amount     currency.Amount
+	Partial    bool
+}
+
+type GatewayCaptureResponse struct {
 	OK bool
 }
+
+type endpointVoid interface {
+	VoidPayment(context.Context, VoidRequest) (VoidResponse, error)
+}
+
+type VoidRequest struct {
+	ID         uuid.UUID
+	MerchantID uuid.UUID
+}
+
+type VoidResponse struct {
+	Payment datastore.Payment
+}
+
+type GatewayVoidRequest struct {
+	ExternalID string // of the payment
+}
+
+type GatewayVoidResponse struct {
+	OK bool
+}
+
+type endpointCancel interface {
+	CancelPayment(context.Context, CancelRequest) (CancelResponse, error)
+}
+
+type CancelRequest struct {
+	ID         uuid.UUID
+	MerchantID uuid.UUID
+}
+
+type CancelResponse struct {
+	Payment datastore.Payment
+}
+
+type endpointReview interface {
+	ApprovePayment(context.Context, ReviewRequest) (ReviewResponse, error)
+	RejectPayment(context.Context, ReviewRequest) (ReviewResponse, error)
+}
+
+// ReviewRequest is performed by the back office, so it's not limited to the merchant.
+type ReviewRequest struct {
+	ID uuid.UUID
+}
+
+type ReviewResponse struct {
+	Payment datastore.Payment
+	// NextAction of the approved payment, the customer must be asked to complete it
+	NextAction *NextAction
+}
+
+type GatewayCancelRequest struct {
+	ExternalID string // of the payment
+}
+
+type GatewayCancelResponse struct {
+	OK bool
+	// NotSupported means that the gateway cannot cancel payments, so the customer can still pay
+	NotSupported bool
+}
+
+type GatewayStatusRequest struct {
+	ExternalID string // of the payment
+}
+
+type GatewayStatusResponse struct {
+	// Status is the status of the payment at the gateway, [datastore.PaymentInitiated] until the customer completes the payment
+	Status datastore.PaymentStatus
+	// NotSupported means that the gateway cannot report the status, we have to rely on webhooks
+	NotSupported bool
+}
+
+type endpointUpdateRefund interface {
+	UpdateRefundStatus(context.Context, UpdateRefundStatusRequest) (UpdateRefundStatusResponse, error)
+}
+
+type UpdateRefundStatusRequest struct {
+	ExternalID string // of the refund
+	Status     datastore.RefundStatus
+}
+
+type UpdateRefundStatusResponse struct{}
@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+	"payments/lock"
+)
+
+type cancellerGateway interface {
+	Cancel(context.Context, GatewayCancelRequest) (GatewayCancelResponse, error)
+}
+
+type cancelRepository interface {
+	CancelByID(_ context.Context, paymentID uuid.UUID) error
+	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
+}
+
+// EndpointCanceller abandons initiated payments.
+//
+// The "paid" webhook is not blocked by the lock, so it can race with the cancellation:
+// when it's applied first, the cancellation fails with [datastore.ErrInvalidState],
+// when it's applied later (e.g. the gateway cannot cancel payments), the payment is refunded automatically,
+// see [datastore.EventPaymentPaidAfterCancel].
+type EndpointCanceller struct {
+	gateway         cancellerGateway
+	repository      cancelRepository
+	distributedLock distributedLock
+}
+
+func NewEndpointCanceller(
+	gateway cancellerGateway,
+	repository cancelRepository,
+	distributedLock distributedLock,
+) *EndpointCanceller {
+	return &EndpointCanceller{gateway: gateway, repository: repository, distributedLock: distributedLock}
+}
+
+func (e *EndpointCanceller) CancelPayment(ctx context.Context, r CancelRequest) (CancelResponse, error) {
+	lease, err := e.distributedLock.Lock(ctx, paymentLockKey(r.ID))
+	if err != nil {
+		return CancelResponse{}, fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		// the request context might be already cancelled, but we still want to release the lock
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
+
+	p, err := e.repository.GetByID(ctx, r.ID)
+	if err != nil {
+		return CancelResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	if err := ownedBy(p, r.MerchantID); err != nil {
+		return CancelResponse{}, err
+	}
+
+	if p.Status != datastore.PaymentInitiated {
+		return CancelResponse{}, fmt.Errorf("%w: could not cancel, it's not initiated", datastore.ErrInvalidState)
+	}
+
+	resp, err := e.gateway.Cancel(ctx, GatewayCancelRequest{ExternalID: p.ExternalID})
+	if err != nil {
+		return CancelResponse{}, fmt.Errorf("%w: could not cancel: %w", ErrGateway, err)
+	}
+
+	if !resp.OK && !resp.NotSupported {
+		// most likely the customer has just paid, the webhook will follow
+		return CancelResponse{}, fmt.Errorf("%w: cancellation declined by the gateway", datastore.ErrInvalidState)
+	}
+
+	if err := e.repository.CancelByID(ctx, r.ID); err != nil {
+		return CancelResponse{}, fmt.Errorf("db error: %w", err)
+	}
+
+	if p, err = e.repository.GetByID(ctx, r.ID); err != nil {
+		return CancelResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	return CancelResponse{Payment: p}, nil
+}
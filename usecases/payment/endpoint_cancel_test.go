@@ -0,0 +1,99 @@
+package payment_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+	"payments/usecases/payment"
+)
+
+type cancellerMock struct {
+	resp payment.GatewayCancelResponse
+}
+
+func (c cancellerMock) Cancel(context.Context, payment.GatewayCancelRequest) (payment.GatewayCancelResponse, error) {
+	return c.resp, nil
+}
+
+func TestEndpointCanceller_CancelPayment(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, resp payment.GatewayCancelResponse) (*datastore.InMemoryPaymentRepository, datastore.Payment, *payment.EndpointCanceller) {
+		t.Helper()
+
+		repo := datastore.NewInMemoryPaymentRepository()
+		locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+
+		p := datastore.Payment{
+			ID:         uuid.New(),
+			ExternalID: "external-1",
+			Status:     datastore.PaymentInitiated,
+			Amount:     currency.MustNewAmount(currency.AED, 100, 0),
+		}
+		require.NoError(t, repo.Create(ctx, p))
+
+		return repo, p, payment.NewEndpointCanceller(cancellerMock{resp: resp}, repo, locker)
+	}
+
+	t.Run("Cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		_, p, canceller := setup(t, payment.GatewayCancelResponse{OK: true})
+
+		resp, err := canceller.CancelPayment(ctx, payment.CancelRequest{ID: p.ID})
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentCancelled), resp.Payment.Status)
+
+		_, err = canceller.CancelPayment(ctx, payment.CancelRequest{ID: p.ID})
+		require.ErrorIs(t, err, datastore.ErrInvalidState)
+	})
+
+	t.Run("Declined by the gateway", func(t *testing.T) {
+		t.Parallel()
+
+		repo, p, canceller := setup(t, payment.GatewayCancelResponse{OK: false})
+
+		_, err := canceller.CancelPayment(ctx, payment.CancelRequest{ID: p.ID})
+		require.ErrorIs(t, err, datastore.ErrInvalidState)
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentInitiated), got.Status)
+	})
+
+	t.Run("Paid after the cancellation", func(t *testing.T) {
+		t.Parallel()
+
+		repo, p, canceller := setup(t, payment.GatewayCancelResponse{NotSupported: true})
+
+		resp, err := canceller.CancelPayment(ctx, payment.CancelRequest{ID: p.ID})
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentCancelled), resp.Payment.Status)
+
+		// the gateway could not cancel the payment, so the customer paid it anyway
+		_, err = payment.NewEndpointStatusUpdater(repo).UpdatePaymentStatus(ctx, payment.UpdateStatusRequest{
+			ExternalID: p.ExternalID,
+			Status:     datastore.PaymentPaid,
+		})
+		require.NoError(t, err)
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefundPending), got.Status)
+		require.Len(t, got.Refunds, 1)
+		assert.Equal(t, p.Amount, got.Refunds[0].Amount)
+
+		due, err := repo.DueRefunds(ctx, time.Now(), 10)
+		require.NoError(t, err)
+		assert.Len(t, due, 1, "the automatic refund is submitted by the refund processor")
+	})
+}
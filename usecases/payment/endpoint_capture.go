@@ -0,0 +1,95 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+)
+
+type capturerGateway interface {
+	Capture(context.Context, GatewayCaptureRequest) (GatewayCaptureResponse, error)
+}
+
+type captureRepository interface {
+	CaptureByID(_ context.Context, paymentID uuid.UUID, amount currency.Amount) error
+	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
+}
+
+// EndpointCapturer charges authorized payments, see [InitiateRequest.ManualCapture].
+type EndpointCapturer struct {
+	gateway         capturerGateway
+	repository      captureRepository
+	distributedLock distributedLock
+}
+
+func NewEndpointCapturer(
+	gateway capturerGateway,
+	repository captureRepository,
+	distributedLock distributedLock,
+) *EndpointCapturer {
+	return &EndpointCapturer{gateway: gateway, repository: repository, distributedLock: distributedLock}
+}
+
+func (e *EndpointCapturer) CapturePayment(ctx context.Context, r CaptureRequest) (CaptureResponse, error) {
+	lease, err := e.distributedLock.Lock(ctx, paymentLockKey(r.ID))
+	if err != nil {
+		return CaptureResponse{}, fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		// the request context might be already cancelled, but we still want to release the lock
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
+
+	p, err := e.repository.GetByID(ctx, r.ID)
+	if err != nil {
+		return CaptureResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	if err := ownedBy(p, r.MerchantID); err != nil {
+		return CaptureResponse{}, err
+	}
+
+	if p.Status != datastore.PaymentAuthorized {
+		return CaptureResponse{}, fmt.Errorf("%w: could not capture, it's not authorized", datastore.ErrInvalidState)
+	}
+
+	amount := p.Amount
+	if r.AmountFractions != nil {
+		amount = currency.NewAmountFromFractions(p.Amount.Currency, *r.AmountFractions)
+	}
+
+	if amount.IsZero() || amount.ToFractional() > p.Amount.ToFractional() {
+		return CaptureResponse{}, fmt.Errorf("%w: %s authorized, %s given", datastore.ErrInvalidCaptureAmount, p.Amount, amount)
+	}
+
+	resp, err := e.gateway.Capture(ctx, GatewayCaptureRequest{
+		ExternalID: p.ExternalID,
+		Amount:     amount,
+		Partial:    amount.ToFractional() < p.Amount.ToFractional(),
+	})
+	if err != nil {
+		return CaptureResponse{}, fmt.Errorf("%w: could not capture: %w", ErrGateway, err)
+	}
+
+	if !resp.OK {
+		return CaptureResponse{}, fmt.Errorf("%w: capture declined", ErrGateway)
+	}
+
+	if err := e.repository.CaptureByID(ctx, r.ID, amount); err != nil {
+		return CaptureResponse{}, fmt.Errorf("db error: %w", err)
+	}
+
+	if p, err = e.repository.GetByID(ctx, r.ID); err != nil {
+		return CaptureResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	return CaptureResponse{Payment: p}, nil
+}
@@ -0,0 +1,104 @@
+package payment_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+	"payments/usecases/payment"
+)
+
+type authorizationMock struct {
+	captures []payment.GatewayCaptureRequest
+	ok       bool
+}
+
+func (a *authorizationMock) Capture(_ context.Context, r payment.GatewayCaptureRequest) (payment.GatewayCaptureResponse, error) {
+	a.captures = append(a.captures, r)
+
+	return payment.GatewayCaptureResponse{OK: a.ok}, nil
+}
+
+func (a *authorizationMock) Void(context.Context, payment.GatewayVoidRequest) (payment.GatewayVoidResponse, error) {
+	return payment.GatewayVoidResponse{OK: a.ok}, nil
+}
+
+func TestEndpointCapturer_CapturePayment(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, ok bool) (*datastore.InMemoryPaymentRepository, datastore.Payment, *authorizationMock, *payment.EndpointCapturer, *payment.EndpointVoider) {
+		t.Helper()
+
+		repo := datastore.NewInMemoryPaymentRepository()
+		locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+		gateway := &authorizationMock{ok: ok}
+
+		p := datastore.Payment{
+			ID:         uuid.New(),
+			ExternalID: "external-1",
+			Status:     datastore.PaymentInitiated,
+			Amount:     currency.MustNewAmount(currency.AED, 100, 0),
+		}
+		require.NoError(t, repo.Create(ctx, p))
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentAuthorized))
+
+		return repo, p, gateway, payment.NewEndpointCapturer(gateway, repo, locker), payment.NewEndpointVoider(gateway, repo, locker)
+	}
+
+	t.Run("Partial capture", func(t *testing.T) {
+		t.Parallel()
+
+		_, p, gateway, capturer, voider := setup(t, true)
+
+		_, err := capturer.CapturePayment(ctx, payment.CaptureRequest{ID: p.ID, AmountFractions: fractions(10001)})
+		require.ErrorIs(t, err, datastore.ErrInvalidCaptureAmount)
+		assert.Empty(t, gateway.captures)
+
+		resp, err := capturer.CapturePayment(ctx, payment.CaptureRequest{ID: p.ID, AmountFractions: fractions(4000)})
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), resp.Payment.Status)
+		assert.Equal(t, uint(4000), resp.Payment.CapturedAmount().ToFractional())
+		require.Len(t, gateway.captures, 1)
+		assert.True(t, gateway.captures[0].Partial)
+
+		_, err = capturer.CapturePayment(ctx, payment.CaptureRequest{ID: p.ID})
+		require.ErrorIs(t, err, datastore.ErrInvalidState)
+
+		_, err = voider.VoidPayment(ctx, payment.VoidRequest{ID: p.ID})
+		require.ErrorIs(t, err, datastore.ErrInvalidState)
+	})
+
+	t.Run("Declined", func(t *testing.T) {
+		t.Parallel()
+
+		repo, p, _, capturer, voider := setup(t, false)
+
+		_, err := capturer.CapturePayment(ctx, payment.CaptureRequest{ID: p.ID})
+		require.ErrorIs(t, err, payment.ErrGateway)
+
+		_, err = voider.VoidPayment(ctx, payment.VoidRequest{ID: p.ID})
+		require.ErrorIs(t, err, payment.ErrGateway)
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentAuthorized), got.Status)
+	})
+
+	t.Run("Void", func(t *testing.T) {
+		t.Parallel()
+
+		_, p, _, _, voider := setup(t, true)
+
+		resp, err := voider.VoidPayment(ctx, payment.VoidRequest{ID: p.ID})
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentVoided), resp.Payment.Status)
+	})
+}
@@ -0,0 +1,43 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+)
+
+type paymentsGetter interface {
+	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
+}
+
+type EndpointGetter struct {
+	repository paymentsGetter
+}
+
+func NewEndpointGetter(repository paymentsGetter) *EndpointGetter {
+	return &EndpointGetter{repository: repository}
+}
+
+func (e *EndpointGetter) GetPayment(ctx context.Context, r GetPaymentRequest) (GetPaymentResponse, error) {
+	p, err := e.repository.GetByID(ctx, r.ID)
+	if err != nil {
+		return GetPaymentResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	if err := ownedBy(p, r.MerchantID); err != nil {
+		return GetPaymentResponse{}, err
+	}
+
+	return GetPaymentResponse{Payment: p}, nil
+}
+
+// ownedBy reports payments of other merchants as not found, so merchants cannot even learn that they exist.
+func ownedBy(p datastore.Payment, merchantID uuid.UUID) error {
+	if p.MerchantID != merchantID {
+		return fmt.Errorf("%w: payment %+q belongs to another merchant", datastore.ErrNotFound, p.ID)
+	}
+
+	return nil
+}
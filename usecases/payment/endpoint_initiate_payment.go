@@ -2,9 +2,16 @@ package payment
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"payments/datastore"
+	"payments/gateways"
+	"payments/limits"
+	"payments/risk"
 )
 
 type initiatorGateway interface {
@@ -13,47 +20,211 @@ type initiatorGateway interface {
 
 type paymentsCreator interface {
 	Create(context.Context, datastore.Payment) error
+	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
+	GetByMerchantReference(_ context.Context, merchantID uuid.UUID, reference string) (datastore.Payment, error)
+}
+
+type limitsReserver interface {
+	Reserve(context.Context, limits.Payment) (limits.Reservation, error)
+}
+
+// RiskEvaluator assesses payments before they are sent to the gateway, see [risk.Engine].
+// Denied payments are rejected, payments for the review are stored, and wait for the manual approval, see [EndpointReviewer].
+type RiskEvaluator interface {
+	Evaluate(context.Context, risk.Input) (risk.Assessment, error)
 }
 
 type EndpointInitiator struct {
-	gateway    initiatorGateway
-	repository paymentsCreator
+	gateway         initiatorGateway
+	repository      paymentsCreator
+	distributedLock distributedLock
+	limits          limitsReserver
+	risk            RiskEvaluator
+}
+
+func NewEndpointInitiator(gateway initiatorGateway, repository paymentsCreator, distributedLock distributedLock) *EndpointInitiator {
+	return &EndpointInitiator{gateway: gateway, repository: repository, distributedLock: distributedLock}
 }
 
-func NewEndpointInitiator(gateway initiatorGateway, repository paymentsCreator) *EndpointInitiator {
-	return &EndpointInitiator{gateway: gateway, repository: repository}
+// WithLimits enforces transaction limits and velocity rules before the payment is sent to the gateway.
+func (e *EndpointInitiator) WithLimits(l limitsReserver) *EndpointInitiator {
+	e.limits = l
+	return e
+}
+
+// WithRisk evaluates the risk of the payment after the limits, so the payments rejected by the limits are not evaluated.
+func (e *EndpointInitiator) WithRisk(r RiskEvaluator) *EndpointInitiator {
+	e.risk = r
+	return e
 }
 
 // InitiatePayment initiates payment.
 // NOTE:
 // The returning error message is used for logging purposes,
 // it cannot contain any sensitive details.
-func (e *EndpointInitiator) InitiatePayment(ctx context.Context, r InitiateRequest) (InitiateResponse, error) {
+func (e *EndpointInitiator) InitiatePayment(ctx context.Context, r InitiateRequest) (_ InitiateResponse, err error) {
+	if !r.Merchant.Accepts(r.Amount.Currency) {
+		return InitiateResponse{}, fmt.Errorf("%w: %s is not accepted by the merchant", gateways.ErrUnsupportedCurrency, r.Amount.Currency.Code)
+	}
+
+	// the payment is created at the gateway before it's stored, so duplicates must be rejected before the gateway is called,
+	// locks guard the check against concurrent requests with the same ID or merchant reference
+	keys := []string{paymentLockKey(r.ID)}
+	if r.MerchantReference != "" {
+		keys = append(keys, merchantReferenceLockKey(r.Merchant.ID, r.MerchantReference))
+	}
+
+	for _, key := range keys {
+		lease, err := e.distributedLock.Lock(ctx, key)
+		if err != nil {
+			return InitiateResponse{}, fmt.Errorf("could not acquire lock: %w", err)
+		}
+
+		defer func() {
+			// the request context might be already cancelled, but we still want to release the lock
+			_ = lease.Unlock(context.WithoutCancel(ctx))
+		}()
+	}
+
+	if err := e.checkUnique(ctx, r); err != nil {
+		return InitiateResponse{}, err
+	}
+
+	var reservation limits.Reservation
+
+	if e.limits != nil {
+		reservation, err = e.limits.Reserve(ctx, limits.Payment{MerchantID: r.Merchant.ID, CustomerID: r.CustomerID, Amount: r.Amount})
+		if err != nil {
+			return InitiateResponse{}, fmt.Errorf("payment is not allowed: %w", err)
+		}
+	}
+
+	// the volume is counted for initiated payments only,
+	// payments held for the review are counted once approved, so rejected payments don't consume the limits
+	held := false
+
+	defer func() {
+		if err == nil && !held {
+			return
+		}
+
+		if releaseErr := reservation.Release(context.WithoutCancel(ctx)); releaseErr != nil {
+			err = fmt.Errorf("%w (could not release the limits: %s)", err, releaseErr)
+		}
+	}()
+
+	if e.risk != nil {
+		a, err := e.risk.Evaluate(ctx, risk.Input{
+			PaymentID:  r.ID,
+			Merchant:   r.Merchant,
+			Amount:     r.Amount,
+			CustomerID: r.CustomerID,
+			Context:    r.Context,
+		})
+		if err != nil {
+			// we don't know the risk, so the payment is not sent to the gateway
+			return InitiateResponse{}, fmt.Errorf("could not evaluate the risk: %w", err)
+		}
+
+		switch a.Decision {
+		case risk.Deny:
+			return InitiateResponse{}, fmt.Errorf("%w: %s", risk.ErrDenied, strings.Join(a.Reasons, ", "))
+		case risk.Review:
+			held = true
+			return e.holdForReview(ctx, r, a.Reasons)
+		}
+	}
+
 	resp, err := e.gateway.InitiatePayment(ctx, GatewayInitRequest{
-		ID:      r.ID,
-		Amount:  r.Amount,
-		Context: r.Context,
+		ID:            r.ID,
+		MerchantID:    r.Merchant.ID,
+		Amount:        r.Amount,
+		ManualCapture: r.ManualCapture,
+		Context:       r.Context,
+		Gateways:      r.Merchant.Gateways,
 	})
 	if err != nil {
-		return InitiateResponse{}, fmt.Errorf("could not initiate payment: %w", err)
+		return InitiateResponse{}, fmt.Errorf("%w: could not initiate payment: %w", ErrGateway, err)
+	}
+
+	now := time.Now().UTC()
+	fee := resp.Fee
+
+	p := datastore.Payment{
+		ID:                r.ID,
+		MerchantID:        r.Merchant.ID,
+		ExternalID:        resp.ExternalID,
+		Status:            datastore.PaymentInitiated,
+		Amount:            r.Amount,
+		MerchantReference: r.MerchantReference,
+		CustomerID:        r.CustomerID,
+		ManualCapture:     r.ManualCapture,
+		Context:           r.Context,
+		Fee:               &fee,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
+	if err := e.repository.Create(ctx, p); err != nil {
+		return InitiateResponse{}, fmt.Errorf("could not persist payment in the DB: %w", err)
+	}
+
+	return e.initiateResponseFromPayment(p, resp.NextAction), err
+}
+
+// checkUnique rejects the payment with the ID or the merchant reference already in use, the caller must hold the locks.
+func (e *EndpointInitiator) checkUnique(ctx context.Context, r InitiateRequest) error {
+	_, err := e.repository.GetByID(ctx, r.ID)
+	if err == nil {
+		return datastore.ErrDuplicate
+	}
+	if !errors.Is(err, datastore.ErrNotFound) {
+		return fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	if r.MerchantReference == "" {
+		return nil
+	}
+
+	_, err = e.repository.GetByMerchantReference(ctx, r.Merchant.ID, r.MerchantReference)
+	if err == nil {
+		return fmt.Errorf("%w: the same merchant reference", datastore.ErrDuplicate)
+	}
+	if !errors.Is(err, datastore.ErrNotFound) {
+		return fmt.Errorf("could not fetch by merchant reference: %w", err)
+	}
+
+	return nil
+}
+
+// holdForReview stores the payment without sending it to the gateway, the limits are reserved again by [EndpointReviewer.ApprovePayment].
+func (e *EndpointInitiator) holdForReview(ctx context.Context, r InitiateRequest, reasons []string) (InitiateResponse, error) {
+	now := time.Now().UTC()
+
 	p := datastore.Payment{
-		ID:         r.ID,
-		ExternalID: resp.ExternalID,
-		Status:     datastore.PaymentInitiated,
-		Amount:     r.Amount,
+		ID:                r.ID,
+		MerchantID:        r.Merchant.ID,
+		Status:            datastore.PaymentReview,
+		Amount:            r.Amount,
+		MerchantReference: r.MerchantReference,
+		CustomerID:        r.CustomerID,
+		ManualCapture:     r.ManualCapture,
+		Context:           r.Context,
+		RiskReasons:       reasons,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
 	if err := e.repository.Create(ctx, p); err != nil {
 		return InitiateResponse{}, fmt.Errorf("could not persist payment in the DB: %w", err)
 	}
 
-	return e.initiateResponseFromPayment(p), err
+	return e.initiateResponseFromPayment(p, nil), nil
 }
 
-func (e *EndpointInitiator) initiateResponseFromPayment(p datastore.Payment) InitiateResponse {
+func (e *EndpointInitiator) initiateResponseFromPayment(p datastore.Payment, nextAction *NextAction) InitiateResponse {
 	return InitiateResponse{
-		Payment: p,
+		Payment:    p,
+		NextAction: nextAction,
 	}
 }
@@ -0,0 +1,90 @@
+package payment_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/limits"
+	"payments/lock"
+	"payments/merchant"
+	"payments/ratelimit"
+	"payments/usecases/payment"
+)
+
+func TestEndpointInitiator_WithLimits(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	checker := limits.NewChecker(limits.Config{
+		Default: limits.Rules{
+			Currencies:              map[string]limits.CurrencyLimits{"AED": {Max: 100_000, Daily: 150_000}},
+			CustomerPaymentsPerHour: 1,
+		},
+	}, ratelimit.NewInMemory())
+
+	request := func(units uint, customerID string) payment.InitiateRequest {
+		return payment.InitiateRequest{ID: uuid.New(), Merchant: m, CustomerID: customerID, Amount: currency.MustNewAmount(currency.AED, units, 0)}
+	}
+
+	gateway := &gatewayInitiatorMock{}
+	repo := datastore.NewInMemoryPaymentRepository()
+	locker := lock.NewInMemory(lock.Options{})
+	initiator := payment.NewEndpointInitiator(gateway, repo, locker).WithLimits(checker)
+
+	_, err := initiator.InitiatePayment(ctx, request(1001, ""))
+	require.ErrorIs(t, err, limits.ErrAmountTooLarge)
+	assert.Empty(t, gateway.calls, "the gateway must not be called")
+
+	resp, err := initiator.InitiatePayment(ctx, request(1000, "customer-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "customer-1", resp.Payment.CustomerID)
+
+	_, err = initiator.InitiatePayment(ctx, request(100, "customer-1"))
+	require.ErrorIs(t, err, limits.ErrVelocityExceeded)
+
+	// the payment rejected by the gateway does not count
+	failing := payment.NewEndpointInitiator(&gatewayInitiatorMock{err: errors.New("declined")}, repo, locker).WithLimits(checker)
+	_, err = failing.InitiatePayment(ctx, request(500, "customer-2"))
+	require.ErrorIs(t, err, payment.ErrGateway)
+
+	_, err = initiator.InitiatePayment(ctx, request(500, "customer-2"))
+	require.NoError(t, err)
+
+	_, err = initiator.InitiatePayment(ctx, request(1, ""))
+	require.ErrorIs(t, err, limits.ErrDailyLimitExceeded)
+	assert.Len(t, gateway.calls, 2)
+}
+
+func TestEndpointInitiator_Duplicate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	gateway := &gatewayInitiatorMock{}
+	initiator := payment.NewEndpointInitiator(gateway, datastore.NewInMemoryPaymentRepository(), lock.NewInMemory(lock.Options{}))
+
+	r := payment.InitiateRequest{ID: uuid.New(), Merchant: m, Amount: currency.MustNewAmount(currency.AED, 100, 0), MerchantReference: "order-1"}
+	_, err := initiator.InitiatePayment(ctx, r)
+	require.NoError(t, err)
+
+	_, err = initiator.InitiatePayment(ctx, r)
+	require.ErrorIs(t, err, datastore.ErrDuplicate)
+
+	r.ID = uuid.New()
+	_, err = initiator.InitiatePayment(ctx, r)
+	require.ErrorIs(t, err, datastore.ErrDuplicate)
+
+	assert.Len(t, gateway.calls, 1, "duplicates must not be sent to the gateway")
+
+	// references are unique per merchant
+	r.Merchant = merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	_, err = initiator.InitiatePayment(ctx, r)
+	require.NoError(t, err)
+}
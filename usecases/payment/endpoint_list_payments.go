@@ -0,0 +1,32 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"payments/datastore"
+)
+
+type paymentsLister interface {
+	List(context.Context, datastore.ListQuery) (datastore.ListResult, error)
+}
+
+type EndpointLister struct {
+	repository paymentsLister
+}
+
+func NewEndpointLister(repository paymentsLister) *EndpointLister {
+	return &EndpointLister{repository: repository}
+}
+
+func (e *EndpointLister) ListPayments(ctx context.Context, r ListPaymentsRequest) (ListPaymentsResponse, error) {
+	result, err := e.repository.List(ctx, r.Query)
+	if err != nil {
+		return ListPaymentsResponse{}, fmt.Errorf("could not list payments: %w", err)
+	}
+
+	return ListPaymentsResponse{
+		Payments:   result.Payments,
+		NextCursor: result.NextCursor,
+	}, nil
+}
@@ -5,62 +5,85 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
+	"payments/currency"
 	"payments/datastore"
+	"payments/lock"
 )
 
 type distributedLock interface {
-	Lock(string) (unlockFn func())
-}
-
-type DistributedLockMock struct {
-}
-
-func (d DistributedLockMock) Lock(s string) (unlockFn func()) {
-	return func() {}
-}
-
-type refunderGateway interface {
-	Refund(context.Context, GatewayRefundRequest) (GatewayRefundResponse, error)
+	Lock(ctx context.Context, key string) (lock.Lease, error)
 }
 
 type refundRepository interface {
-	RefundByID(_ context.Context, paymentID uuid.UUID) error
+	CreateRefund(_ context.Context, paymentID uuid.UUID, r datastore.Refund) error
 	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
 }
 
+// EndpointRefunder accepts refunds, they are submitted to the gateway by [RefundProcessor].
 type EndpointRefunder struct {
-	gateway         refunderGateway
 	repository      refundRepository
 	distributedLock distributedLock
 }
 
-func NewEndpointRefunder(gateway refunderGateway, repository refundRepository) *EndpointRefunder {
-	return &EndpointRefunder{gateway: gateway, repository: repository, distributedLock: DistributedLockMock{}}
+func NewEndpointRefunder(
+	repository refundRepository,
+	distributedLock distributedLock,
+) *EndpointRefunder {
+	return &EndpointRefunder{repository: repository, distributedLock: distributedLock}
 }
 
 func (e *EndpointRefunder) RefundPayment(ctx context.Context, r RefundRequest) (RefundResponse, error) {
-	unlock := e.distributedLock.Lock(fmt.Sprintf("payment:%s", r.ID.String()))
-	defer unlock()
+	lease, err := e.distributedLock.Lock(ctx, paymentLockKey(r.ID))
+	if err != nil {
+		return RefundResponse{}, fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		// the request context might be already cancelled, but we still want to release the lock
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
 
 	p, err := e.repository.GetByID(ctx, r.ID)
 	if err != nil {
 		return RefundResponse{}, fmt.Errorf("could not fetch by id: %w", err)
 	}
 
-	if p.Status != datastore.PaymentPaid {
-		return RefundResponse{}, fmt.Errorf("could not refund, it's not paid")
+	if err := ownedBy(p, r.MerchantID); err != nil {
+		return RefundResponse{}, err
 	}
 
-	resp, err := e.gateway.Refund(ctx, GatewayRefundRequest{ExternalID: p.ExternalID})
-	if err != nil {
-		return RefundResponse{}, fmt.Errorf("gateway error during refund: %w", err)
+	refund := datastore.Refund{ID: r.RefundID, Amount: p.RefundableAmount()}
+	if r.AmountFractions != nil {
+		refund.Amount = currency.NewAmountFromFractions(p.Amount.Currency, *r.AmountFractions)
 	}
 
-	if err := e.repository.RefundByID(ctx, r.ID); err != nil {
-		return RefundResponse{}, fmt.Errorf("db error: %w", err)
+	// the pending refund reserves the amount, so concurrent refunds cannot exceed the paid amount
+	if err := e.repository.CreateRefund(ctx, r.ID, refund); err != nil {
+		return RefundResponse{}, fmt.Errorf("could not create refund: %w", err)
 	}
 
+	if p, err = e.repository.GetByID(ctx, r.ID); err != nil {
+		return RefundResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	refund, _ = p.Refund(refund.ID)
+
 	return RefundResponse{
-		OK: resp.OK,
+		OK:      true,
+		Refund:  refund,
+		Payment: p,
 	}, nil
 }
+
+// paymentLockKey is shared by all the operations that must not be performed concurrently for the same payment.
+func paymentLockKey(id uuid.UUID) string {
+	return fmt.Sprintf("payment:%s", id.String())
+}
+
+// merchantReferenceLockKey guards the merchant reference until the payment is stored.
+func merchantReferenceLockKey(merchantID uuid.UUID, reference string) string {
+	return fmt.Sprintf("merchant-reference:%s:%s", merchantID, reference)
+}
@@ -0,0 +1,192 @@
+package payment_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+	"payments/usecases/payment"
+)
+
+// refunderMock returns the responses in order, the last one is repeated.
+type refunderMock struct {
+	mu        sync.Mutex
+	responses []payment.GatewayRefundResponse
+	errors    []error
+	calls     []payment.GatewayRefundRequest
+}
+
+func (r *refunderMock) Refund(_ context.Context, req payment.GatewayRefundRequest) (payment.GatewayRefundResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := min(len(r.calls), len(r.errors)-1)
+	r.calls = append(r.calls, req)
+
+	if err := r.errors[n]; err != nil {
+		return payment.GatewayRefundResponse{}, err
+	}
+
+	resp := r.responses[min(n, len(r.responses)-1)]
+	resp.ExternalID = "refund-" + req.RefundID.String()
+
+	return resp, nil
+}
+
+func fractions(n uint) *uint {
+	return &n
+}
+
+func TestRefunds(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, gateway *refunderMock) (*datastore.InMemoryPaymentRepository, datastore.Payment, *payment.EndpointRefunder, *payment.RefundProcessor) {
+		t.Helper()
+
+		repo := datastore.NewInMemoryPaymentRepository()
+		locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+
+		p := datastore.Payment{
+			ID:         uuid.New(),
+			ExternalID: "external-1",
+			Status:     datastore.PaymentInitiated,
+			Amount:     currency.MustNewAmount(currency.AED, 100, 0),
+		}
+		require.NoError(t, repo.Create(ctx, p))
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, p.ExternalID, datastore.PaymentPaid))
+
+		processor := payment.NewRefundProcessor(gateway, repo, locker, payment.RefundProcessorOptions{
+			MaxAttempts:    3,
+			InitialBackoff: time.Nanosecond,
+		})
+
+		return repo, p, payment.NewEndpointRefunder(repo, locker), processor
+	}
+
+	t.Run("Partial refunds", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := &refunderMock{responses: []payment.GatewayRefundResponse{{OK: true}}, errors: []error{nil}}
+		repo, p, refunder, processor := setup(t, gateway)
+
+		resp, err := refunder.RefundPayment(ctx, payment.RefundRequest{ID: p.ID, RefundID: uuid.New(), AmountFractions: fractions(2500)})
+		require.NoError(t, err)
+		assert.Equal(t, datastore.RefundPending, resp.Refund.Status)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefundPending), resp.Payment.Status)
+		assert.Empty(t, gateway.calls, "refunds are processed in the background")
+
+		// the pending refund reserves the amount
+		_, err = refunder.RefundPayment(ctx, payment.RefundRequest{ID: p.ID, RefundID: uuid.New(), AmountFractions: fractions(7501)})
+		require.ErrorIs(t, err, datastore.ErrInvalidRefundAmount)
+
+		require.NoError(t, processor.ProcessDue(ctx))
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPartiallyRefunded), got.Status)
+		assert.Equal(t, "refund-"+resp.Refund.ID.String(), got.Refunds[0].ExternalID)
+
+		// the rest of the amount by default
+		resp, err = refunder.RefundPayment(ctx, payment.RefundRequest{ID: p.ID, RefundID: uuid.New()})
+		require.NoError(t, err)
+		assert.Equal(t, uint(7500), resp.Refund.Amount.ToFractional())
+
+		require.NoError(t, processor.ProcessDue(ctx))
+
+		got, err = repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefunded), got.Status)
+		assert.Len(t, gateway.calls, 2)
+	})
+
+	t.Run("Declined", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := &refunderMock{responses: []payment.GatewayRefundResponse{{OK: false}}, errors: []error{nil}}
+		repo, p, refunder, processor := setup(t, gateway)
+
+		_, err := refunder.RefundPayment(ctx, payment.RefundRequest{ID: p.ID, RefundID: uuid.New()})
+		require.NoError(t, err)
+		require.NoError(t, processor.ProcessDue(ctx))
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), got.Status)
+		assert.Equal(t, datastore.RefundFailed, got.Refunds[0].Status)
+		assert.Equal(t, p.Amount, got.RefundableAmount())
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := &refunderMock{
+			responses: []payment.GatewayRefundResponse{{OK: true, Pending: true}},
+			errors:    []error{errors.New("timeout"), nil},
+		}
+		repo, p, refunder, processor := setup(t, gateway)
+
+		_, err := refunder.RefundPayment(ctx, payment.RefundRequest{ID: p.ID, RefundID: uuid.New()})
+		require.NoError(t, err)
+
+		require.NoError(t, processor.ProcessDue(ctx))
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, got.Refunds[0].Attempts)
+
+		time.Sleep(time.Millisecond) // backoff
+		require.NoError(t, processor.ProcessDue(ctx))
+
+		// accepted by the gateway, the final status is sent by the webhook
+		got, err = repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefundPending), got.Status)
+		require.Len(t, gateway.calls, 2)
+		assert.Equal(t, gateway.calls[0].RefundID, gateway.calls[1].RefundID, "refund ID is the idempotency key")
+
+		require.NoError(t, processor.ProcessDue(ctx))
+		assert.Len(t, gateway.calls, 2, "submitted refunds are not processed again")
+
+		updater := payment.NewEndpointRefundStatusUpdater(repo)
+		_, err = updater.UpdateRefundStatus(ctx, payment.UpdateRefundStatusRequest{
+			ExternalID: got.Refunds[0].ExternalID,
+			Status:     datastore.RefundSucceeded,
+		})
+		require.NoError(t, err)
+
+		got, err = repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRefunded), got.Status)
+	})
+
+	t.Run("Out of attempts", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := &refunderMock{errors: []error{errors.New("timeout")}}
+		repo, p, refunder, processor := setup(t, gateway)
+
+		_, err := refunder.RefundPayment(ctx, payment.RefundRequest{ID: p.ID, RefundID: uuid.New()})
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			time.Sleep(time.Millisecond) // backoff
+			require.NoError(t, processor.ProcessDue(ctx))
+		}
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.RefundFailed, got.Refunds[0].Status)
+		assert.Equal(t, "timeout", got.Refunds[0].Reason)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), got.Status)
+	})
+}
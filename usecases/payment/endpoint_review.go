@@ -0,0 +1,162 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/currency"
+	"payments/datastore"
+	"payments/limits"
+	"payments/lock"
+	"payments/merchant"
+)
+
+type reviewRepository interface {
+	ApproveReviewByID(_ context.Context, paymentID uuid.UUID, externalID string, fee *currency.Amount) error
+	RejectReviewByID(_ context.Context, paymentID uuid.UUID) error
+	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
+}
+
+type merchantsGetter interface {
+	GetByID(_ context.Context, id uuid.UUID) (merchant.Merchant, error)
+}
+
+// EndpointReviewer decides on payments held by the risk evaluation, see [EndpointInitiator.WithRisk].
+// Approved payments are sent to the gateway, the merchant configuration (e.g. gateways) is read at the time of the approval.
+type EndpointReviewer struct {
+	gateway         initiatorGateway
+	repository      reviewRepository
+	merchants       merchantsGetter
+	distributedLock distributedLock
+	limits          limitsReserver
+}
+
+func NewEndpointReviewer(
+	gateway initiatorGateway,
+	repository reviewRepository,
+	merchants merchantsGetter,
+	distributedLock distributedLock,
+) *EndpointReviewer {
+	return &EndpointReviewer{gateway: gateway, repository: repository, merchants: merchants, distributedLock: distributedLock}
+}
+
+// WithLimits reserves the limits of the approved payment, it must share the counters with [EndpointInitiator.WithLimits].
+func (e *EndpointReviewer) WithLimits(l limitsReserver) *EndpointReviewer {
+	e.limits = l
+	return e
+}
+
+// ApprovePayment sends the payment to the gateway, the payment stays in the review when the gateway fails or the limits are exceeded,
+// so it can be retried or rejected.
+func (e *EndpointReviewer) ApprovePayment(ctx context.Context, r ReviewRequest) (_ ReviewResponse, err error) {
+	lease, err := e.distributedLock.Lock(ctx, paymentLockKey(r.ID))
+	if err != nil {
+		return ReviewResponse{}, fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		// the request context might be already cancelled, but we still want to release the lock
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
+
+	p, err := e.reviewed(ctx, r.ID)
+	if err != nil {
+		return ReviewResponse{}, err
+	}
+
+	m, err := e.merchants.GetByID(ctx, p.MerchantID)
+	if err != nil {
+		return ReviewResponse{}, fmt.Errorf("could not fetch the merchant: %w", err)
+	}
+
+	var reservation limits.Reservation
+
+	if e.limits != nil {
+		reservation, err = e.limits.Reserve(ctx, limits.Payment{MerchantID: p.MerchantID, CustomerID: p.CustomerID, Amount: p.Amount})
+		if err != nil {
+			return ReviewResponse{}, fmt.Errorf("payment is not allowed: %w", err)
+		}
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if releaseErr := reservation.Release(context.WithoutCancel(ctx)); releaseErr != nil {
+			err = fmt.Errorf("%w (could not release the limits: %s)", err, releaseErr)
+		}
+	}()
+
+	resp, err := e.gateway.InitiatePayment(ctx, GatewayInitRequest{
+		ID:            p.ID,
+		MerchantID:    p.MerchantID,
+		Amount:        p.Amount,
+		ManualCapture: p.ManualCapture,
+		Context:       p.Context,
+		Gateways:      m.Gateways,
+	})
+	if err != nil {
+		return ReviewResponse{}, fmt.Errorf("%w: could not initiate payment: %w", ErrGateway, err)
+	}
+
+	fee := resp.Fee
+
+	if err := e.repository.ApproveReviewByID(ctx, p.ID, resp.ExternalID, &fee); err != nil {
+		return ReviewResponse{}, fmt.Errorf("db error: %w", err)
+	}
+
+	if p, err = e.repository.GetByID(ctx, r.ID); err != nil {
+		return ReviewResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	return ReviewResponse{Payment: p, NextAction: resp.NextAction}, nil
+}
+
+// RejectPayment rejects the payment, it's never sent to the gateway.
+func (e *EndpointReviewer) RejectPayment(ctx context.Context, r ReviewRequest) (ReviewResponse, error) {
+	lease, err := e.distributedLock.Lock(ctx, paymentLockKey(r.ID))
+	if err != nil {
+		return ReviewResponse{}, fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
+
+	if _, err := e.reviewed(ctx, r.ID); err != nil {
+		return ReviewResponse{}, err
+	}
+
+	if err := e.repository.RejectReviewByID(ctx, r.ID); err != nil {
+		return ReviewResponse{}, fmt.Errorf("db error: %w", err)
+	}
+
+	p, err := e.repository.GetByID(ctx, r.ID)
+	if err != nil {
+		return ReviewResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	return ReviewResponse{Payment: p}, nil
+}
+
+// reviewed returns the payment held for the review, the caller must hold the lock.
+func (e *EndpointReviewer) reviewed(ctx context.Context, id uuid.UUID) (datastore.Payment, error) {
+	p, err := e.repository.GetByID(ctx, id)
+	if err != nil {
+		return datastore.Payment{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	if p.Status != datastore.PaymentReview {
+		return datastore.Payment{}, fmt.Errorf("%w: the payment is not held for the review", datastore.ErrInvalidState)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,201 @@
+package payment_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/limits"
+	"payments/lock"
+	"payments/merchant"
+	"payments/ratelimit"
+	"payments/risk"
+	"payments/usecases/payment"
+)
+
+func TestEndpointInitiator_WithRisk(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	engine := risk.NewEngine(
+		risk.Blocklist("email", "fraud@example.com"),
+		risk.AmountThreshold(currency.AED, 100_000, 0),
+	)
+
+	request := func(units uint, email string) payment.InitiateRequest {
+		return payment.InitiateRequest{
+			ID:       uuid.New(),
+			Merchant: m,
+			Amount:   currency.MustNewAmount(currency.AED, units, 0),
+			Context:  map[string]any{"email": email},
+		}
+	}
+
+	gateway := &gatewayInitiatorMock{}
+	repo := datastore.NewInMemoryPaymentRepository()
+	initiator := payment.NewEndpointInitiator(gateway, repo, lock.NewInMemory(lock.Options{})).WithRisk(engine)
+
+	r := request(100, "fraud@example.com")
+	_, err := initiator.InitiatePayment(ctx, r)
+	require.ErrorIs(t, err, risk.ErrDenied)
+
+	_, err = repo.GetByID(ctx, r.ID)
+	require.ErrorIs(t, err, datastore.ErrNotFound, "the denied payment must not be stored")
+
+	resp, err := initiator.InitiatePayment(ctx, request(1_001, "customer@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentReview), resp.Payment.Status)
+	assert.Empty(t, resp.Payment.ExternalID)
+	assert.Nil(t, resp.NextAction)
+	assert.Equal(t, []string{"amount exceeds 1000.00 AED"}, resp.Payment.RiskReasons)
+	assert.Empty(t, gateway.calls, "the gateway must not be called")
+
+	resp, err = initiator.InitiatePayment(ctx, request(100, "customer@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentInitiated), resp.Payment.Status)
+	assert.Len(t, gateway.calls, 1)
+}
+
+func TestEndpointReviewer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	merchants := merchant.NewInMemory()
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}, Gateways: []string{"my-json-payments"}}
+	require.NoError(t, merchants.Create(ctx, m))
+
+	repo := datastore.NewInMemoryPaymentRepository()
+	locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+	initiator := payment.NewEndpointInitiator(&gatewayInitiatorMock{}, repo, locker).
+		WithRisk(risk.NewEngine(risk.AmountThreshold(currency.AED, 1, 0)))
+
+	held := func(t *testing.T) datastore.Payment {
+		t.Helper()
+
+		resp, err := initiator.InitiatePayment(ctx, payment.InitiateRequest{
+			ID:            uuid.New(),
+			Merchant:      m,
+			Amount:        currency.MustNewAmount(currency.AED, 100, 0),
+			ManualCapture: true,
+			Context:       map[string]any{"email": "customer@example.com"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, datastore.PaymentStatus(datastore.PaymentReview), resp.Payment.Status)
+
+		return resp.Payment
+	}
+
+	t.Run("Approve", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := &gatewayInitiatorMock{}
+		reviewer := payment.NewEndpointReviewer(gateway, repo, merchants, locker)
+		p := held(t)
+
+		resp, err := reviewer.ApprovePayment(ctx, payment.ReviewRequest{ID: p.ID})
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentInitiated), resp.Payment.Status)
+		assert.Equal(t, "external-"+p.ID.String(), resp.Payment.ExternalID)
+
+		require.Len(t, gateway.calls, 1)
+		assert.True(t, gateway.calls[0].ManualCapture)
+		assert.Equal(t, p.Context, gateway.calls[0].Context)
+		assert.Equal(t, m.Gateways, gateway.calls[0].Gateways)
+		assert.Equal(t, m.ID, gateway.calls[0].MerchantID)
+
+		_, err = reviewer.ApprovePayment(ctx, payment.ReviewRequest{ID: p.ID})
+		require.ErrorIs(t, err, datastore.ErrInvalidState)
+		assert.Len(t, gateway.calls, 1, "the payment must not be sent twice")
+	})
+
+	t.Run("Gateway error", func(t *testing.T) {
+		t.Parallel()
+
+		reviewer := payment.NewEndpointReviewer(&gatewayInitiatorMock{err: errors.New("unavailable")}, repo, merchants, locker)
+		p := held(t)
+
+		_, err := reviewer.ApprovePayment(ctx, payment.ReviewRequest{ID: p.ID})
+		require.ErrorIs(t, err, payment.ErrGateway)
+
+		// the payment stays in the review, so the approval can be retried
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentReview), got.Status)
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := &gatewayInitiatorMock{}
+		reviewer := payment.NewEndpointReviewer(gateway, repo, merchants, locker)
+		p := held(t)
+
+		resp, err := reviewer.RejectPayment(ctx, payment.ReviewRequest{ID: p.ID})
+		require.NoError(t, err)
+		assert.Equal(t, datastore.PaymentStatus(datastore.PaymentRejected), resp.Payment.Status)
+
+		_, err = reviewer.ApprovePayment(ctx, payment.ReviewRequest{ID: p.ID})
+		require.ErrorIs(t, err, datastore.ErrInvalidState)
+		assert.Empty(t, gateway.calls, "the rejected payment must not be sent to the gateway")
+	})
+}
+
+func TestEndpointReviewer_WithLimits(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	merchants := merchant.NewInMemory()
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}}
+	require.NoError(t, merchants.Create(ctx, m))
+
+	checker := limits.NewChecker(limits.Config{
+		Default: limits.Rules{Currencies: map[string]limits.CurrencyLimits{"AED": {Daily: 150_000}}},
+	}, ratelimit.NewInMemory())
+
+	repo := datastore.NewInMemoryPaymentRepository()
+	locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+	gateway := &gatewayInitiatorMock{}
+	reviewed := payment.NewEndpointInitiator(gateway, repo, locker).
+		WithLimits(checker).
+		WithRisk(risk.NewEngine(risk.AmountThreshold(currency.AED, 1, 0)))
+	initiator := payment.NewEndpointInitiator(gateway, repo, locker).WithLimits(checker)
+	reviewer := payment.NewEndpointReviewer(gateway, repo, merchants, locker).WithLimits(checker)
+
+	request := func(units uint) payment.InitiateRequest {
+		return payment.InitiateRequest{ID: uuid.New(), Merchant: m, Amount: currency.MustNewAmount(currency.AED, units, 0)}
+	}
+
+	rejected, err := reviewed.InitiatePayment(ctx, request(1_000))
+	require.NoError(t, err)
+	approved, err := reviewed.InitiatePayment(ctx, request(1_000))
+	require.NoError(t, err)
+
+	_, err = reviewer.RejectPayment(ctx, payment.ReviewRequest{ID: rejected.Payment.ID})
+	require.NoError(t, err)
+
+	_, err = reviewer.ApprovePayment(ctx, payment.ReviewRequest{ID: approved.Payment.ID})
+	require.NoError(t, err)
+
+	// the payment held within the cap, the cap is exhausted before the approval
+	late, err := reviewed.InitiatePayment(ctx, request(400))
+	require.NoError(t, err)
+
+	// the rejected and the held payments don't consume the daily cap
+	_, err = initiator.InitiatePayment(ctx, request(500))
+	require.NoError(t, err)
+
+	_, err = reviewer.ApprovePayment(ctx, payment.ReviewRequest{ID: late.Payment.ID})
+	require.ErrorIs(t, err, limits.ErrDailyLimitExceeded)
+
+	got, err := repo.GetByID(ctx, late.Payment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentReview), got.Status)
+	assert.Len(t, gateway.calls, 2)
+}
@@ -0,0 +1,31 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"payments/datastore"
+)
+
+type refundsUpdater interface {
+	UpdateRefundByExternalID(_ context.Context, extID string, status datastore.RefundStatus) error
+}
+
+type EndpointRefundStatusUpdater struct {
+	repository refundsUpdater
+}
+
+func NewEndpointRefundStatusUpdater(repository refundsUpdater) *EndpointRefundStatusUpdater {
+	return &EndpointRefundStatusUpdater{repository: repository}
+}
+
+func (e *EndpointRefundStatusUpdater) UpdateRefundStatus(
+	ctx context.Context,
+	r UpdateRefundStatusRequest,
+) (UpdateRefundStatusResponse, error) {
+	if err := e.repository.UpdateRefundByExternalID(ctx, r.ExternalID, r.Status); err != nil {
+		return UpdateRefundStatusResponse{}, fmt.Errorf("could not update refund status: %w", err)
+	}
+
+	return UpdateRefundStatusResponse{}, nil
+}
@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+	"payments/lock"
+)
+
+type voiderGateway interface {
+	Void(context.Context, GatewayVoidRequest) (GatewayVoidResponse, error)
+}
+
+type voidRepository interface {
+	VoidByID(_ context.Context, paymentID uuid.UUID) error
+	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
+}
+
+// EndpointVoider releases authorized payments, see [InitiateRequest.ManualCapture].
+type EndpointVoider struct {
+	gateway         voiderGateway
+	repository      voidRepository
+	distributedLock distributedLock
+}
+
+func NewEndpointVoider(
+	gateway voiderGateway,
+	repository voidRepository,
+	distributedLock distributedLock,
+) *EndpointVoider {
+	return &EndpointVoider{gateway: gateway, repository: repository, distributedLock: distributedLock}
+}
+
+func (e *EndpointVoider) VoidPayment(ctx context.Context, r VoidRequest) (VoidResponse, error) {
+	lease, err := e.distributedLock.Lock(ctx, paymentLockKey(r.ID))
+	if err != nil {
+		return VoidResponse{}, fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		// the request context might be already cancelled, but we still want to release the lock
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
+
+	p, err := e.repository.GetByID(ctx, r.ID)
+	if err != nil {
+		return VoidResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	if err := ownedBy(p, r.MerchantID); err != nil {
+		return VoidResponse{}, err
+	}
+
+	if p.Status != datastore.PaymentAuthorized {
+		return VoidResponse{}, fmt.Errorf("%w: could not void, it's not authorized", datastore.ErrInvalidState)
+	}
+
+	resp, err := e.gateway.Void(ctx, GatewayVoidRequest{ExternalID: p.ExternalID})
+	if err != nil {
+		return VoidResponse{}, fmt.Errorf("%w: could not void: %w", ErrGateway, err)
+	}
+
+	if !resp.OK {
+		return VoidResponse{}, fmt.Errorf("%w: void declined", ErrGateway)
+	}
+
+	if err := e.repository.VoidByID(ctx, r.ID); err != nil {
+		return VoidResponse{}, fmt.Errorf("db error: %w", err)
+	}
+
+	if p, err = e.repository.GetByID(ctx, r.ID); err != nil {
+		return VoidResponse{}, fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	return VoidResponse{Payment: p}, nil
+}
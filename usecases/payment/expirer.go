@@ -0,0 +1,202 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+	"payments/lock"
+)
+
+// expirerLockKey makes sure that only one instance expires payments at the time.
+const expirerLockKey = "payment-expirer"
+
+type statusQuerierGateway interface {
+	QueryStatus(context.Context, GatewayStatusRequest) (GatewayStatusResponse, error)
+}
+
+type expirationPolicy interface {
+	TTL(externalID string) time.Duration
+	MinTTL() time.Duration
+}
+
+type expirerRepository interface {
+	List(context.Context, datastore.ListQuery) (datastore.ListResult, error)
+	GetByID(_ context.Context, paymentID uuid.UUID) (datastore.Payment, error)
+	UpdateInitiatedByExternalID(_ context.Context, extID string, status datastore.PaymentStatus) error
+}
+
+type PaymentExpirerOptions struct {
+	BatchSize int
+	// Now is the clock, time.Now by default
+	Now func() time.Time
+}
+
+// PaymentExpirer expires payments that stay initiated longer than the TTL of their gateway.
+//
+// When the gateway is given, it's asked for the final status first, so we don't expire payments
+// the customer has paid, but the webhook got lost.
+// Instances compete for the leader lock, the one holding it processes all the payments,
+// payments are also locked one by one, so they are not cancelled at the same time.
+type PaymentExpirer struct {
+	gateway         statusQuerierGateway
+	policy          expirationPolicy
+	repository      expirerRepository
+	distributedLock distributedLock
+	options         PaymentExpirerOptions
+}
+
+// NewPaymentExpirer accepts nil gateway, payments are expired without asking the gateway then.
+func NewPaymentExpirer(
+	gateway statusQuerierGateway,
+	policy expirationPolicy,
+	repository expirerRepository,
+	distributedLock distributedLock,
+	o PaymentExpirerOptions,
+) *PaymentExpirer {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+
+	return &PaymentExpirer{
+		gateway:         gateway,
+		policy:          policy,
+		repository:      repository,
+		distributedLock: distributedLock,
+		options:         o,
+	}
+}
+
+// Run expires stale payments until the context is cancelled.
+func (e *PaymentExpirer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.ExpireStale(ctx); err != nil {
+			// TODO logger would be injected
+			log.Default().Println(fmt.Sprintf("payment expirer: %s", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireStale performs a single run, it does nothing when another instance is the leader.
+func (e *PaymentExpirer) ExpireStale(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("PaymentExpirer.ExpireStale: %w", err)
+		}
+	}()
+
+	leader, err := e.distributedLock.Lock(ctx, expirerLockKey)
+	if errors.Is(err, lock.ErrNotAcquired) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		_ = leader.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	now := e.options.Now()
+	q := datastore.ListQuery{
+		Status:    datastore.PaymentInitiated,
+		CreatedTo: now.Add(-e.policy.MinTTL()),
+		Limit:     e.options.BatchSize,
+	}
+
+	var failures []error
+
+	for {
+		page, err := e.repository.List(ctx, q)
+		if err != nil {
+			return fmt.Errorf("could not list initiated payments: %w", err)
+		}
+
+		for _, p := range page.Payments {
+			if now.Sub(p.CreatedAt) < e.policy.TTL(p.ExternalID) {
+				continue
+			}
+
+			if err := e.expire(ctx, p.ID); err != nil {
+				failures = append(failures, fmt.Errorf("payment %+q: %w", p.ID, err))
+			}
+		}
+
+		if page.NextCursor == "" {
+			return errors.Join(failures...)
+		}
+
+		q.Cursor = page.NextCursor
+	}
+}
+
+func (e *PaymentExpirer) expire(ctx context.Context, id uuid.UUID) error {
+	lease, err := e.distributedLock.Lock(ctx, paymentLockKey(id))
+	if errors.Is(err, lock.ErrNotAcquired) {
+		// the payment is being modified, we will try again during the next run
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
+
+	// it might have been changed since we listed it
+	p, err := e.repository.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("could not fetch by id: %w", err)
+	}
+
+	if p.Status != datastore.PaymentInitiated {
+		return nil
+	}
+
+	status := datastore.PaymentStatus(datastore.PaymentExpired)
+
+	if e.gateway != nil {
+		resp, err := e.gateway.QueryStatus(ctx, GatewayStatusRequest{ExternalID: p.ExternalID})
+		if err != nil {
+			// the customer might have paid, so we must not expire it blindly
+			return fmt.Errorf("%w: could not query status: %w", ErrGateway, err)
+		}
+
+		// the payment is expired when the gateway cannot report the status
+		if !resp.NotSupported && resp.Status != datastore.PaymentInitiated {
+			status = resp.Status
+		}
+	}
+
+	err = e.repository.UpdateInitiatedByExternalID(ctx, p.ExternalID, status)
+	if errors.Is(err, datastore.ErrInvalidState) {
+		// the webhook has been applied in the meantime, it wins
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	return nil
+}
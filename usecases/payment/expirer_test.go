@@ -0,0 +1,150 @@
+package payment_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+	"payments/usecases/payment"
+)
+
+// policyMock gives the "fast-" payments 10 minutes, and the others an hour.
+type policyMock struct{}
+
+func (policyMock) TTL(externalID string) time.Duration {
+	if strings.HasPrefix(externalID, "fast-") {
+		return time.Minute * 10
+	}
+
+	return time.Hour
+}
+
+func (policyMock) MinTTL() time.Duration {
+	return time.Minute * 10
+}
+
+type statusQuerierMock struct {
+	statuses map[string]datastore.PaymentStatus
+	err      error
+}
+
+func (s statusQuerierMock) QueryStatus(_ context.Context, r payment.GatewayStatusRequest) (payment.GatewayStatusResponse, error) {
+	return payment.GatewayStatusResponse{Status: s.statuses[r.ExternalID]}, s.err
+}
+
+func TestPaymentExpirer_ExpireStale(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	setup := func(t *testing.T, createdAgo map[string]time.Duration) (*datastore.InMemoryPaymentRepository, map[string]uuid.UUID) {
+		t.Helper()
+
+		repo := datastore.NewInMemoryPaymentRepository()
+		ids := make(map[string]uuid.UUID)
+
+		for externalID, ago := range createdAgo {
+			p := datastore.Payment{
+				ID:         uuid.New(),
+				ExternalID: externalID,
+				Status:     datastore.PaymentInitiated,
+				Amount:     currency.MustNewAmount(currency.AED, 100, 0),
+				CreatedAt:  now.Add(-ago),
+			}
+			require.NoError(t, repo.Create(ctx, p))
+			ids[externalID] = p.ID
+		}
+
+		return repo, ids
+	}
+
+	assertStatus := func(t *testing.T, repo *datastore.InMemoryPaymentRepository, id uuid.UUID, expected datastore.PaymentStatus) {
+		t.Helper()
+
+		p, err := repo.GetByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, expected, p.Status)
+	}
+
+	options := payment.PaymentExpirerOptions{BatchSize: 1, Now: func() time.Time { return now }}
+
+	t.Run("Per gateway TTL", func(t *testing.T) {
+		t.Parallel()
+
+		repo, ids := setup(t, map[string]time.Duration{
+			"fast-stale":  time.Minute * 11,
+			"fast-fresh":  time.Minute * 9,
+			"slow-fresh":  time.Minute * 11,
+			"slow-stale":  time.Hour,
+			"slow-paid":   time.Hour * 2,
+			"slow-cancel": time.Hour * 2,
+		})
+		require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, "slow-paid", datastore.PaymentPaid))
+		require.NoError(t, repo.CancelByID(ctx, ids["slow-cancel"]))
+
+		locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+		require.NoError(t, payment.NewPaymentExpirer(nil, policyMock{}, repo, locker, options).ExpireStale(ctx))
+
+		assertStatus(t, repo, ids["fast-stale"], datastore.PaymentExpired)
+		assertStatus(t, repo, ids["fast-fresh"], datastore.PaymentInitiated)
+		assertStatus(t, repo, ids["slow-fresh"], datastore.PaymentInitiated)
+		assertStatus(t, repo, ids["slow-stale"], datastore.PaymentExpired)
+		assertStatus(t, repo, ids["slow-paid"], datastore.PaymentPaid)
+		assertStatus(t, repo, ids["slow-cancel"], datastore.PaymentCancelled)
+	})
+
+	t.Run("Gateway status first", func(t *testing.T) {
+		t.Parallel()
+
+		repo, ids := setup(t, map[string]time.Duration{"paid": time.Hour, "unpaid": time.Hour})
+
+		gateway := statusQuerierMock{statuses: map[string]datastore.PaymentStatus{
+			"paid":   datastore.PaymentPaid,
+			"unpaid": datastore.PaymentInitiated,
+		}}
+
+		locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+		require.NoError(t, payment.NewPaymentExpirer(gateway, policyMock{}, repo, locker, options).ExpireStale(ctx))
+
+		assertStatus(t, repo, ids["paid"], datastore.PaymentPaid)
+		assertStatus(t, repo, ids["unpaid"], datastore.PaymentExpired)
+	})
+
+	t.Run("Gateway error", func(t *testing.T) {
+		t.Parallel()
+
+		repo, ids := setup(t, map[string]time.Duration{"unknown": time.Hour})
+
+		locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+		err := payment.NewPaymentExpirer(statusQuerierMock{err: errors.New("timeout")}, policyMock{}, repo, locker, options).ExpireStale(ctx)
+		require.ErrorIs(t, err, payment.ErrGateway)
+
+		assertStatus(t, repo, ids["unknown"], datastore.PaymentInitiated)
+	})
+
+	t.Run("Another leader", func(t *testing.T) {
+		t.Parallel()
+
+		repo, ids := setup(t, map[string]time.Duration{"stale": time.Hour})
+
+		locker := lock.NewInMemory(lock.Options{TTL: time.Second, AcquireTimeout: time.Millisecond})
+		leader, err := locker.Lock(ctx, "payment-expirer")
+		require.NoError(t, err)
+
+		require.NoError(t, payment.NewPaymentExpirer(nil, policyMock{}, repo, locker, options).ExpireStale(ctx))
+		assertStatus(t, repo, ids["stale"], datastore.PaymentInitiated)
+
+		require.NoError(t, leader.Unlock(ctx))
+		require.NoError(t, payment.NewPaymentExpirer(nil, policyMock{}, repo, locker, options).ExpireStale(ctx))
+		assertStatus(t, repo, ids["stale"], datastore.PaymentExpired)
+	})
+}
@@ -0,0 +1,65 @@
+package payment
+
+import (
+	"net/http"
+
+	"payments/datastore"
+	"payments/gateways"
+	"payments/limits"
+	"payments/lock"
+	"payments/merchant"
+	"payments/problem"
+	"payments/ratelimit"
+	"payments/risk"
+)
+
+// Codes of the payment endpoints, see [problem.Code], the common ones are defined by the problem package.
+const (
+	ProblemPaymentNotFound      problem.Code = "payment_not_found"
+	ProblemInvalidState         problem.Code = "invalid_payment_state"
+	ProblemInvalidRefundAmount  problem.Code = "invalid_refund_amount"
+	ProblemInvalidCaptureAmount problem.Code = "invalid_capture_amount"
+	ProblemDuplicatePayment     problem.Code = "duplicate_payment"
+	ProblemConcurrentRequest    problem.Code = "concurrent_request"
+	ProblemUnsupportedCurrency  problem.Code = "unsupported_currency"
+	ProblemNotSupported         problem.Code = "operation_not_supported"
+	ProblemGatewayError         problem.Code = "gateway_error"
+	ProblemGatewayUnavailable   problem.Code = "gateway_unavailable"
+	ProblemAmountTooSmall       problem.Code = "amount_too_small"
+	ProblemAmountTooLarge       problem.Code = "amount_too_large"
+	ProblemDailyLimit           problem.Code = "daily_limit_exceeded"
+	ProblemMonthlyLimit         problem.Code = "monthly_limit_exceeded"
+	ProblemVelocityExceeded     problem.Code = "velocity_exceeded"
+	ProblemPaymentDenied        problem.Code = "payment_denied"
+	ProblemRateLimited          problem.Code = "rate_limited"
+	ProblemQuotaExceeded        problem.Code = "quota_exceeded"
+)
+
+// problems are checked in order, so specific errors must go first, e.g. [gateways.ErrUnavailable] before [ErrGateway].
+var problems = []problem.Definition{
+	{Err: merchant.ErrUnauthenticated, Code: problem.CodeUnauthenticated, Status: http.StatusUnauthorized, Title: "Authentication required"},
+	{Err: datastore.ErrNotFound, Code: ProblemPaymentNotFound, Status: http.StatusNotFound, Title: "Payment not found"},
+	{Err: datastore.ErrInvalidState, Code: ProblemInvalidState, Status: http.StatusConflict, Title: "The operation is not allowed in the current payment state"},
+	{Err: datastore.ErrInvalidRefundAmount, Code: ProblemInvalidRefundAmount, Status: http.StatusUnprocessableEntity, Title: "Refund amount is zero or exceeds the refundable amount"},
+	{Err: datastore.ErrInvalidCaptureAmount, Code: ProblemInvalidCaptureAmount, Status: http.StatusUnprocessableEntity, Title: "Capture amount is zero or exceeds the authorized amount"},
+	{Err: datastore.ErrDuplicate, Code: ProblemDuplicatePayment, Status: http.StatusConflict, Title: "Payment already exists"},
+	{Err: lock.ErrNotAcquired, Code: ProblemConcurrentRequest, Status: http.StatusConflict, Title: "Another request for the same payment is in progress"},
+	{Err: lock.ErrLeaseLost, Code: ProblemConcurrentRequest, Status: http.StatusConflict, Title: "Another request for the same payment took over"},
+	{Err: gateways.ErrUnsupportedCurrency, Code: ProblemUnsupportedCurrency, Status: http.StatusUnprocessableEntity, Title: "Currency is not supported"},
+	{Err: limits.ErrAmountTooSmall, Code: ProblemAmountTooSmall, Status: http.StatusUnprocessableEntity, Title: "Amount is below the minimum"},
+	{Err: limits.ErrAmountTooLarge, Code: ProblemAmountTooLarge, Status: http.StatusUnprocessableEntity, Title: "Amount exceeds the maximum"},
+	{Err: limits.ErrDailyLimitExceeded, Code: ProblemDailyLimit, Status: http.StatusUnprocessableEntity, Title: "Daily limit of the merchant is exceeded"},
+	{Err: limits.ErrMonthlyLimitExceeded, Code: ProblemMonthlyLimit, Status: http.StatusUnprocessableEntity, Title: "Monthly limit of the merchant is exceeded"},
+	{Err: limits.ErrVelocityExceeded, Code: ProblemVelocityExceeded, Status: http.StatusUnprocessableEntity, Title: "Too many payments of the customer"},
+	{Err: risk.ErrDenied, Code: ProblemPaymentDenied, Status: http.StatusUnprocessableEntity, Title: "Payment is denied"},
+	{Err: gateways.ErrNotSupported, Code: ProblemNotSupported, Status: http.StatusUnprocessableEntity, Title: "Operation is not supported"},
+	{Err: gateways.ErrUnavailable, Code: ProblemGatewayUnavailable, Status: http.StatusServiceUnavailable, Title: "Gateway is temporarily unavailable"},
+	{Err: ErrGateway, Code: ProblemGatewayError, Status: http.StatusBadGateway, Title: "Gateway error"},
+	{Err: ratelimit.ErrLimitExceeded, Code: ProblemRateLimited, Status: http.StatusTooManyRequests, Title: "Too many requests"},
+	{Err: ratelimit.ErrQuotaExceeded, Code: ProblemQuotaExceeded, Status: http.StatusTooManyRequests, Title: "Daily volume quota is exceeded"},
+}
+
+// writeProblem writes the problem for the given error, see [problem.WriteError].
+func writeProblem(writer http.ResponseWriter, request *http.Request, err error) {
+	problem.WriteError(writer, request, err, problems)
+}
@@ -0,0 +1,78 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"payments/merchant"
+	"payments/ratelimit"
+)
+
+type rateLimiter interface {
+	Allow(_ context.Context, key string, l ratelimit.Limit) error
+}
+
+// NewHTTPRateLimit limits requests of every merchant to the endpoint, so a misbehaving client
+// cannot trip the gateway circuit breakers for everyone.
+// It must be wrapped by [merchant.NewHTTPAuthenticate], requests without the merchant are rejected, so they are never unlimited.
+func NewHTTPRateLimit(limiter rateLimiter, endpoint string, l ratelimit.Limit, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m, err := merchant.FromContext(request.Context())
+		if err != nil {
+			writeProblem(writer, request, err)
+			return
+		}
+
+		if err := limiter.Allow(request.Context(), fmt.Sprintf("rate:%s:%s", endpoint, m.ID), l); err != nil {
+			writeProblem(writer, request, err)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+type quotaCounter interface {
+	Consume(_ context.Context, key string, n, limit uint64, resetAt time.Time) error
+	Release(_ context.Context, key string, n uint64) error
+}
+
+// InitiatorQuotaDecorator limits the daily volume of payments of every merchant per currency.
+// The volume is consumed before the payment is initiated, so concurrent requests cannot exceed the quota,
+// and released when the payment could not be initiated.
+type InitiatorQuotaDecorator struct {
+	endpoint endpointInitiate
+	counter  quotaCounter
+	quotas   ratelimit.Quotas
+	now      func() time.Time
+}
+
+func NewInitiatorQuotaDecorator(counter quotaCounter, quotas ratelimit.Quotas, initiator endpointInitiate) *InitiatorQuotaDecorator {
+	return &InitiatorQuotaDecorator{endpoint: initiator, counter: counter, quotas: quotas, now: time.Now}
+}
+
+func (i InitiatorQuotaDecorator) InitiatePayment(ctx context.Context, req InitiateRequest) (res InitiateResponse, err error) {
+	quota, ok := i.quotas[req.Amount.Currency.Code]
+	if !ok {
+		return i.endpoint.InitiatePayment(ctx, req)
+	}
+
+	day, resetAt := ratelimit.DailyWindow(i.now())
+	key := fmt.Sprintf("quota:%s:%s:%s", req.Merchant.ID, req.Amount.Currency.Code, day)
+	volume := uint64(req.Amount.ToFractional())
+
+	if err := i.counter.Consume(ctx, key, volume, uint64(quota), resetAt); err != nil {
+		return InitiateResponse{}, fmt.Errorf("daily quota of %s: %w", req.Amount.Currency.Code, err)
+	}
+
+	res, err = i.endpoint.InitiatePayment(ctx, req)
+	if err != nil {
+		if releaseErr := i.counter.Release(context.WithoutCancel(ctx), key, volume); releaseErr != nil {
+			err = fmt.Errorf("%w (could not release the quota: %s)", err, releaseErr)
+		}
+	}
+
+	return res, err
+}
@@ -0,0 +1,90 @@
+package payment_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/merchant"
+	"payments/problem"
+	"payments/ratelimit"
+	"payments/usecases/payment"
+)
+
+func TestNewHTTPRateLimit(t *testing.T) {
+	t.Parallel()
+
+	limiter := ratelimit.NewInMemory()
+	handler := payment.NewHTTPRateLimit(limiter, "get-payment", ratelimit.Limit{Rate: 0.01, Burst: 1}, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(m *merchant.Merchant) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/payments", nil)
+		if m != nil {
+			request = request.WithContext(merchant.NewContext(request.Context(), *m))
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	first := merchant.Merchant{ID: uuid.New()}
+	second := merchant.Merchant{ID: uuid.New()}
+
+	assert.Equal(t, http.StatusOK, do(&first).Code)
+
+	recorder := do(&first)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "100", recorder.Header().Get("Retry-After"))
+
+	var response problem.Problem
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, payment.ProblemRateLimited, response.Code)
+
+	// merchants are limited independently, requests without the merchant are not let through unlimited
+	assert.Equal(t, http.StatusOK, do(&second).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(nil).Code)
+}
+
+func TestInitiatorQuotaDecorator(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	limiter := ratelimit.NewInMemory()
+	quotas := ratelimit.Quotas{"AED": 10_000}
+
+	m := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED", "USD"}}
+	request := func(units uint, c currency.Currency) payment.InitiateRequest {
+		return payment.InitiateRequest{ID: uuid.New(), Merchant: m, Amount: currency.MustNewAmount(c, units, 0)}
+	}
+
+	initiator := payment.NewInitiatorQuotaDecorator(limiter, quotas, initiatorMock{})
+
+	_, err := initiator.InitiatePayment(ctx, request(60, currency.AED))
+	require.NoError(t, err)
+
+	_, err = initiator.InitiatePayment(ctx, request(50, currency.AED))
+	require.ErrorIs(t, err, ratelimit.ErrQuotaExceeded)
+
+	// currencies without the quota are not limited
+	_, err = initiator.InitiatePayment(ctx, request(1000, currency.USD))
+	require.NoError(t, err)
+
+	// failed payments do not consume the quota
+	failing := payment.NewInitiatorQuotaDecorator(limiter, quotas, initiatorMock{err: errors.New("gateway error")})
+	_, err = failing.InitiatePayment(ctx, request(40, currency.AED))
+	require.Error(t, err)
+
+	_, err = initiator.InitiatePayment(ctx, request(40, currency.AED))
+	require.NoError(t, err)
+}
@@ -0,0 +1,196 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+	"payments/lock"
+)
+
+type refunderGateway interface {
+	Refund(context.Context, GatewayRefundRequest) (GatewayRefundResponse, error)
+}
+
+type refundProcessorRepository interface {
+	DueRefunds(_ context.Context, now time.Time, limit int) ([]datastore.PendingRefund, error)
+	UpdateRefund(_ context.Context, paymentID uuid.UUID, refundID uuid.UUID, u datastore.RefundUpdate) error
+	ScheduleRefundRetry(_ context.Context, paymentID uuid.UUID, refundID uuid.UUID, reason string, retryAt time.Time) error
+}
+
+type RefundProcessorOptions struct {
+	BatchSize int
+	// MaxAttempts is the number of gateway errors after which the refund fails, and the amount is released
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// RefundProcessor submits pending refunds to the gateway in the background.
+//
+// The refund is finalized by the gateway response, or by the refund webhook when the gateway processes it asynchronously.
+// Gateway errors are retried with the exponential backoff, the refund ID is sent as the idempotency key,
+// so the gateway does not refund twice when we retry after a timeout.
+type RefundProcessor struct {
+	gateway         refunderGateway
+	repository      refundProcessorRepository
+	distributedLock distributedLock
+	options         RefundProcessorOptions
+	now             func() time.Time
+}
+
+func NewRefundProcessor(
+	gateway refunderGateway,
+	repository refundProcessorRepository,
+	distributedLock distributedLock,
+	o RefundProcessorOptions,
+) *RefundProcessor {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = time.Second * 10
+	}
+
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Minute * 10
+	}
+
+	return &RefundProcessor{
+		gateway:         gateway,
+		repository:      repository,
+		distributedLock: distributedLock,
+		options:         o,
+		now:             time.Now,
+	}
+}
+
+// Run processes due refunds until the context is cancelled.
+func (p *RefundProcessor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.ProcessDue(ctx); err != nil {
+			// TODO logger would be injected
+			log.Default().Println(fmt.Sprintf("refund processor: %s", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue performs a single attempt for every due refund.
+func (p *RefundProcessor) ProcessDue(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("RefundProcessor.ProcessDue: %w", err)
+		}
+	}()
+
+	due, err := p.repository.DueRefunds(ctx, p.now(), p.options.BatchSize)
+	if err != nil {
+		return fmt.Errorf("could not fetch due refunds: %w", err)
+	}
+
+	var failures []error
+
+	for _, x := range due {
+		if err := p.process(ctx, x); err != nil {
+			failures = append(failures, fmt.Errorf("refund %+q: %w", x.Refund.ID, err))
+		}
+	}
+
+	return errors.Join(failures...)
+}
+
+func (p *RefundProcessor) process(ctx context.Context, x datastore.PendingRefund) error {
+	lease, err := p.distributedLock.Lock(ctx, paymentLockKey(x.PaymentID))
+	if errors.Is(err, lock.ErrNotAcquired) {
+		// the payment is being modified, we will try again during the next run
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		_ = lease.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	// the repository rejects our writes once the lease is taken over
+	ctx = lock.NewContext(ctx, lease)
+
+	resp, err := p.gateway.Refund(ctx, GatewayRefundRequest{
+		ExternalID: x.PaymentExternalID,
+		RefundID:   x.Refund.ID,
+		Amount:     x.Refund.Amount,
+		MerchantID: x.MerchantID,
+	})
+	if err == nil && resp.OK && resp.Pending && resp.ExternalID == "" {
+		// we would not be able to match the webhook
+		err = errors.New("pending refund without external ID")
+	}
+
+	var u datastore.RefundUpdate
+
+	switch {
+	case err != nil:
+		return p.retry(ctx, x, err)
+	case !resp.OK:
+		u = datastore.RefundUpdate{Status: datastore.RefundFailed, ExternalID: resp.ExternalID, Reason: "declined by the gateway"}
+	case resp.Pending:
+		u = datastore.RefundUpdate{Status: datastore.RefundPending, ExternalID: resp.ExternalID, Fee: &resp.Fee}
+	default:
+		u = datastore.RefundUpdate{Status: datastore.RefundSucceeded, ExternalID: resp.ExternalID, Fee: &resp.Fee}
+	}
+
+	if err := p.repository.UpdateRefund(ctx, x.PaymentID, x.Refund.ID, u); err != nil {
+		return fmt.Errorf("could not update refund: %w", err)
+	}
+
+	return nil
+}
+
+// retry schedules the next attempt, or fails the refund once we run out of attempts.
+func (p *RefundProcessor) retry(ctx context.Context, x datastore.PendingRefund, cause error) error {
+	attempts := x.Refund.Attempts + 1
+
+	if attempts >= p.options.MaxAttempts {
+		u := datastore.RefundUpdate{Status: datastore.RefundFailed, Reason: cause.Error()}
+		if err := p.repository.UpdateRefund(ctx, x.PaymentID, x.Refund.ID, u); err != nil {
+			return fmt.Errorf("could not fail refund: %w", err)
+		}
+
+		return nil
+	}
+
+	err := p.repository.ScheduleRefundRetry(ctx, x.PaymentID, x.Refund.ID, cause.Error(), p.now().Add(p.backoff(attempts)))
+	if err != nil {
+		return fmt.Errorf("could not schedule retry: %w", err)
+	}
+
+	return nil
+}
+
+func (p *RefundProcessor) backoff(failures int) time.Duration {
+	b := p.options.InitialBackoff
+	for i := 1; i < failures && b < p.options.MaxBackoff; i++ {
+		b *= 2
+	}
+
+	return min(b, p.options.MaxBackoff)
+}
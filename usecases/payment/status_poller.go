@@ -0,0 +1,219 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+	"payments/lock"
+)
+
+// statusPollerLockKey makes sure that only one instance polls the gateway at the time.
+const statusPollerLockKey = "payment-status-poller"
+
+type statusPollerRepository interface {
+	List(context.Context, datastore.ListQuery) (datastore.ListResult, error)
+}
+
+type StatusPollerOptions struct {
+	// MinAge is the time we wait for the webhook before we start polling
+	MinAge         time.Duration
+	BatchSize      int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Now is the clock, time.Now by default
+	Now func() time.Time
+}
+
+// pollState is the backoff of the given payment, it's kept in memory, so it's reset when the leader changes.
+type pollState struct {
+	attempts int
+	next     time.Time
+}
+
+// StatusPoller asks the gateway for the status of initiated payments, in case the webhook got lost.
+//
+// The status is applied by the same endpoint as webhooks, so both paths behave the same way.
+// Payments still initiated at the gateway are polled with the exponential backoff, until they expire, see [PaymentExpirer].
+type StatusPoller struct {
+	gateway         statusQuerierGateway
+	repository      statusPollerRepository
+	updater         endpointUpdate
+	distributedLock distributedLock
+	options         StatusPollerOptions
+
+	mu       sync.Mutex
+	schedule map[uuid.UUID]pollState
+}
+
+func NewStatusPoller(
+	gateway statusQuerierGateway,
+	repository statusPollerRepository,
+	updater endpointUpdate,
+	distributedLock distributedLock,
+	o StatusPollerOptions,
+) *StatusPoller {
+	if o.MinAge <= 0 {
+		o.MinAge = time.Minute * 5
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = time.Minute
+	}
+
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Minute * 30
+	}
+
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+
+	return &StatusPoller{
+		gateway:         gateway,
+		repository:      repository,
+		updater:         updater,
+		distributedLock: distributedLock,
+		options:         o,
+		schedule:        make(map[uuid.UUID]pollState),
+	}
+}
+
+// Run polls the gateway until the context is cancelled.
+func (s *StatusPoller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.PollDue(ctx); err != nil {
+			// TODO logger would be injected
+			log.Default().Println(fmt.Sprintf("status poller: %s", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollDue performs a single run, it does nothing when another instance is the leader.
+func (s *StatusPoller) PollDue(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("StatusPoller.PollDue: %w", err)
+		}
+	}()
+
+	leader, err := s.distributedLock.Lock(ctx, statusPollerLockKey)
+	if errors.Is(err, lock.ErrNotAcquired) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+
+	defer func() {
+		_ = leader.Unlock(context.WithoutCancel(ctx))
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.options.Now()
+	q := datastore.ListQuery{
+		Status:    datastore.PaymentInitiated,
+		CreatedTo: now.Add(-s.options.MinAge),
+		Limit:     s.options.BatchSize,
+	}
+
+	var (
+		failures []error
+		seen     = make(map[uuid.UUID]struct{})
+	)
+
+	for {
+		page, err := s.repository.List(ctx, q)
+		if err != nil {
+			return fmt.Errorf("could not list initiated payments: %w", err)
+		}
+
+		for _, p := range page.Payments {
+			seen[p.ID] = struct{}{}
+
+			if s.schedule[p.ID].next.After(now) {
+				continue
+			}
+
+			if err := s.poll(ctx, p, now); err != nil {
+				failures = append(failures, fmt.Errorf("payment %+q: %w", p.ID, err))
+			}
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		q.Cursor = page.NextCursor
+	}
+
+	// payments that are not initiated anymore
+	for id := range s.schedule {
+		if _, ok := seen[id]; !ok {
+			delete(s.schedule, id)
+		}
+	}
+
+	return errors.Join(failures...)
+}
+
+// poll must be called under the mutex.
+func (s *StatusPoller) poll(ctx context.Context, p datastore.Payment, now time.Time) error {
+	resp, err := s.gateway.QueryStatus(ctx, GatewayStatusRequest{ExternalID: p.ExternalID})
+	if err != nil {
+		s.backoff(p.ID, now)
+
+		return fmt.Errorf("%w: could not query status: %w", ErrGateway, err)
+	}
+
+	if resp.NotSupported || resp.Status == datastore.PaymentInitiated {
+		s.backoff(p.ID, now)
+
+		return nil
+	}
+
+	_, err = s.updater.UpdatePaymentStatus(ctx, UpdateStatusRequest{ExternalID: p.ExternalID, Status: resp.Status})
+	if err != nil && !errors.Is(err, datastore.ErrInvalidState) {
+		s.backoff(p.ID, now)
+
+		return fmt.Errorf("could not update status: %w", err)
+	}
+
+	// applied, or the webhook (or the cancellation) has won
+	delete(s.schedule, p.ID)
+
+	return nil
+}
+
+func (s *StatusPoller) backoff(id uuid.UUID, now time.Time) {
+	state := s.schedule[id]
+	state.attempts++
+
+	b := s.options.InitialBackoff
+	for i := 1; i < state.attempts && b < s.options.MaxBackoff; i++ {
+		b *= 2
+	}
+
+	state.next = now.Add(min(b, s.options.MaxBackoff))
+	s.schedule[id] = state
+}
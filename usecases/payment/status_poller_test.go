@@ -0,0 +1,113 @@
+package payment_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/lock"
+	"payments/usecases/payment"
+)
+
+type countingQuerierMock struct {
+	statusQuerierMock
+	calls map[string]int
+}
+
+func (c countingQuerierMock) QueryStatus(ctx context.Context, r payment.GatewayStatusRequest) (payment.GatewayStatusResponse, error) {
+	c.calls[r.ExternalID]++
+
+	return c.statusQuerierMock.QueryStatus(ctx, r)
+}
+
+func TestStatusPoller_PollDue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := datastore.NewInMemoryPaymentRepository()
+	ids := make(map[string]uuid.UUID)
+
+	for externalID, ago := range map[string]time.Duration{
+		"young":   time.Minute,
+		"paid":    time.Minute * 10,
+		"unpaid":  time.Minute * 10,
+		"webhook": time.Minute * 10,
+	} {
+		p := datastore.Payment{
+			ID:         uuid.New(),
+			ExternalID: externalID,
+			Status:     datastore.PaymentInitiated,
+			Amount:     currency.MustNewAmount(currency.AED, 100, 0),
+			CreatedAt:  now.Add(-ago),
+		}
+		require.NoError(t, repo.Create(ctx, p))
+		ids[externalID] = p.ID
+	}
+
+	gateway := countingQuerierMock{
+		statusQuerierMock: statusQuerierMock{statuses: map[string]datastore.PaymentStatus{
+			"young":   datastore.PaymentPaid,
+			"paid":    datastore.PaymentPaid,
+			"unpaid":  datastore.PaymentInitiated,
+			"webhook": datastore.PaymentFailed,
+		}},
+		calls: make(map[string]int),
+	}
+
+	clock := now
+	poller := payment.NewStatusPoller(
+		gateway,
+		repo,
+		payment.NewEndpointStatusUpdater(repo),
+		lock.NewInMemory(lock.Options{TTL: time.Second}),
+		payment.StatusPollerOptions{
+			MinAge:         time.Minute * 5,
+			BatchSize:      1,
+			InitialBackoff: time.Minute,
+			MaxBackoff:     time.Minute * 10,
+			Now:            func() time.Time { return clock },
+		},
+	)
+
+	statusOf := func(externalID string) datastore.PaymentStatus {
+		p, err := repo.GetByID(ctx, ids[externalID])
+		require.NoError(t, err)
+
+		return p.Status
+	}
+
+	// the webhook is applied just before the poller
+	require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, "webhook", datastore.PaymentPaid))
+
+	require.NoError(t, poller.PollDue(ctx))
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentInitiated), statusOf("young"), "we wait for the webhook first")
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), statusOf("paid"))
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentPaid), statusOf("webhook"))
+	assert.Zero(t, gateway.calls["webhook"])
+	assert.Equal(t, datastore.PaymentStatus(datastore.PaymentInitiated), statusOf("unpaid"))
+	assert.Equal(t, 1, gateway.calls["unpaid"])
+
+	// backoff: 1 minute, then 2 minutes
+	require.NoError(t, poller.PollDue(ctx))
+	assert.Equal(t, 1, gateway.calls["unpaid"])
+
+	clock = now.Add(time.Minute)
+	require.NoError(t, poller.PollDue(ctx))
+	assert.Equal(t, 2, gateway.calls["unpaid"])
+
+	clock = now.Add(time.Minute * 2)
+	require.NoError(t, poller.PollDue(ctx))
+	assert.Equal(t, 2, gateway.calls["unpaid"])
+
+	clock = now.Add(time.Minute * 3)
+	require.NoError(t, poller.PollDue(ctx))
+	assert.Equal(t, 3, gateway.calls["unpaid"])
+	assert.Equal(t, 1, gateway.calls["paid"], "applied payments are not polled anymore")
+}
@@ -0,0 +1,135 @@
+package payment_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/gateways"
+	"payments/lock"
+	"payments/merchant"
+	"payments/usecases/payment"
+)
+
+type gatewayInitiatorMock struct {
+	mu    sync.Mutex
+	calls []payment.GatewayInitRequest
+	err   error
+}
+
+func (g *gatewayInitiatorMock) InitiatePayment(_ context.Context, r payment.GatewayInitRequest) (payment.GatewayInitResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.calls = append(g.calls, r)
+
+	if g.err != nil {
+		return payment.GatewayInitResponse{}, g.err
+	}
+
+	return payment.GatewayInitResponse{ExternalID: "external-" + r.ID.String()}, nil
+}
+
+func TestMerchantIsolation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := datastore.NewInMemoryPaymentRepository()
+	locker := lock.NewInMemory(lock.Options{TTL: time.Second})
+	gateway := &gatewayInitiatorMock{}
+
+	owner := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED"}, Gateways: []string{"my-json-payments"}}
+	another := merchant.Merchant{ID: uuid.New(), Currencies: []string{"AED", "USD"}}
+
+	initiator := payment.NewEndpointInitiator(gateway, repo, locker)
+
+	resp, err := initiator.InitiatePayment(ctx, payment.InitiateRequest{
+		ID:                uuid.New(),
+		Merchant:          owner,
+		Amount:            currency.MustNewAmount(currency.AED, 100, 0),
+		MerchantReference: "order-1",
+	})
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateInitiatedByExternalID(ctx, resp.Payment.ExternalID, datastore.PaymentPaid))
+
+	p := resp.Payment
+	assert.Equal(t, owner.ID, p.MerchantID)
+	assert.Equal(t, []string{"my-json-payments"}, gateway.calls[0].Gateways)
+
+	t.Run("Currencies", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := initiator.InitiatePayment(ctx, payment.InitiateRequest{
+			ID:       uuid.New(),
+			Merchant: owner,
+			Amount:   currency.MustNewAmount(currency.USD, 100, 0),
+		})
+		require.ErrorIs(t, err, gateways.ErrUnsupportedCurrency)
+	})
+
+	t.Run("Merchant references", func(t *testing.T) {
+		t.Parallel()
+
+		// references are unique per merchant
+		_, err := initiator.InitiatePayment(ctx, payment.InitiateRequest{
+			ID:                uuid.New(),
+			Merchant:          another,
+			Amount:            currency.MustNewAmount(currency.AED, 100, 0),
+			MerchantReference: "order-1",
+		})
+		require.NoError(t, err)
+
+		got, err := repo.GetByMerchantReference(ctx, owner.ID, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, p.ID, got.ID)
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		t.Parallel()
+
+		getter := payment.NewEndpointGetter(repo)
+
+		_, err := getter.GetPayment(ctx, payment.GetPaymentRequest{ID: p.ID, MerchantID: another.ID})
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+
+		got, err := getter.GetPayment(ctx, payment.GetPaymentRequest{ID: p.ID, MerchantID: owner.ID})
+		require.NoError(t, err)
+		assert.Equal(t, p.ID, got.Payment.ID)
+
+		list, err := payment.NewEndpointLister(repo).ListPayments(ctx, payment.ListPaymentsRequest{
+			Query: datastore.ListQuery{MerchantID: &another.ID, MerchantReference: "order-1"},
+		})
+		require.NoError(t, err)
+
+		for _, x := range list.Payments {
+			assert.Equal(t, another.ID, x.MerchantID)
+		}
+	})
+
+	t.Run("Refund", func(t *testing.T) {
+		t.Parallel()
+
+		refunder := payment.NewEndpointRefunder(repo, locker)
+
+		_, err := refunder.RefundPayment(ctx, payment.RefundRequest{ID: p.ID, MerchantID: another.ID, RefundID: uuid.New()})
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+
+		got, err := repo.GetByID(ctx, p.ID)
+		require.NoError(t, err)
+		assert.Empty(t, got.Refunds)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := payment.NewEndpointCanceller(cancellerMock{}, repo, locker).
+			CancelPayment(ctx, payment.CancelRequest{ID: p.ID, MerchantID: another.ID})
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+	})
+}
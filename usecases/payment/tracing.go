@@ -73,6 +73,7 @@ func (r RefunderTracingDecorator) RefundPayment(ctx context.Context, request Ref
 	defer span.Finish()
 
 	span.SetTag("id", request.ID)
+	span.SetTag("refund_id", request.RefundID)
 
 	defer func() {
 		if err != nil {
@@ -83,3 +84,195 @@ func (r RefunderTracingDecorator) RefundPayment(ctx context.Context, request Ref
 
 	return r.endpoint.RefundPayment(ctx, request)
 }
+
+type RefundUpdaterTracingDecorator struct {
+	endpoint endpointUpdateRefund
+}
+
+func NewRefundUpdaterTracingDecorator(endpoint endpointUpdateRefund) *RefundUpdaterTracingDecorator {
+	return &RefundUpdaterTracingDecorator{endpoint: endpoint}
+}
+
+func (u RefundUpdaterTracingDecorator) UpdateRefundStatus(
+	ctx context.Context,
+	r UpdateRefundStatusRequest,
+) (_ UpdateRefundStatusResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.UpdateRefundStatus")
+	defer span.Finish()
+
+	span.SetTag("external_id", r.ExternalID)
+	span.SetTag("status", r.Status)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+	}()
+
+	return u.endpoint.UpdateRefundStatus(ctx, r)
+}
+
+type GetterTracingDecorator struct {
+	endpoint endpointGet
+}
+
+func NewGetterTracingDecorator(endpoint endpointGet) *GetterTracingDecorator {
+	return &GetterTracingDecorator{endpoint: endpoint}
+}
+
+func (g GetterTracingDecorator) GetPayment(ctx context.Context, request GetPaymentRequest) (_ GetPaymentResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.GetPayment")
+	defer span.Finish()
+
+	span.SetTag("id", request.ID)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+	}()
+
+	return g.endpoint.GetPayment(ctx, request)
+}
+
+type ListerTracingDecorator struct {
+	endpoint endpointList
+}
+
+func NewListerTracingDecorator(endpoint endpointList) *ListerTracingDecorator {
+	return &ListerTracingDecorator{endpoint: endpoint}
+}
+
+func (l ListerTracingDecorator) ListPayments(ctx context.Context, request ListPaymentsRequest) (res ListPaymentsResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.ListPayments")
+	defer span.Finish()
+
+	span.SetTag("limit", request.Query.Limit)
+	span.SetTag("status", request.Query.Status)
+	span.SetTag("currency", request.Query.Currency)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+
+		span.SetTag("count", len(res.Payments))
+	}()
+
+	return l.endpoint.ListPayments(ctx, request)
+}
+
+type CapturerTracingDecorator struct {
+	endpoint endpointCapture
+}
+
+func NewCapturerTracingDecorator(endpoint endpointCapture) *CapturerTracingDecorator {
+	return &CapturerTracingDecorator{endpoint: endpoint}
+}
+
+func (c CapturerTracingDecorator) CapturePayment(ctx context.Context, r CaptureRequest) (_ CaptureResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.CapturePayment")
+	defer span.Finish()
+
+	span.SetTag("id", r.ID)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+	}()
+
+	return c.endpoint.CapturePayment(ctx, r)
+}
+
+type VoiderTracingDecorator struct {
+	endpoint endpointVoid
+}
+
+func NewVoiderTracingDecorator(endpoint endpointVoid) *VoiderTracingDecorator {
+	return &VoiderTracingDecorator{endpoint: endpoint}
+}
+
+func (v VoiderTracingDecorator) VoidPayment(ctx context.Context, r VoidRequest) (_ VoidResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.VoidPayment")
+	defer span.Finish()
+
+	span.SetTag("id", r.ID)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+	}()
+
+	return v.endpoint.VoidPayment(ctx, r)
+}
+
+type CancellerTracingDecorator struct {
+	endpoint endpointCancel
+}
+
+func NewCancellerTracingDecorator(endpoint endpointCancel) *CancellerTracingDecorator {
+	return &CancellerTracingDecorator{endpoint: endpoint}
+}
+
+func (c CancellerTracingDecorator) CancelPayment(ctx context.Context, r CancelRequest) (_ CancelResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.CancelPayment")
+	defer span.Finish()
+
+	span.SetTag("id", r.ID)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+	}()
+
+	return c.endpoint.CancelPayment(ctx, r)
+}
+
+type ReviewerTracingDecorator struct {
+	endpoint endpointReview
+}
+
+func NewReviewerTracingDecorator(endpoint endpointReview) *ReviewerTracingDecorator {
+	return &ReviewerTracingDecorator{endpoint: endpoint}
+}
+
+func (r ReviewerTracingDecorator) ApprovePayment(ctx context.Context, req ReviewRequest) (_ ReviewResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.ApprovePayment")
+	defer span.Finish()
+
+	span.SetTag("id", req.ID)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+	}()
+
+	return r.endpoint.ApprovePayment(ctx, req)
+}
+
+func (r ReviewerTracingDecorator) RejectPayment(ctx context.Context, req ReviewRequest) (_ ReviewResponse, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "payment.RejectPayment")
+	defer span.Finish()
+
+	span.SetTag("id", req.ID)
+
+	defer func() {
+		if err != nil {
+			span.SetTag("error", err)
+			return
+		}
+	}()
+
+	return r.endpoint.RejectPayment(ctx, req)
+}
@@ -3,15 +3,22 @@ package payment
 import (
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/xeipuuv/gojsonschema"
 	"payments/currency"
+	"payments/datastore"
 	"payments/gateways"
+	"payments/merchant"
+	"payments/problem"
 
 	_ "github.com/xeipuuv/gojsonschema"
 )
@@ -31,10 +38,19 @@ func init() {
 
 func NewHTTPEndpointInit(endpoint endpointInitiate) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, ok := requestMerchant(w, r)
+		if !ok {
+			return
+		}
+
 		type payload struct {
-			ID              uuid.UUID `json:"id"`
-			Currency        string    `json:"currency"`
-			AmountFractions uint      `json:"amount_fractions"`
+			ID                uuid.UUID      `json:"id"`
+			Currency          string         `json:"currency"`
+			AmountFractions   uint           `json:"amount_fractions"`
+			MerchantReference string         `json:"merchant_reference"`
+			CustomerID        string         `json:"customer_id"`
+			Context           map[string]any `json:"context"`
+			CaptureMethod     string         `json:"capture_method"`
 		}
 
 		defer func() {
@@ -43,14 +59,20 @@ func NewHTTPEndpointInit(endpoint endpointInitiate) http.Handler {
 
 		buff, err := io.ReadAll(r.Body)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeProblem(w, r, fmt.Errorf("could not read body: %w", err))
+			return
 		}
 
 		document := gojsonschema.NewBytesLoader(buff)
 
 		result, err := gojsonschema.Validate(schemaInit, document)
-		if err != nil || !result.Valid() {
-			w.WriteHeader(http.StatusBadRequest)
+		if err != nil {
+			problem.WriteMalformed(w, r, "invalid JSON")
+			return
+		}
+
+		if !result.Valid() {
+			writeProblem(w, r, validationErrorFromResult(result))
 			return
 		}
 
@@ -58,38 +80,91 @@ func NewHTTPEndpointInit(endpoint endpointInitiate) http.Handler {
 
 		if err := json.Unmarshal(buff, &p); err != nil {
 			// json schema validated the request, so if we have an error here, most likely it's related to any internal error
-			w.WriteHeader(http.StatusInternalServerError)
+			writeProblem(w, r, fmt.Errorf("could not unmarshal validated payload: %w", err))
 			return
 		}
 
-		var c currency.Currency
-
-		switch p.Currency {
-		case "AED":
-			c = currency.AED
-		case "USD":
-			c = currency.USD
-		default:
-			w.WriteHeader(http.StatusBadRequest)
+		c, err := currency.ByCode(p.Currency)
+		if err != nil {
+			writeProblem(w, r, fmt.Errorf("%w: %w", gateways.ErrUnsupportedCurrency, err))
 			return
 		}
 
-		_, err = endpoint.InitiatePayment(r.Context(), InitiateRequest{
-			ID:      p.ID,
-			Amount:  currency.NewAmountFromFractions(c, p.AmountFractions),
-			Context: nil,
+		resp, err := endpoint.InitiatePayment(r.Context(), InitiateRequest{
+			ID:                p.ID,
+			Merchant:          m,
+			Amount:            currency.NewAmountFromFractions(c, p.AmountFractions),
+			MerchantReference: p.MerchantReference,
+			CustomerID:        p.CustomerID,
+			ManualCapture:     p.CaptureMethod == captureMethodManual,
+			Context:           p.Context,
 		})
 
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeProblem(w, r, err)
 			return
 		}
 
+		w.Header().Set("Location", fmt.Sprintf("/payments/%s", resp.Payment.ID))
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		_, _ = w.Write([]byte(`{"status":"ok"}`))
+		if err := json.NewEncoder(w).Encode(newInitView(resp)); err != nil {
+			log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+		}
 	})
 }
 
+// captureMethodManual authorizes the payment only, see [InitiateRequest.ManualCapture].
+const captureMethodManual = "manual"
+
+// initResponseVersion must be changed whenever we introduce a breaking change in [initView].
+const initResponseVersion = "v1"
+
+type initView struct {
+	// Status is kept for the backward compatibility, the response used to be {"status":"ok"}
+	Status     string          `json:"status"`
+	APIVersion string          `json:"api_version"`
+	Payment    paymentView     `json:"payment"`
+	NextAction *nextActionView `json:"next_action"`
+}
+
+type nextActionView struct {
+	Type             NextActionType    `json:"type"`
+	RedirectURL      string            `json:"redirect_url,omitempty"`
+	ThreeDSecureData map[string]string `json:"three_d_secure_data,omitempty"`
+}
+
+func newInitView(resp InitiateResponse) initView {
+	v := initView{
+		Status:     "ok",
+		APIVersion: initResponseVersion,
+		Payment:    newPaymentView(resp.Payment),
+	}
+
+	if resp.NextAction != nil {
+		v.NextAction = &nextActionView{
+			Type:             resp.NextAction.Type,
+			RedirectURL:      resp.NextAction.RedirectURL,
+			ThreeDSecureData: resp.NextAction.ThreeDSecureData,
+		}
+	}
+
+	return v
+}
+
+func validationErrorFromResult(result *gojsonschema.Result) *problem.ValidationError {
+	v := &problem.ValidationError{}
+
+	for _, e := range result.Errors() {
+		v.Fields = append(v.Fields, problem.FieldError{
+			Field:   e.Field(),
+			Message: e.Description(),
+		})
+	}
+
+	return v
+}
+
 type WebhookReader interface {
 	UpdateStatusRequestToInternal(request any) (gateways.UpdateStatusRequest, error)
 }
@@ -98,11 +173,11 @@ func NewHTTPUpdateStatus(endpoint endpointUpdate, reader WebhookReader) http.Han
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		req, err := reader.UpdateStatusRequestToInternal(request)
 		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
-
 			// TODO logger would be injected
 			log.Default().Println(fmt.Sprintf("could not convert request to internal: %s", err.Error()))
 
+			problem.WriteMalformed(writer, request, "could not read the webhook")
+
 			return
 		}
 
@@ -111,11 +186,11 @@ func NewHTTPUpdateStatus(endpoint endpointUpdate, reader WebhookReader) http.Han
 			Status:     req.Status,
 		})
 		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
-
 			// TODO logger would be injected + rethinking what should be logged
 			log.Default().Println(fmt.Sprintf("could not update status: %s", err.Error()))
 
+			writeProblem(writer, request, err)
+
 			return
 		}
 
@@ -130,32 +205,484 @@ func NewHTTPRefund(endpoint endpointRefund) http.Handler {
 			_ = request.Body.Close()
 		}()
 
+		m, ok := requestMerchant(writer, request)
+		if !ok {
+			return
+		}
+
 		// TODO we could add json schema here
 
 		var payload struct {
-			ID uuid.UUID `json:"id"`
+			ID       uuid.UUID `json:"id"`
+			RefundID uuid.UUID `json:"refund_id"`
+			// AmountFractions is optional, the whole refundable amount is refunded by default
+			AmountFractions *uint `json:"amount_fractions"`
 		}
 
 		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
+			problem.WriteMalformed(writer, request, "invalid JSON")
 			return
 		}
 
-		resp, err := endpoint.RefundPayment(request.Context(), RefundRequest{ID: payload.ID})
+		if payload.RefundID == uuid.Nil {
+			// kept for the backward compatibility, clients should send the refund ID to retry safely
+			payload.RefundID = uuid.New()
+		}
+
+		resp, err := endpoint.RefundPayment(request.Context(), RefundRequest{
+			ID:              payload.ID,
+			MerchantID:      m.ID,
+			RefundID:        payload.RefundID,
+			AmountFractions: payload.AmountFractions,
+		})
 		if err != nil {
 			log.Default().Println(fmt.Sprintf("could not refund: %s", err))
-			writer.WriteHeader(http.StatusInternalServerError)
+			writeProblem(writer, request, err)
+			return
+		}
+
+		output := struct {
+			OK      bool        `json:"ok"`
+			Refund  refundView  `json:"refund"`
+			Payment paymentView `json:"payment"`
+		}{
+			OK:      resp.OK,
+			Refund:  newRefundView(resp.Refund),
+			Payment: newPaymentView(resp.Payment),
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		// the refund is processed asynchronously
+		writer.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(writer).Encode(output); err != nil {
+			log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+		}
+	})
+}
+
+type RefundWebhookReader interface {
+	UpdateRefundStatusRequestToInternal(request any) (gateways.UpdateRefundStatusRequest, error)
+}
+
+func NewHTTPUpdateRefundStatus(endpoint endpointUpdateRefund, reader RefundWebhookReader) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		req, err := reader.UpdateRefundStatusRequestToInternal(request)
+		if err != nil {
+			// TODO logger would be injected
+			log.Default().Println(fmt.Sprintf("could not convert request to internal: %s", err.Error()))
+
+			problem.WriteMalformed(writer, request, "could not read the webhook")
+
+			return
+		}
+
+		_, err = endpoint.UpdateRefundStatus(request.Context(), UpdateRefundStatusRequest{
+			ExternalID: req.ExternalID,
+			Status:     req.Status,
+		})
+		if err != nil {
+			log.Default().Println(fmt.Sprintf("could not update refund status: %s", err.Error()))
+
+			writeProblem(writer, request, err)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte(`{"status":"ok"}`))
+	})
+}
+
+// NewHTTPCapture expects the payment ID in the {id} path value, the body is optional.
+func NewHTTPCapture(endpoint endpointCapture) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			_ = request.Body.Close()
+		}()
+
+		m, ok := requestMerchant(writer, request)
+		if !ok {
+			return
+		}
+
+		id, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid payment ID")
+			return
+		}
+
+		var payload struct {
+			// AmountFractions is optional, the whole authorized amount is captured by default
+			AmountFractions *uint `json:"amount_fractions"`
+		}
+
+		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			problem.WriteMalformed(writer, request, "invalid JSON")
+			return
+		}
+
+		resp, err := endpoint.CapturePayment(request.Context(), CaptureRequest{ID: id, MerchantID: m.ID, AmountFractions: payload.AmountFractions})
+		if err != nil {
+			log.Default().Println(fmt.Sprintf("could not capture: %s", err))
+			writeProblem(writer, request, err)
+			return
+		}
+
+		writePayment(writer, resp.Payment)
+	})
+}
+
+// NewHTTPVoid expects the payment ID in the {id} path value.
+func NewHTTPVoid(endpoint endpointVoid) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m, ok := requestMerchant(writer, request)
+		if !ok {
+			return
+		}
+
+		id, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid payment ID")
+			return
+		}
+
+		resp, err := endpoint.VoidPayment(request.Context(), VoidRequest{ID: id, MerchantID: m.ID})
+		if err != nil {
+			log.Default().Println(fmt.Sprintf("could not void: %s", err))
+			writeProblem(writer, request, err)
+			return
+		}
+
+		writePayment(writer, resp.Payment)
+	})
+}
+
+// NewHTTPCancel expects the payment ID in the {id} path value.
+func NewHTTPCancel(endpoint endpointCancel) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m, ok := requestMerchant(writer, request)
+		if !ok {
+			return
+		}
+
+		id, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid payment ID")
+			return
+		}
+
+		resp, err := endpoint.CancelPayment(request.Context(), CancelRequest{ID: id, MerchantID: m.ID})
+		if err != nil {
+			log.Default().Println(fmt.Sprintf("could not cancel: %s", err))
+			writeProblem(writer, request, err)
+			return
+		}
+
+		writePayment(writer, resp.Payment)
+	})
+}
+
+// NewHTTPGetPayment expects the payment ID in the {id} path value.
+func NewHTTPGetPayment(endpoint endpointGet) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m, ok := requestMerchant(writer, request)
+		if !ok {
+			return
+		}
+
+		id, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid payment ID")
+			return
+		}
+
+		resp, err := endpoint.GetPayment(request.Context(), GetPaymentRequest{ID: id, MerchantID: m.ID})
+		if err != nil {
+			writeProblem(writer, request, err)
+			return
+		}
+
+		writePayment(writer, resp.Payment)
+	})
+}
+
+// NewHTTPReviewQueue lists payments held for the review across all the merchants, it's meant for the back office.
+// It accepts the same filters as [NewHTTPListPayments], except the status.
+func NewHTTPReviewQueue(endpoint endpointList) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		query, err := listQueryFromURL(request.URL.Query())
+		if err != nil {
+			problem.WriteMalformed(writer, request, err.Error())
+			return
+		}
+
+		query.Status = datastore.PaymentReview
+
+		resp, err := endpoint.ListPayments(request.Context(), ListPaymentsRequest{Query: query})
+		if errors.Is(err, datastore.ErrInvalidCursor) {
+			problem.WriteMalformed(writer, request, "invalid cursor")
 			return
 		}
+		if err != nil {
+			writeProblem(writer, request, err)
+			return
+		}
+
+		type reviewView struct {
+			paymentView
+			MerchantID  uuid.UUID `json:"merchant_id"`
+			RiskReasons []string  `json:"risk_reasons"`
+		}
+
+		output := struct {
+			Data       []reviewView `json:"data"`
+			NextCursor string       `json:"next_cursor,omitempty"`
+		}{
+			Data:       make([]reviewView, 0, len(resp.Payments)),
+			NextCursor: resp.NextCursor,
+		}
 
-		var output struct {
-			OK bool `json:"ok"`
+		for _, p := range resp.Payments {
+			output.Data = append(output.Data, reviewView{paymentView: newPaymentView(p), MerchantID: p.MerchantID, RiskReasons: p.RiskReasons})
 		}
-		output.OK = resp.OK
 
+		writer.Header().Set("Content-Type", "application/json")
 		writer.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(writer).Encode(output); err != nil {
 			log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
 		}
 	})
 }
+
+// NewHTTPApprovePayment expects the payment ID in the {id} path value, the response has the same format as the init response.
+func NewHTTPApprovePayment(endpoint endpointReview) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid payment ID")
+			return
+		}
+
+		resp, err := endpoint.ApprovePayment(request.Context(), ReviewRequest{ID: id})
+		if err != nil {
+			writeProblem(writer, request, err)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(writer).Encode(newInitView(InitiateResponse{Payment: resp.Payment, NextAction: resp.NextAction})); err != nil {
+			log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+		}
+	})
+}
+
+// NewHTTPRejectPayment expects the payment ID in the {id} path value.
+func NewHTTPRejectPayment(endpoint endpointReview) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid payment ID")
+			return
+		}
+
+		resp, err := endpoint.RejectPayment(request.Context(), ReviewRequest{ID: id})
+		if err != nil {
+			writeProblem(writer, request, err)
+			return
+		}
+
+		writePayment(writer, resp.Payment)
+	})
+}
+
+// requestMerchant returns the merchant performing the request, see [merchant.NewHTTPAuthenticate].
+func requestMerchant(writer http.ResponseWriter, request *http.Request) (merchant.Merchant, bool) {
+	m, err := merchant.FromContext(request.Context())
+	if err != nil {
+		writeProblem(writer, request, err)
+		return merchant.Merchant{}, false
+	}
+
+	return m, true
+}
+
+func writePayment(writer http.ResponseWriter, p datastore.Payment) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(writer).Encode(newPaymentView(p)); err != nil {
+		log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+	}
+}
+
+const (
+	listDefaultLimit = 50
+	listMaxLimit     = 200
+)
+
+// NewHTTPListPayments supports the following query parameters:
+// status, currency, created_from, created_to (RFC 3339), min_amount_fractions, max_amount_fractions,
+// merchant_reference, limit and cursor.
+func NewHTTPListPayments(endpoint endpointList) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m, ok := requestMerchant(writer, request)
+		if !ok {
+			return
+		}
+
+		query, err := listQueryFromURL(request.URL.Query())
+		if err != nil {
+			problem.WriteMalformed(writer, request, err.Error())
+			return
+		}
+
+		query.MerchantID = &m.ID
+
+		resp, err := endpoint.ListPayments(request.Context(), ListPaymentsRequest{Query: query})
+		if errors.Is(err, datastore.ErrInvalidCursor) {
+			problem.WriteMalformed(writer, request, "invalid cursor")
+			return
+		}
+		if err != nil {
+			writeProblem(writer, request, err)
+			return
+		}
+
+		output := struct {
+			Data       []paymentView `json:"data"`
+			NextCursor string        `json:"next_cursor,omitempty"`
+		}{
+			Data:       make([]paymentView, 0, len(resp.Payments)),
+			NextCursor: resp.NextCursor,
+		}
+
+		for _, p := range resp.Payments {
+			output.Data = append(output.Data, newPaymentView(p))
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(writer).Encode(output); err != nil {
+			log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+		}
+	})
+}
+
+func listQueryFromURL(values url.Values) (datastore.ListQuery, error) {
+	q := datastore.ListQuery{
+		Status:            datastore.PaymentStatus(values.Get("status")),
+		Currency:          values.Get("currency"),
+		MerchantReference: values.Get("merchant_reference"),
+		Cursor:            values.Get("cursor"),
+		Limit:             listDefaultLimit,
+	}
+
+	var err error
+
+	parseTime := func(name string, target *time.Time) {
+		if v := values.Get(name); v != "" && err == nil {
+			*target, err = time.Parse(time.RFC3339, v)
+		}
+	}
+
+	parseUint := func(name string, target **uint) {
+		if v := values.Get(name); v != "" && err == nil {
+			var n uint64
+			if n, err = strconv.ParseUint(v, 10, 0); err == nil {
+				u := uint(n)
+				*target = &u
+			}
+		}
+	}
+
+	parseTime("created_from", &q.CreatedFrom)
+	parseTime("created_to", &q.CreatedTo)
+	parseUint("min_amount_fractions", &q.MinAmount)
+	parseUint("max_amount_fractions", &q.MaxAmount)
+
+	if v := values.Get("limit"); v != "" && err == nil {
+		if q.Limit, err = strconv.Atoi(v); err == nil && (q.Limit < 1 || q.Limit > listMaxLimit) {
+			err = fmt.Errorf("limit must be between 1 and %d", listMaxLimit)
+		}
+	}
+
+	return q, err
+}
+
+// paymentView is the representation of the payment shared by all the read endpoints.
+type paymentView struct {
+	ID                      uuid.UUID               `json:"id"`
+	ExternalID              string                  `json:"external_id"`
+	Status                  datastore.PaymentStatus `json:"status"`
+	Currency                string                  `json:"currency"`
+	AmountFractions         uint                    `json:"amount_fractions"`
+	CapturedAmountFractions *uint                   `json:"captured_amount_fractions,omitempty"`
+	RefundedAmountFractions uint                    `json:"refunded_amount_fractions"`
+	FeeFractions            *uint                   `json:"fee_fractions,omitempty"`
+	MerchantReference       string                  `json:"merchant_reference,omitempty"`
+	CustomerID              string                  `json:"customer_id,omitempty"`
+	CreatedAt               time.Time               `json:"created_at"`
+	UpdatedAt               time.Time               `json:"updated_at"`
+	Refunds                 []refundView            `json:"refunds"`
+}
+
+type refundView struct {
+	ID              uuid.UUID              `json:"id"`
+	ExternalID      string                 `json:"external_id,omitempty"`
+	Status          datastore.RefundStatus `json:"status"`
+	AmountFractions uint                   `json:"amount_fractions"`
+	FeeFractions    *uint                  `json:"fee_fractions,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+func newRefundView(r datastore.Refund) refundView {
+	return refundView{
+		ID:              r.ID,
+		ExternalID:      r.ExternalID,
+		Status:          r.Status,
+		AmountFractions: r.Amount.ToFractional(),
+		FeeFractions:    feeFractions(r.Fee),
+		CreatedAt:       r.CreatedAt,
+		UpdatedAt:       r.UpdatedAt,
+	}
+}
+
+// feeFractions returns nil when the fee is unknown, e.g. the payment was initiated before we introduced fees.
+func feeFractions(fee *currency.Amount) *uint {
+	if fee == nil {
+		return nil
+	}
+
+	x := fee.ToFractional()
+
+	return &x
+}
+
+func newPaymentView(p datastore.Payment) paymentView {
+	v := paymentView{
+		ID:                      p.ID,
+		ExternalID:              p.ExternalID,
+		Status:                  p.Status,
+		Currency:                p.Amount.Currency.Code,
+		AmountFractions:         p.Amount.ToFractional(),
+		RefundedAmountFractions: p.RefundedAmount().ToFractional(),
+		FeeFractions:            feeFractions(p.Fee),
+		MerchantReference:       p.MerchantReference,
+		CustomerID:              p.CustomerID,
+		CreatedAt:               p.CreatedAt,
+		UpdatedAt:               p.UpdatedAt,
+		Refunds:                 make([]refundView, 0, len(p.Refunds)),
+	}
+
+	if p.Captured != nil {
+		captured := p.Captured.ToFractional()
+		v.CapturedAmountFractions = &captured
+	}
+
+	for _, r := range p.Refunds {
+		v.Refunds = append(v.Refunds, newRefundView(r))
+	}
+
+	return v
+}
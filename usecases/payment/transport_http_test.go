@@ -0,0 +1,388 @@
+package payment_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/currency"
+	"payments/datastore"
+	"payments/gateways"
+	"payments/merchant"
+	"payments/problem"
+	"payments/usecases/payment"
+)
+
+func init() {
+	log.SetOutput(io.Discard)
+}
+
+type initiatorMock struct {
+	err error
+}
+
+func (i initiatorMock) InitiatePayment(_ context.Context, r payment.InitiateRequest) (payment.InitiateResponse, error) {
+	if i.err != nil {
+		return payment.InitiateResponse{}, i.err
+	}
+
+	return payment.InitiateResponse{
+		Payment: datastore.Payment{
+			ID:     r.ID,
+			Status: datastore.PaymentInitiated,
+			Amount: r.Amount,
+		},
+	}, nil
+}
+
+func TestNewHTTPEndpointInit(t *testing.T) {
+	t.Parallel()
+
+	const validBody = `{"currency":"AED", "id": "6b77a7bc-0bee-49ab-bbb0-70d5245a20f7", "amount_fractions":99999}`
+
+	scenarios := []struct {
+		name         string
+		body         string
+		err          error
+		status       int
+		code         problem.Code
+		invalidField string
+		anonymous    bool
+	}{
+		{
+			name:   "Created",
+			body:   validBody,
+			status: http.StatusCreated,
+		},
+		{
+			name:      "Unauthenticated",
+			body:      validBody,
+			anonymous: true,
+			status:    http.StatusUnauthorized,
+			code:      problem.CodeUnauthenticated,
+		},
+		{
+			name:   "Malformed JSON",
+			body:   `{"currency":`,
+			status: http.StatusBadRequest,
+			code:   problem.CodeMalformedRequest,
+		},
+		{
+			// the minimum amount is the limit of the merchant, see limits.Checker
+			name:   "Small amount",
+			body:   `{"currency":"AED", "id": "6b77a7bc-0bee-49ab-bbb0-70d5245a20f7", "amount_fractions":99}`,
+			status: http.StatusCreated,
+		},
+		{
+			name:         "Validation",
+			body:         `{"currency":"AED", "id": "6b77a7bc-0bee-49ab-bbb0-70d5245a20f7", "amount_fractions":0}`,
+			status:       http.StatusUnprocessableEntity,
+			code:         problem.CodeValidationFailed,
+			invalidField: "amount_fractions",
+		},
+		{
+			name:   "Duplicate",
+			body:   validBody,
+			err:    fmt.Errorf("could not persist: %w", datastore.ErrDuplicate),
+			status: http.StatusConflict,
+			code:   payment.ProblemDuplicatePayment,
+		},
+		{
+			name:   "Unknown currency",
+			body:   `{"currency":"EUR", "id": "6b77a7bc-0bee-49ab-bbb0-70d5245a20f7", "amount_fractions":99999}`,
+			status: http.StatusUnprocessableEntity,
+			code:   payment.ProblemUnsupportedCurrency,
+		},
+		{
+			name:   "Unsupported currency",
+			body:   validBody,
+			err:    fmt.Errorf("%w: %w", payment.ErrGateway, gateways.ErrUnsupportedCurrency),
+			status: http.StatusUnprocessableEntity,
+			code:   payment.ProblemUnsupportedCurrency,
+		},
+		{
+			name:   "Gateway unavailable",
+			body:   validBody,
+			err:    fmt.Errorf("%w: %w", payment.ErrGateway, gateways.ErrUnavailable),
+			status: http.StatusServiceUnavailable,
+			code:   payment.ProblemGatewayUnavailable,
+		},
+		{
+			name:   "Gateway error",
+			body:   validBody,
+			err:    fmt.Errorf("%w: invalid status code", payment.ErrGateway),
+			status: http.StatusBadGateway,
+			code:   payment.ProblemGatewayError,
+		},
+		{
+			name:   "Internal error",
+			body:   validBody,
+			err:    errors.New("my error"),
+			status: http.StatusInternalServerError,
+			code:   problem.CodeInternal,
+		},
+	}
+
+	for _, s := range scenarios {
+		s := s
+
+		t.Run(s.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := payment.NewHTTPEndpointInit(initiatorMock{err: s.err})
+
+			request := httptest.NewRequest(http.MethodPost, "/init-payment", strings.NewReader(s.body))
+			if !s.anonymous {
+				request = request.WithContext(merchant.NewContext(request.Context(), merchant.Merchant{Currencies: []string{"AED"}}))
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, s.status, recorder.Code)
+
+			if s.code == "" {
+				assert.Equal(t, "/payments/6b77a7bc-0bee-49ab-bbb0-70d5245a20f7", recorder.Header().Get("Location"))
+				return
+			}
+
+			assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+
+			var response problem.Problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, s.code, response.Code)
+			assert.Equal(t, s.status, response.Status)
+			assert.Equal(t, "/init-payment", response.Instance)
+			assert.NotContains(t, recorder.Body.String(), "my error")
+
+			if s.invalidField != "" {
+				require.Len(t, response.Errors, 1)
+				assert.Equal(t, s.invalidField, response.Errors[0].Field)
+			}
+		})
+	}
+}
+
+// listerSpy records the query, and lists an empty repository, so the cursor is validated by the datastore.
+type listerSpy struct {
+	query datastore.ListQuery
+}
+
+func (l *listerSpy) ListPayments(ctx context.Context, r payment.ListPaymentsRequest) (payment.ListPaymentsResponse, error) {
+	l.query = r.Query
+
+	return payment.NewEndpointLister(datastore.NewInMemoryPaymentRepository()).ListPayments(ctx, r)
+}
+
+func TestNewHTTPListPayments(t *testing.T) {
+	t.Parallel()
+
+	merchantID := uuid.New()
+	minAmount, maxAmount := uint(100), uint(5000)
+
+	scenarios := []struct {
+		name      string
+		query     string
+		anonymous bool
+		status    int
+		code      problem.Code
+		expected  datastore.ListQuery
+	}{
+		{
+			name:     "Defaults",
+			status:   http.StatusOK,
+			expected: datastore.ListQuery{MerchantID: &merchantID, Limit: 50},
+		},
+		{
+			name: "Filters",
+			query: "status=paid&currency=AED&merchant_reference=order-1&created_from=2024-07-01T00:00:00Z" +
+				"&created_to=2024-08-01T00:00:00%2B04:00&min_amount_fractions=100&max_amount_fractions=5000&limit=200",
+			status: http.StatusOK,
+			expected: datastore.ListQuery{
+				MerchantID:        &merchantID,
+				Status:            datastore.PaymentPaid,
+				Currency:          "AED",
+				CreatedFrom:       time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+				CreatedTo:         time.Date(2024, 7, 31, 20, 0, 0, 0, time.UTC),
+				MinAmount:         &minAmount,
+				MaxAmount:         &maxAmount,
+				MerchantReference: "order-1",
+				Limit:             200,
+			},
+		},
+		{
+			name:      "Unauthenticated",
+			anonymous: true,
+			status:    http.StatusUnauthorized,
+			code:      problem.CodeUnauthenticated,
+		},
+		{
+			name:   "Zero limit",
+			query:  "limit=0",
+			status: http.StatusBadRequest,
+			code:   problem.CodeMalformedRequest,
+		},
+		{
+			name:   "Limit above the maximum",
+			query:  "limit=201",
+			status: http.StatusBadRequest,
+			code:   problem.CodeMalformedRequest,
+		},
+		{
+			name:   "Invalid time",
+			query:  "created_from=2024-07-01",
+			status: http.StatusBadRequest,
+			code:   problem.CodeMalformedRequest,
+		},
+		{
+			name:   "Negative amount",
+			query:  "min_amount_fractions=-1",
+			status: http.StatusBadRequest,
+			code:   problem.CodeMalformedRequest,
+		},
+		{
+			name:   "Invalid cursor",
+			query:  "cursor=invalid",
+			status: http.StatusBadRequest,
+			code:   problem.CodeMalformedRequest,
+		},
+	}
+
+	for _, s := range scenarios {
+		s := s
+
+		t.Run(s.name, func(t *testing.T) {
+			t.Parallel()
+
+			lister := &listerSpy{}
+			handler := payment.NewHTTPListPayments(lister)
+
+			request := httptest.NewRequest(http.MethodGet, "/payments?"+s.query, nil)
+			if !s.anonymous {
+				request = request.WithContext(merchant.NewContext(request.Context(), merchant.Merchant{ID: merchantID}))
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, s.status, recorder.Code)
+
+			if s.code == "" {
+				assert.Equal(t, s.expected.CreatedFrom, lister.query.CreatedFrom.UTC())
+				assert.Equal(t, s.expected.CreatedTo, lister.query.CreatedTo.UTC())
+				lister.query.CreatedFrom, lister.query.CreatedTo = s.expected.CreatedFrom, s.expected.CreatedTo
+				assert.Equal(t, s.expected, lister.query)
+				assert.JSONEq(t, `{"data":[]}`, recorder.Body.String())
+				return
+			}
+
+			var response problem.Problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, s.code, response.Code)
+		})
+	}
+}
+
+func TestNewHTTPGetPayment(t *testing.T) {
+	t.Parallel()
+
+	repo := datastore.NewInMemoryPaymentRepository()
+	owner := uuid.New()
+	p := datastore.Payment{
+		ID:         uuid.New(),
+		MerchantID: owner,
+		Status:     datastore.PaymentInitiated,
+		Amount:     currency.MustNewAmount(currency.AED, 100, 0),
+	}
+	require.NoError(t, repo.Create(context.Background(), p))
+
+	handler := payment.NewHTTPGetPayment(payment.NewEndpointGetter(repo))
+
+	scenarios := []struct {
+		name       string
+		id         string
+		merchantID uuid.UUID
+		anonymous  bool
+		status     int
+		code       problem.Code
+	}{
+		{
+			name:       "Found",
+			id:         p.ID.String(),
+			merchantID: owner,
+			status:     http.StatusOK,
+		},
+		{
+			name:       "Unknown ID",
+			id:         uuid.NewString(),
+			merchantID: owner,
+			status:     http.StatusNotFound,
+			code:       payment.ProblemPaymentNotFound,
+		},
+		{
+			name:       "Another merchant",
+			id:         p.ID.String(),
+			merchantID: uuid.New(),
+			status:     http.StatusNotFound,
+			code:       payment.ProblemPaymentNotFound,
+		},
+		{
+			name:       "Malformed ID",
+			id:         "not-a-uuid",
+			merchantID: owner,
+			status:     http.StatusBadRequest,
+			code:       problem.CodeMalformedRequest,
+		},
+		{
+			name:      "Unauthenticated",
+			id:        p.ID.String(),
+			anonymous: true,
+			status:    http.StatusUnauthorized,
+			code:      problem.CodeUnauthenticated,
+		},
+	}
+
+	for _, s := range scenarios {
+		s := s
+
+		t.Run(s.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodGet, "/payments/"+s.id, nil)
+			request.SetPathValue("id", s.id)
+			if !s.anonymous {
+				request = request.WithContext(merchant.NewContext(request.Context(), merchant.Merchant{ID: s.merchantID}))
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, s.status, recorder.Code)
+
+			if s.code == "" {
+				var response struct {
+					ID uuid.UUID `json:"id"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, p.ID, response.ID)
+				return
+			}
+
+			var response problem.Problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, s.code, response.Code)
+			assert.Equal(t, "/payments/"+s.id, response.Instance)
+		})
+	}
+}
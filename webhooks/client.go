@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrInvalidURL is returned when the callback URL is not an absolute https URL.
+	ErrInvalidURL = errors.New("invalid callback URL")
+	// ErrNonPublicAddress is returned when the callback URL points to our own network (loopback, private, link-local, e.g. cloud metadata).
+	ErrNonPublicAddress = errors.New("non-public address")
+)
+
+// sharedAddressSpace (RFC 6598) is used by carrier-grade NATs and some cloud providers internally.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewHTTPClient returns the client for callback URLs provided by merchants, so they cannot make us call our own network.
+// Addresses are checked after the DNS resolution (right before connecting), so DNS rebinding does not help,
+// proxies from the environment are not used, and redirects are not followed.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+
+			if !isPublic(addr) {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, addr)
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConnsPerHost:   2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			// the redirect could point anywhere, the response is treated as the final one
+			return http.ErrUseLastResponse
+		},
+		Timeout: timeout,
+	}
+}
+
+// ValidateURL accepts absolute https URLs, IP addresses must be public, host names are checked when we connect, see [NewHTTPClient].
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !isPublic(addr) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, addr)
+	}
+
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!sharedAddressSpace.Contains(addr) &&
+		!(addr.Is4() && addr.As4()[0] == 0) // "this network"
+}
@@ -0,0 +1,143 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// dispatcherState is what [NewFileDispatcher] stores, the secrets and the failure counters are hidden from the API.
+type dispatcherState struct {
+	Subscriptions []storedSubscription `json:"subscriptions"`
+	Deliveries    []storedDelivery     `json:"deliveries"`
+	Published     map[string]time.Time `json:"published"`
+}
+
+type storedSubscription struct {
+	Subscription
+	Secret string `json:"secret"`
+}
+
+type storedDelivery struct {
+	Delivery
+	Failures int `json:"failures"`
+}
+
+// NewFileDispatcher returns the [Dispatcher] that survives restarts, the state is loaded from the given file,
+// and the whole state is written to it (atomically) after every change.
+//
+// Changes requested by the caller (subscriptions, published events, redeliveries) fail when they cannot be stored,
+// so the outbox relay doesn't acknowledge the event that would be lost.
+// It's designed for local development and small deployments, like datastore.FilePaymentRepository.
+//
+// The file is read once, so it must not be shared by several instances.
+func NewFileDispatcher(http doer, o Options, path string) (_ *Dispatcher, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("NewFileDispatcher(%+q): %w", path, err)
+		}
+	}()
+
+	d := NewDispatcher(http, o)
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(raw) > 0 {
+		var state dispatcherState
+		if err := json.Unmarshal(raw, &state); err != nil {
+			return nil, fmt.Errorf("could not unmarshal the state: %w", err)
+		}
+
+		d.restore(state)
+	}
+
+	d.persist = func(state dispatcherState) error {
+		return writeState(path, state)
+	}
+
+	return d, nil
+}
+
+// save must be called under the lock.
+func (d *Dispatcher) save() error {
+	if d.persist == nil {
+		return nil
+	}
+
+	return d.persist(d.state())
+}
+
+// saveOrLog is used by the background work, the state in memory is still valid, and it's stored by the next change.
+func (d *Dispatcher) saveOrLog() {
+	if err := d.save(); err != nil {
+		// TODO logger would be injected
+		log.Default().Println(fmt.Sprintf("Dispatcher: could not store the state: %s", err))
+	}
+}
+
+func (d *Dispatcher) state() dispatcherState {
+	state := dispatcherState{
+		Subscriptions: make([]storedSubscription, 0, len(d.subscriptions)),
+		Deliveries:    make([]storedDelivery, 0, len(d.deliveries)),
+		Published:     d.published,
+	}
+
+	for _, s := range d.subscriptions {
+		state.Subscriptions = append(state.Subscriptions, storedSubscription{Subscription: s, Secret: s.Secret})
+	}
+
+	for _, x := range d.deliveries {
+		state.Deliveries = append(state.Deliveries, storedDelivery{Delivery: *x, Failures: x.failures})
+	}
+
+	return state
+}
+
+func (d *Dispatcher) restore(state dispatcherState) {
+	for _, s := range state.Subscriptions {
+		s.Subscription.Secret = s.Secret
+		d.subscriptions[s.ID] = s.Subscription
+	}
+
+	for _, x := range state.Deliveries {
+		x.Delivery.failures = x.Failures
+		d.deliveries[x.ID] = &x.Delivery
+	}
+
+	for id, at := range state.Published {
+		d.published[id] = at
+	}
+}
+
+// writeState replaces the file, so it contains either the previous or the new state after a crash.
+func writeState(path string, state dispatcherState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("could not marshal the state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+
+	// the file contains the secrets of the subscriptions
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(raw)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if err = errors.Join(err, file.Close()); err != nil {
+		return fmt.Errorf("could not write the state: %w", err)
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,133 @@
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/datastore"
+	"payments/webhooks"
+)
+
+func TestNewFileDispatcher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	merchantID := uuid.New()
+	paid := datastore.OutboxMessage{
+		Seq: 2,
+		Event: datastore.Event{
+			PaymentID:  uuid.New(),
+			MerchantID: merchantID,
+			Version:    2,
+			Type:       datastore.EventPaymentPaid,
+			OccurredAt: time.Now(),
+		},
+	}
+
+	t.Run("Restart", func(t *testing.T) {
+		t.Parallel()
+
+		var fail atomic.Bool
+		var signature, body atomic.Value
+		fail.Store(true)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fail.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			b, _ := io.ReadAll(r.Body)
+			body.Store(b)
+			signature.Store(r.Header.Get(webhooks.SignatureHeader))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		o := webhooks.Options{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+
+		d, err := webhooks.NewFileDispatcher(http.DefaultClient, o, path)
+		require.NoError(t, err)
+
+		s, err := d.Subscribe(ctx, merchantID, server.URL, "my-secret")
+		require.NoError(t, err)
+		require.NoError(t, d.Publish(ctx, paid))
+		d.DeliverDue(ctx)
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "the file contains secrets")
+
+		restarted, err := webhooks.NewFileDispatcher(http.DefaultClient, o, path)
+		require.NoError(t, err)
+
+		// the duplicate from the outbox relay is still recognised
+		require.NoError(t, restarted.Publish(ctx, paid))
+
+		pending := restarted.Deliveries(ctx, merchantID, webhooks.DeliveryPending)
+		require.Len(t, pending, 1)
+		assert.Equal(t, s.ID, pending[0].SubscriptionID)
+		assert.Len(t, pending[0].Attempts, 1)
+
+		// the failure is remembered, so the next failed attempt is the last one
+		time.Sleep(time.Millisecond * 5)
+		restarted.DeliverDue(ctx)
+		require.Len(t, restarted.Deliveries(ctx, merchantID, webhooks.DeliveryDead), 1)
+
+		// and the secret is kept for the redelivery
+		fail.Store(false)
+		_, err = restarted.Redeliver(ctx, merchantID, pending[0].ID)
+		require.NoError(t, err)
+		restarted.DeliverDue(ctx)
+
+		delivered := restarted.Deliveries(ctx, merchantID, webhooks.DeliveryDelivered)
+		require.Len(t, delivered, 1)
+
+		at := delivered[0].Attempts[2].At
+		assert.Equal(t, webhooks.Sign("my-secret", at, body.Load().([]byte)), signature.Load())
+	})
+
+	t.Run("Write failure", func(t *testing.T) {
+		t.Parallel()
+
+		dir := filepath.Join(t.TempDir(), "data")
+		require.NoError(t, os.Mkdir(dir, 0o755))
+
+		d, err := webhooks.NewFileDispatcher(http.DefaultClient, webhooks.Options{}, filepath.Join(dir, "webhooks.json"))
+		require.NoError(t, err)
+
+		_, err = d.Subscribe(ctx, merchantID, "https://merchant.example.com", "")
+		require.NoError(t, err)
+
+		require.NoError(t, os.RemoveAll(dir))
+
+		// the relay publishes the event again, so it must not be remembered as published
+		require.Error(t, d.Publish(ctx, paid))
+		assert.Empty(t, d.Deliveries(ctx, merchantID, ""))
+
+		require.NoError(t, os.Mkdir(dir, 0o755))
+		require.NoError(t, d.Publish(ctx, paid))
+		assert.Len(t, d.Deliveries(ctx, merchantID, webhooks.DeliveryPending), 1)
+	})
+
+	t.Run("Corrupted file", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+		_, err := webhooks.NewFileDispatcher(http.DefaultClient, webhooks.Options{}, path)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,119 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"payments/merchant"
+	"payments/problem"
+)
+
+// Codes of the webhook endpoints, see [problem.Code].
+const (
+	ProblemInvalidURL       problem.Code = "invalid_callback_url"
+	ProblemDeliveryNotFound problem.Code = "delivery_not_found"
+)
+
+var problems = []problem.Definition{
+	{Err: merchant.ErrUnauthenticated, Code: problem.CodeUnauthenticated, Status: http.StatusUnauthorized, Title: "Authentication required"},
+	{Err: ErrInvalidURL, Code: ProblemInvalidURL, Status: http.StatusBadRequest, Title: "Callback URL must be an absolute https URL of a public address"},
+	{Err: ErrNonPublicAddress, Code: ProblemInvalidURL, Status: http.StatusBadRequest, Title: "Callback URL must be an absolute https URL of a public address"},
+	{Err: ErrNotFound, Code: ProblemDeliveryNotFound, Status: http.StatusNotFound, Title: "Delivery not found"},
+}
+
+// NewHTTPSubscribe registers the callback URL, the secret is returned only once.
+func NewHTTPSubscribe(d *Dispatcher) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			_ = request.Body.Close()
+		}()
+
+		m, err := merchant.FromContext(request.Context())
+		if err != nil {
+			problem.WriteError(writer, request, err, problems)
+			return
+		}
+
+		var payload struct {
+			URL    string `json:"url"`
+			Secret string `json:"secret"`
+		}
+
+		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+			problem.WriteMalformed(writer, request, "invalid JSON")
+			return
+		}
+
+		if err := ValidateURL(payload.URL); err != nil {
+			problem.WriteError(writer, request, err, problems)
+			return
+		}
+
+		s, err := d.Subscribe(request.Context(), m.ID, payload.URL, payload.Secret)
+		if err != nil {
+			problem.WriteError(writer, request, fmt.Errorf("could not subscribe: %w", err), problems)
+			return
+		}
+
+		var output struct {
+			Subscription
+			Secret string `json:"secret"`
+		}
+		output.Subscription = s
+		output.Secret = s.Secret
+
+		writeJSON(writer, http.StatusCreated, output)
+	})
+}
+
+// NewHTTPDeliveries returns the delivery log, it can be filtered by ?status=dead.
+func NewHTTPDeliveries(d *Dispatcher) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m, err := merchant.FromContext(request.Context())
+		if err != nil {
+			problem.WriteError(writer, request, err, problems)
+			return
+		}
+
+		status := DeliveryStatus(request.URL.Query().Get("status"))
+
+		writeJSON(writer, http.StatusOK, d.Deliveries(request.Context(), m.ID, status))
+	})
+}
+
+// NewHTTPRedeliver expects the delivery ID in the {id} path value.
+func NewHTTPRedeliver(d *Dispatcher) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m, err := merchant.FromContext(request.Context())
+		if err != nil {
+			problem.WriteError(writer, request, err, problems)
+			return
+		}
+
+		id, err := uuid.Parse(request.PathValue("id"))
+		if err != nil {
+			problem.WriteMalformed(writer, request, "invalid delivery ID")
+			return
+		}
+
+		delivery, err := d.Redeliver(request.Context(), m.ID, id)
+		if err != nil {
+			problem.WriteError(writer, request, err, problems)
+			return
+		}
+
+		writeJSON(writer, http.StatusAccepted, delivery)
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, status int, v any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	if err := json.NewEncoder(writer).Encode(v); err != nil {
+		log.Default().Println(fmt.Sprintf("could not encode response: %s", err.Error()))
+	}
+}
@@ -0,0 +1,58 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/merchant"
+	"payments/problem"
+	"payments/webhooks"
+)
+
+func TestHTTPProblems(t *testing.T) {
+	t.Parallel()
+
+	d := webhooks.NewDispatcher(http.DefaultClient, webhooks.Options{})
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /webhooks", webhooks.NewHTTPSubscribe(d))
+	mux.Handle("POST /webhooks/deliveries/{id}/redeliver", webhooks.NewHTTPRedeliver(d))
+
+	tests := map[string]struct {
+		path   string
+		body   string
+		status int
+		code   problem.Code
+	}{
+		"Malformed JSON":   {path: "/webhooks", body: `{"url":`, status: http.StatusBadRequest, code: problem.CodeMalformedRequest},
+		"Plain http":       {path: "/webhooks", body: `{"url":"http://merchant.example.com"}`, status: http.StatusBadRequest, code: webhooks.ProblemInvalidURL},
+		"Private address":  {path: "/webhooks", body: `{"url":"https://10.0.0.1"}`, status: http.StatusBadRequest, code: webhooks.ProblemInvalidURL},
+		"Malformed ID":     {path: "/webhooks/deliveries/invalid/redeliver", status: http.StatusBadRequest, code: problem.CodeMalformedRequest},
+		"Unknown delivery": {path: "/webhooks/deliveries/" + uuid.NewString() + "/redeliver", status: http.StatusNotFound, code: webhooks.ProblemDeliveryNotFound},
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPost, s.path, strings.NewReader(s.body))
+			request = request.WithContext(merchant.NewContext(request.Context(), merchant.Merchant{ID: uuid.New()}))
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+
+			require.Equal(t, s.status, recorder.Code)
+			assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+
+			var response problem.Problem
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+			assert.Equal(t, s.code, response.Code)
+		})
+	}
+}
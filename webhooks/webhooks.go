@@ -0,0 +1,534 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"payments/datastore"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead means we gave up after [Options.MaxAttempts], it can be redelivered manually.
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// SignatureHeader contains "t=<unix timestamp>,v1=<hex hmac-sha256 of "<timestamp>.<body>">".
+const SignatureHeader = "X-Payments-Signature"
+
+var ErrNotFound = errors.New("not found")
+
+// Subscription receives notifications about payments of its merchant only.
+type Subscription struct {
+	ID         uuid.UUID `json:"id"`
+	MerchantID uuid.UUID `json:"merchant_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type Delivery struct {
+	ID             uuid.UUID      `json:"id"`
+	MerchantID     uuid.UUID      `json:"merchant_id"`
+	SubscriptionID uuid.UUID      `json:"subscription_id"`
+	Notification   Notification   `json:"notification"`
+	Status         DeliveryStatus `json:"status"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	Attempts       []Attempt      `json:"attempts"`
+	// failures are counted since the last success or the manual redelivery, all the attempts are kept for the log
+	failures int
+}
+
+// Notification is the body we send to the merchant.
+//
+// Refunds are notified by "refund.<status>" only, refund events don't carry the status of the payment,
+// so there is no "payment.partially_refunded" (or "payment.refunded" for refunds requested by the merchant),
+// the merchant fetches the payment to learn how much is refunded.
+type Notification struct {
+	ID         string                  `json:"id"` // stable across retries, merchants should use it for deduplication
+	Type       string                  `json:"type"`
+	PaymentID  uuid.UUID               `json:"payment_id"`
+	Status     datastore.PaymentStatus `json:"status,omitempty"`
+	OccurredAt time.Time               `json:"occurred_at"`
+	// RefundID and RefundStatus are set for the refund notifications only
+	RefundID     *uuid.UUID             `json:"refund_id,omitempty"`
+	RefundStatus datastore.RefundStatus `json:"refund_status,omitempty"`
+}
+
+type Options struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	// Retention defines how long delivered and dead deliveries are kept (and how long duplicates of the event are ignored)
+	Retention time.Duration
+}
+
+type doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Dispatcher sends signed status-change notifications to the registered callback URLs.
+//
+// It implements [outbox.Publisher], so the outbox relay feeds it with domain events.
+// Every event creates a delivery per subscription, failed deliveries are retried with the exponential backoff,
+// after [Options.MaxAttempts] they become dead.
+type Dispatcher struct {
+	http          doer
+	options       Options
+	subscriptions map[uuid.UUID]Subscription
+	deliveries    map[uuid.UUID]*Delivery
+	// published protects us against duplicates (the outbox relay delivers at-least-once), values are publication times
+	published map[string]time.Time
+	locker    *sync.Mutex
+	now       func() time.Time
+	// persist stores the whole state after every change, see [NewFileDispatcher], it's nil for the in-memory dispatcher
+	persist func(dispatcherState) error
+}
+
+func NewDispatcher(http doer, o Options) *Dispatcher {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 8
+	}
+
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = time.Second * 10
+	}
+
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = time.Second * 5
+	}
+
+	if o.Retention <= 0 {
+		o.Retention = time.Hour * 24 * 7
+	}
+
+	return &Dispatcher{
+		http:          http,
+		options:       o,
+		subscriptions: make(map[uuid.UUID]Subscription),
+		deliveries:    make(map[uuid.UUID]*Delivery),
+		published:     make(map[string]time.Time),
+		locker:        &sync.Mutex{},
+		now:           time.Now,
+	}
+}
+
+// Subscribe registers the callback URL of the merchant, the secret is generated when empty.
+func (d *Dispatcher) Subscribe(_ context.Context, merchantID uuid.UUID, url string, secret string) (Subscription, error) {
+	if secret == "" {
+		buff := make([]byte, 32)
+		if _, err := rand.Read(buff); err != nil {
+			return Subscription{}, fmt.Errorf("Dispatcher.Subscribe: %w", err)
+		}
+
+		secret = hex.EncodeToString(buff)
+	}
+
+	s := Subscription{
+		ID:         uuid.New(),
+		MerchantID: merchantID,
+		URL:        url,
+		Secret:     secret,
+		CreatedAt:  d.now().UTC(),
+	}
+
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	d.subscriptions[s.ID] = s
+
+	if err := d.save(); err != nil {
+		delete(d.subscriptions, s.ID)
+		return Subscription{}, fmt.Errorf("Dispatcher.Subscribe: %w", err)
+	}
+
+	return s, nil
+}
+
+func (d *Dispatcher) Unsubscribe(_ context.Context, merchantID uuid.UUID, id uuid.UUID) error {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	s, ok := d.subscriptions[id]
+	if !ok || s.MerchantID != merchantID {
+		return fmt.Errorf("Dispatcher.Unsubscribe(%+q): %w", id, ErrNotFound)
+	}
+
+	delete(d.subscriptions, id)
+
+	if err := d.save(); err != nil {
+		d.subscriptions[id] = s
+		return fmt.Errorf("Dispatcher.Unsubscribe(%+q): %w", id, err)
+	}
+
+	return nil
+}
+
+// Publish schedules the delivery of the given event to all the subscribers of the merchant owning the payment.
+// The error means that the deliveries could not be stored, so the relay publishes the event again.
+func (d *Dispatcher) Publish(_ context.Context, m datastore.OutboxMessage) error {
+	n, ok := notificationFromEvent(m)
+	if !ok {
+		return nil
+	}
+
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	if _, ok := d.published[n.ID]; ok {
+		return nil
+	}
+
+	d.published[n.ID] = d.now()
+
+	var created []uuid.UUID
+
+	for _, s := range d.subscriptions {
+		if s.MerchantID != m.Event.MerchantID {
+			continue
+		}
+
+		id := uuid.New()
+		created = append(created, id)
+		d.deliveries[id] = &Delivery{
+			ID:             id,
+			MerchantID:     s.MerchantID,
+			SubscriptionID: s.ID,
+			Notification:   n,
+			Status:         DeliveryPending,
+			NextAttemptAt:  d.now(),
+		}
+	}
+
+	if err := d.save(); err != nil {
+		delete(d.published, n.ID)
+		for _, id := range created {
+			delete(d.deliveries, id)
+		}
+
+		return fmt.Errorf("Dispatcher.Publish(%+q): %w", n.ID, err)
+	}
+
+	return nil
+}
+
+// Deliveries returns the delivery log of the merchant, optionally filtered by the status, the latest first.
+func (d *Dispatcher) Deliveries(_ context.Context, merchantID uuid.UUID, status DeliveryStatus) []Delivery {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	result := make([]Delivery, 0, len(d.deliveries))
+	for _, x := range d.deliveries {
+		if x.MerchantID == merchantID && (status == "" || x.Status == status) {
+			result = append(result, copyDelivery(x))
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Notification.OccurredAt.After(result[b].Notification.OccurredAt)
+	})
+
+	return result
+}
+
+// Redeliver schedules the delivery immediately, regardless of its status, it gets [Options.MaxAttempts] attempts again.
+func (d *Dispatcher) Redeliver(_ context.Context, merchantID uuid.UUID, id uuid.UUID) (Delivery, error) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	x, ok := d.deliveries[id]
+	if !ok || x.MerchantID != merchantID {
+		return Delivery{}, fmt.Errorf("Dispatcher.Redeliver(%+q): %w", id, ErrNotFound)
+	}
+
+	previous := copyDelivery(x)
+
+	x.Status = DeliveryPending
+	x.NextAttemptAt = d.now()
+	x.failures = 0
+
+	if err := d.save(); err != nil {
+		*x = previous
+		return Delivery{}, fmt.Errorf("Dispatcher.Redeliver(%+q): %w", id, err)
+	}
+
+	return copyDelivery(x), nil
+}
+
+// Run sends the due deliveries until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.DeliverDue(ctx)
+		d.Prune()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue performs a single attempt for every pending delivery that is due.
+func (d *Dispatcher) DeliverDue(ctx context.Context) {
+	type job struct {
+		delivery     Delivery
+		subscription Subscription
+	}
+
+	var jobs []job
+
+	func() {
+		d.locker.Lock()
+		defer d.locker.Unlock()
+
+		now := d.now()
+		unsubscribed := false
+
+		for _, x := range d.deliveries {
+			if x.Status != DeliveryPending || x.NextAttemptAt.After(now) {
+				continue
+			}
+
+			s, ok := d.subscriptions[x.SubscriptionID]
+			if !ok {
+				// the merchant unsubscribed in the meantime
+				x.Status = DeliveryDead
+				unsubscribed = true
+
+				continue
+			}
+
+			jobs = append(jobs, job{delivery: copyDelivery(x), subscription: s})
+		}
+
+		if unsubscribed {
+			d.saveOrLog()
+		}
+	}()
+
+	for _, j := range jobs {
+		a := d.send(ctx, j.subscription, j.delivery.Notification)
+		d.finish(j.delivery.ID, a)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, s Subscription, n Notification) Attempt {
+	ctx, cancel := context.WithTimeout(ctx, d.options.Timeout)
+	defer cancel()
+
+	now := d.now()
+	a := Attempt{At: now.UTC()}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		a.Error = fmt.Sprintf("could not marshal json: %s", err)
+		return a
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewBuffer(body))
+	if err != nil {
+		a.Error = fmt.Sprintf("could not build request: %s", err)
+		return a
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(s.Secret, now, body))
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		a.Error = fmt.Sprintf("could not perform http request: %s", err)
+		return a
+	}
+
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Error = fmt.Sprintf("invalid status code, %d given", resp.StatusCode)
+	}
+
+	return a
+}
+
+func (d *Dispatcher) finish(id uuid.UUID, a Attempt) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	x, ok := d.deliveries[id]
+	if !ok {
+		return
+	}
+
+	x.Attempts = append(x.Attempts, a)
+
+	// the attempt is already made, so it's kept in memory even when it cannot be stored, the next change stores it
+	defer d.saveOrLog()
+
+	if a.Error == "" {
+		x.Status = DeliveryDelivered
+		x.failures = 0
+
+		return
+	}
+
+	// TODO logger would be injected
+	log.Default().Println(fmt.Sprintf("webhook delivery %+q failed: %s", id, a.Error))
+
+	x.failures++
+
+	if x.failures >= d.options.MaxAttempts {
+		x.Status = DeliveryDead
+		return
+	}
+
+	x.NextAttemptAt = d.now().Add(d.backoff(x.failures))
+}
+
+// Prune removes delivered and dead deliveries, and the published events older than [Options.Retention].
+func (d *Dispatcher) Prune() {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	threshold := d.now().Add(-d.options.Retention)
+	pruned := false
+
+	for id, x := range d.deliveries {
+		if x.Status == DeliveryPending {
+			continue
+		}
+
+		last := x.NextAttemptAt
+		if len(x.Attempts) > 0 {
+			last = x.Attempts[len(x.Attempts)-1].At
+		}
+
+		if last.Before(threshold) {
+			delete(d.deliveries, id)
+			pruned = true
+		}
+	}
+
+	for id, at := range d.published {
+		if at.Before(threshold) {
+			delete(d.published, id)
+			pruned = true
+		}
+	}
+
+	if pruned {
+		d.saveOrLog()
+	}
+}
+
+func (d *Dispatcher) backoff(failures int) time.Duration {
+	b := d.options.InitialBackoff
+	for i := 1; i < failures && b < d.options.MaxBackoff; i++ {
+		b *= 2
+	}
+
+	return min(b, d.options.MaxBackoff)
+}
+
+// Sign returns the value of [SignatureHeader], merchants compute the same HMAC to verify the notification.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func notificationFromEvent(m datastore.OutboxMessage) (Notification, bool) {
+	statuses := map[datastore.EventType]datastore.PaymentStatus{
+		datastore.EventPaymentInitiated:  datastore.PaymentInitiated,
+		datastore.EventPaymentPaid:       datastore.PaymentPaid,
+		datastore.EventPaymentFailed:     datastore.PaymentFailed,
+		datastore.EventPaymentExpired:    datastore.PaymentExpired,
+		datastore.EventPaymentRefunded:   datastore.PaymentRefunded,
+		datastore.EventPaymentAuthorized: datastore.PaymentAuthorized,
+		datastore.EventPaymentCaptured:   datastore.PaymentPaid,
+		datastore.EventPaymentVoided:     datastore.PaymentVoided,
+		datastore.EventPaymentCancelled:  datastore.PaymentCancelled,
+		// the merchant learns that the payment is held, and the decision of the review
+		datastore.EventPaymentHeldForReview: datastore.PaymentReview,
+		datastore.EventPaymentApproved:      datastore.PaymentInitiated,
+		datastore.EventPaymentRejected:      datastore.PaymentRejected,
+		// the automatic refund is notified separately
+		datastore.EventPaymentPaidAfterCancel: datastore.PaymentPaid,
+	}
+
+	refundStatuses := map[datastore.EventType]datastore.RefundStatus{
+		datastore.EventRefundSucceeded: datastore.RefundSucceeded,
+		datastore.EventRefundFailed:    datastore.RefundFailed,
+	}
+
+	if refundStatus, ok := refundStatuses[m.Event.Type]; ok {
+		return Notification{
+			ID:           fmt.Sprintf("%s:%d", m.Event.PaymentID, m.Event.Version),
+			Type:         fmt.Sprintf("refund.%s", refundStatus),
+			PaymentID:    m.Event.PaymentID,
+			OccurredAt:   m.Event.OccurredAt,
+			RefundID:     m.Event.RefundID,
+			RefundStatus: refundStatus,
+		}, true
+	}
+
+	status, ok := statuses[m.Event.Type]
+	if !ok {
+		return Notification{}, false
+	}
+
+	return Notification{
+		ID:         fmt.Sprintf("%s:%d", m.Event.PaymentID, m.Event.Version),
+		Type:       fmt.Sprintf("payment.%s", status),
+		PaymentID:  m.Event.PaymentID,
+		Status:     status,
+		OccurredAt: m.Event.OccurredAt,
+	}, true
+}
+
+func copyDelivery(x *Delivery) Delivery {
+	c := *x
+	c.Attempts = append([]Attempt(nil), x.Attempts...)
+
+	return c
+}
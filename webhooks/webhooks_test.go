@@ -0,0 +1,162 @@
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"payments/datastore"
+	"payments/webhooks"
+)
+
+func init() {
+	log.SetOutput(io.Discard)
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	merchantID, anotherMerchantID := uuid.New(), uuid.New()
+	paid := datastore.OutboxMessage{
+		Seq: 2,
+		Event: datastore.Event{
+			PaymentID:  uuid.New(),
+			MerchantID: merchantID,
+			Version:    2,
+			Type:       datastore.EventPaymentPaid,
+			OccurredAt: time.Now(),
+		},
+	}
+
+	t.Run("Signed delivery", func(t *testing.T) {
+		t.Parallel()
+
+		var signature, body atomic.Value
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			body.Store(b)
+			signature.Store(r.Header.Get(webhooks.SignatureHeader))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		d := webhooks.NewDispatcher(http.DefaultClient, webhooks.Options{})
+		s, err := d.Subscribe(ctx, merchantID, server.URL, "my-secret")
+		require.NoError(t, err)
+
+		// merchants are notified about their own payments only
+		_, err = d.Subscribe(ctx, anotherMerchantID, server.URL, "another-secret")
+		require.NoError(t, err)
+
+		require.NoError(t, d.Publish(ctx, paid))
+		require.NoError(t, d.Publish(ctx, paid)) // duplicate from the outbox relay
+
+		d.DeliverDue(ctx)
+
+		assert.Empty(t, d.Deliveries(ctx, anotherMerchantID, ""))
+
+		deliveries := d.Deliveries(ctx, merchantID, "")
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, webhooks.DeliveryDelivered, deliveries[0].Status)
+		assert.Equal(t, s.ID, deliveries[0].SubscriptionID)
+		assert.Equal(t, "payment.paid", deliveries[0].Notification.Type)
+
+		at := deliveries[0].Attempts[0].At
+		assert.Equal(t, webhooks.Sign("my-secret", at, body.Load().([]byte)), signature.Load())
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		d := webhooks.NewDispatcher(http.DefaultClient, webhooks.Options{Retention: time.Millisecond * 20})
+		_, err := d.Subscribe(ctx, merchantID, server.URL, "")
+		require.NoError(t, err)
+
+		require.NoError(t, d.Publish(ctx, paid))
+		d.DeliverDue(ctx)
+
+		// recent deliveries are kept
+		d.Prune()
+		require.Len(t, d.Deliveries(ctx, merchantID, webhooks.DeliveryDelivered), 1)
+
+		time.Sleep(time.Millisecond * 30)
+		d.Prune()
+		assert.Empty(t, d.Deliveries(ctx, merchantID, ""))
+
+		// the event is not remembered anymore, so the duplicate is delivered again
+		require.NoError(t, d.Publish(ctx, paid))
+		assert.Len(t, d.Deliveries(ctx, merchantID, webhooks.DeliveryPending), 1)
+	})
+
+	t.Run("Dead letter and redelivery", func(t *testing.T) {
+		t.Parallel()
+
+		var fail atomic.Bool
+		fail.Store(true)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if fail.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		d := webhooks.NewDispatcher(http.DefaultClient, webhooks.Options{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond * 4,
+		})
+		_, err := d.Subscribe(ctx, merchantID, server.URL, "")
+		require.NoError(t, err)
+		require.NoError(t, d.Publish(ctx, paid))
+
+		for i := 0; i < 5; i++ {
+			d.DeliverDue(ctx)
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		dead := d.Deliveries(ctx, merchantID, webhooks.DeliveryDead)
+		require.Len(t, dead, 1)
+		assert.Len(t, dead[0].Attempts, 3)
+
+		_, err = d.Redeliver(ctx, anotherMerchantID, dead[0].ID)
+		require.ErrorIs(t, err, webhooks.ErrNotFound)
+
+		// the redelivered delivery gets all the attempts again
+		_, err = d.Redeliver(ctx, merchantID, dead[0].ID)
+		require.NoError(t, err)
+		d.DeliverDue(ctx)
+
+		pending := d.Deliveries(ctx, merchantID, webhooks.DeliveryPending)
+		require.Len(t, pending, 1)
+		assert.Len(t, pending[0].Attempts, 4)
+
+		fail.Store(false)
+		time.Sleep(time.Millisecond * 10)
+		d.DeliverDue(ctx)
+
+		delivered := d.Deliveries(ctx, merchantID, webhooks.DeliveryDelivered)
+		require.Len(t, delivered, 1)
+		assert.Len(t, delivered[0].Attempts, 5)
+
+		_, err = d.Redeliver(ctx, merchantID, uuid.New())
+		require.ErrorIs(t, err, webhooks.ErrNotFound)
+	})
+}